@@ -40,12 +40,46 @@ func main() {
 		err = db.Initialize()
 	case "add":
 		err = cliManager.HandleAddCommand(os.Args[1:])
+	case "extract":
+		err = cliManager.HandleExtractCommand(os.Args[1:])
+	case "autotag":
+		err = cliManager.HandleAutotagCommand(os.Args[1:])
 	case "taxonomy":
 		err = cliManager.HandleTaxonomyCommand(os.Args[1:])
 	case "tag":
 		err = cliManager.HandleTagCommand(os.Args[1:])
+	case "untag":
+		err = cliManager.HandleUntagCommand(os.Args[1:])
+	case "tags":
+		err = cliManager.HandleTagsCommand(os.Args[1:])
+	case "set":
+		err = cliManager.HandleSetCommand(os.Args[1:])
+	case "get":
+		err = cliManager.HandleGetCommand(os.Args[1:])
+	case "unset":
+		err = cliManager.HandleUnsetCommand(os.Args[1:])
+	case "types":
+		err = cliManager.HandleTypesCommand(os.Args[1:])
 	case "search":
 		err = cliManager.HandleSearchCommand(os.Args[1:])
+	case "export":
+		err = cliManager.HandleExportCommand(os.Args[1:])
+	case "import":
+		err = cliManager.HandleImportCommand(os.Args[1:])
+	case "sidecar":
+		err = cliManager.HandleSidecarCommand(os.Args[1:])
+	case "serve":
+		err = cliManager.HandleServeCommand(os.Args[1:])
+	case "xattr":
+		err = cliManager.HandleXattrCommand(os.Args[1:])
+	case "stage":
+		err = cliManager.HandleStageCommand(os.Args[1:])
+	case "triage":
+		err = cliManager.HandleTriageCommand(os.Args[1:])
+	case "view":
+		err = cliManager.HandleViewCommand(os.Args[1:])
+	case "watch":
+		err = cliManager.HandleWatchCommand(os.Args[1:])
 	case "check":
 		err = cliManager.HandleCheckCommand(os.Args[1:])
 	case "verify":
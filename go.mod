@@ -2,4 +2,11 @@ module go-fart
 
 go 1.23.4
 
-require github.com/mattn/go-sqlite3 v1.14.28 // indirect
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/net v0.43.0
+	golang.org/x/sys v0.35.0
+	golang.org/x/term v0.34.0
+)
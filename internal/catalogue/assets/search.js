@@ -0,0 +1,60 @@
+"use strict";
+
+// Searches the index in search-index.js, which sets fartIndex
+
+const maxResults = 500;
+
+function formatSize(size) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (size >= 1024 && i < units.length - 1) {
+    size /= 1024;
+    i++;
+  }
+  return (i === 0 ? size : size.toFixed(1)) + " " + units[i];
+}
+
+function el(tag, props, children) {
+  const node = Object.assign(document.createElement(tag), props || {});
+  for (const child of children || []) {
+    node.append(child);
+  }
+  return node;
+}
+
+function matches(file, words) {
+  const text = (file.path + "\n" + file.tags.join("\n")).toLowerCase();
+  return words.every((word) => text.includes(word));
+}
+
+function search(query) {
+  const words = query.toLowerCase().split(/\s+/).filter((word) => word);
+  const found = fartIndex.filter((file) => matches(file, words));
+  const results = document.getElementById("results");
+  results.replaceChildren();
+  for (const file of found.slice(0, maxResults)) {
+    const thumb = el("td", { className: "thumb" });
+    if (file.thumbnail) {
+      thumb.append(el("img", { src: file.thumbnail, alt: "", loading: "lazy" }));
+    }
+    results.append(el("tr", {}, [
+      thumb,
+      el("td", { className: "path", textContent: file.path }),
+      el("td", { className: "tags" }, file.tags.flatMap((tag) => [el("span", { className: "tag", textContent: tag }), " "])),
+      el("td", { className: "size", textContent: formatSize(file.size) }),
+      el("td", { className: "date", textContent: file.modified }),
+    ]));
+  }
+  let summary = found.length + (found.length === 1 ? " file" : " files");
+  if (found.length > maxResults) {
+    summary += ", showing the first " + maxResults;
+  }
+  document.getElementById("summary").textContent = summary;
+}
+
+const input = document.querySelector("header input[name=q]");
+input.value = new URLSearchParams(location.search).get("q") || "";
+input.form.addEventListener("submit", (event) => event.preventDefault());
+input.addEventListener("input", () => search(input.value));
+input.focus();
+search(input.value);
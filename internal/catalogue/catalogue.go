@@ -0,0 +1,392 @@
+// Package catalogue renders the archive as static HTML pages that need no
+// server: an index, a page per taxonomy and per tag, and a search page
+// working from a generated JSON index.
+package catalogue
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// marker is written to every catalogue, so that writing one again never
+// removes anything from a directory it didn't make
+const marker = ".fart-catalogue"
+
+// Directories within a catalogue
+const (
+	taxonomiesDir = "taxonomies"
+	thumbnailsDir = "thumbnails"
+)
+
+// searchIndexFile holds the JSON index searched by the search page. It is a
+// script rather than a .json file because browsers don't let pages opened
+// from the disk fetch other files.
+const searchIndexFile = "search-index.js"
+
+//go:embed templates assets
+var files embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"href": href,
+	"size": formatSize,
+	"tree": func(root string, nodes []*tagNode) tree { return tree{root, nodes} },
+}).ParseFS(files, "templates/*.html"))
+
+// Options changes what is written
+type Options struct {
+	// Thumbnails makes a small JPEG of each JPEG, PNG and GIF image
+	Thumbnails bool
+}
+
+// Stats counts what was written
+type Stats struct {
+	Files      int
+	Pages      int
+	Thumbnails int
+}
+
+// fileEntry is a file as listed on the pages and in the search index
+type fileEntry struct {
+	Path     string   `json:"path"`
+	Size     int64    `json:"size"`
+	Modified string   `json:"modified"`
+	Tags     []string `json:"tags"`                // as taxonomy:tag
+	Thumb    string   `json:"thumbnail,omitempty"` // relative to the catalogue
+}
+
+// tagNode is a tag with the files that have it or any tag beneath it
+type tagNode struct {
+	Name     string // the last level of the tag
+	Tag      string // the tag path
+	Dir      string // directory of its page, relative to the catalogue
+	Children []*tagNode
+	Count    int
+	files    []*fileEntry
+	byName   map[string]*tagNode
+	used     map[string]bool // directory names of the children
+}
+
+// taxonomy is a taxonomy with the tree of its tags
+type taxonomy struct {
+	Name  string
+	Dir   string
+	Count int // files with any tag in the taxonomy
+	Root  *tagNode
+}
+
+// tree is the data of the template listing tags, which calls itself for the
+// children of each tag
+type tree struct {
+	Root  string
+	Nodes []*tagNode
+}
+
+// crumb is a link in the trail at the top of a page
+type crumb struct {
+	Name string
+	Href string
+}
+
+// page is the data the templates render
+type page struct {
+	Title      string
+	Root       string // relative path from the page to the catalogue
+	Generated  string
+	Crumbs     []crumb
+	Files      []*fileEntry
+	TotalSize  int64
+	Taxonomies []*taxonomy
+	Taxonomy   *taxonomy
+	Tag        *tagNode
+}
+
+// Write renders the catalogue of records into dir. A directory that already
+// holds a catalogue is brought up to date, keeping the thumbnails of images
+// that haven't changed.
+func Write(dir string, taxonomies []database.Taxonomy, records []*database.FileRecord, opts Options) (*Stats, error) {
+	if err := prepare(dir); err != nil {
+		return nil, err
+	}
+	w := &writer{dir: dir, generated: time.Now().Format("2006-01-02 15:04"), stats: &Stats{}}
+
+	entries := make([]*fileEntry, 0, len(records))
+	thumbnails := make(map[string]bool)
+	for _, record := range records {
+		entry := newFileEntry(record)
+		if opts.Thumbnails {
+			if name, ok := w.thumbnail(record); ok {
+				entry.Thumb = thumbnailsDir + "/" + name
+				thumbnails[name] = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	w.stats.Files = len(entries)
+	pruneThumbnails(filepath.Join(dir, thumbnailsDir), thumbnails)
+
+	trees := buildTrees(taxonomies, records, entries)
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	if err := w.page("index.html", "index", page{Title: "Archive", Files: entries, TotalSize: total, Taxonomies: trees}); err != nil {
+		return nil, err
+	}
+	if err := w.page("search.html", "search", page{Title: "Search", Crumbs: []crumb{{"Archive", "index.html"}}}); err != nil {
+		return nil, err
+	}
+	for _, t := range trees {
+		if err := w.taxonomyPages(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.searchIndex(entries); err != nil {
+		return nil, err
+	}
+	if err := w.assets(); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, marker), nil, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", marker, err)
+	}
+	return w.stats, nil
+}
+
+// prepare makes dir ready for a catalogue, removing the pages of a previous
+// one
+func prepare(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err != nil {
+			return fmt.Errorf("%s is not empty and doesn't hold a catalogue", dir)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dir, taxonomiesDir)); err != nil {
+		return fmt.Errorf("failed to remove old pages: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return nil
+}
+
+// newFileEntry lists a file with its tags in order
+func newFileEntry(record *database.FileRecord) *fileEntry {
+	entry := &fileEntry{
+		Path:     filepath.ToSlash(filepath.Clean(record.Path)),
+		Size:     record.Size,
+		Modified: formatTime(record.ModifiedAt),
+		Tags:     []string{},
+	}
+	for name, tags := range record.Tags {
+		for _, tag := range tags {
+			entry.Tags = append(entry.Tags, name+":"+tag)
+		}
+	}
+	sort.Strings(entry.Tags)
+	return entry
+}
+
+// buildTrees arranges the tags of each taxonomy into a tree, leaving out
+// taxonomies without files
+func buildTrees(taxonomies []database.Taxonomy, records []*database.FileRecord, entries []*fileEntry) []*taxonomy {
+	var trees []*taxonomy
+	used := make(map[string]bool)
+	for _, t := range taxonomies {
+		dir := path.Join(taxonomiesDir, fileops.UniqueName(fileops.SafeName(t.Name), used))
+		tree := &taxonomy{Name: t.Name, Dir: dir, Root: newNode("", "", dir)}
+		for i, record := range records {
+			tags := record.Tags[t.Name]
+			if len(tags) == 0 {
+				continue
+			}
+			tree.Count++
+			// A file is counted once under each tag, even with several
+			// tags beneath it
+			seen := make(map[*tagNode]bool)
+			for _, tag := range tags {
+				node := tree.Root
+				for _, level := range database.SplitTagPath(tag) {
+					node = node.child(level)
+					if !seen[node] {
+						seen[node] = true
+						node.files = append(node.files, entries[i])
+					}
+				}
+			}
+		}
+		if tree.Count > 0 {
+			tree.Root.finish()
+			trees = append(trees, tree)
+		}
+	}
+	return trees
+}
+
+func newNode(name, tag, dir string) *tagNode {
+	return &tagNode{Name: name, Tag: tag, Dir: dir, byName: make(map[string]*tagNode), used: make(map[string]bool)}
+}
+
+// child returns the child tag with a name, adding it if need be
+func (n *tagNode) child(name string) *tagNode {
+	if c, ok := n.byName[name]; ok {
+		return c
+	}
+	tag := database.EscapeTagName(name)
+	if n.Tag != "" {
+		tag = n.Tag + "/" + tag
+	}
+	c := newNode(name, tag, path.Join(n.Dir, fileops.UniqueName(fileops.SafeName(name), n.used)))
+	n.byName[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// finish counts the files of each tag and puts the children in order
+func (n *tagNode) finish() {
+	n.Count = len(n.files)
+	sort.Slice(n.Children, func(i, j int) bool {
+		return strings.ToLower(n.Children[i].Name) < strings.ToLower(n.Children[j].Name)
+	})
+	for _, c := range n.Children {
+		c.finish()
+	}
+}
+
+// writer writes the files of a catalogue
+type writer struct {
+	dir       string
+	generated string
+	stats     *Stats
+}
+
+// taxonomyPages writes the page of a taxonomy and of each of its tags
+func (w *writer) taxonomyPages(t *taxonomy) error {
+	crumbs := []crumb{{"Archive", "index.html"}}
+	if err := w.page(t.Dir+"/index.html", "taxonomy", page{Title: t.Name, Crumbs: crumbs, Taxonomy: t}); err != nil {
+		return err
+	}
+	crumbs = append(crumbs, crumb{t.Name, t.Dir + "/index.html"})
+
+	var walk func(n *tagNode, crumbs []crumb) error
+	walk = func(n *tagNode, crumbs []crumb) error {
+		p := page{Title: n.Name, Crumbs: crumbs, Taxonomy: t, Tag: n, Files: n.files}
+		if err := w.page(n.Dir+"/index.html", "tag", p); err != nil {
+			return err
+		}
+		crumbs = append(crumbs[:len(crumbs):len(crumbs)], crumb{n.Name, n.Dir + "/index.html"})
+		for _, c := range n.Children {
+			if err := walk(c, crumbs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, c := range t.Root.Children {
+		if err := walk(c, crumbs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// page renders a template to a page at name, a slash-separated path within
+// the catalogue
+func (w *writer) page(name, tmpl string, p page) error {
+	p.Root = strings.Repeat("../", strings.Count(name, "/"))
+	p.Generated = w.generated
+	filePath := filepath.Join(w.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filePath, err)
+	}
+	defer file.Close()
+	if err := templates.ExecuteTemplate(file, tmpl, p); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+	w.stats.Pages++
+	return nil
+}
+
+// searchIndex writes the index of every file for the search page
+func (w *writer) searchIndex(entries []*fileEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	script := "var fartIndex = " + string(data) + ";\n"
+	if err := os.WriteFile(filepath.Join(w.dir, searchIndexFile), []byte(script), 0644); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return nil
+}
+
+// assets copies the styles and scripts of the pages
+func (w *writer) assets() error {
+	return fs.WalkDir(files, "assets", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(w.dir, path.Base(name)), data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path.Base(name), err)
+		}
+		return nil
+	})
+}
+
+// href turns a slash-separated path within the catalogue into a link
+func href(root, name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return root + strings.Join(parts, "/")
+}
+
+// formatTime shows a modification time to the minute
+func formatTime(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatSize shows a size in bytes in the largest unit it fills
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value, i := float64(size), 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
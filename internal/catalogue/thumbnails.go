@@ -0,0 +1,150 @@
+package catalogue
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// thumbnailSize is the largest width or height of a thumbnail
+const thumbnailSize = 160
+
+// maxThumbnailPixels skips images too large to decode comfortably
+const maxThumbnailPixels = 64 << 20
+
+// thumbnailTypes are the image types the standard library decodes
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// thumbnail makes the thumbnail of an image, named by its hash so that it is
+// kept while the image is unchanged. The result is false for files that
+// aren't images, or whose thumbnail couldn't be made.
+func (w *writer) thumbnail(record *database.FileRecord) (string, bool) {
+	filePath := filepath.Clean(record.Path)
+	if database.IsContainerMember(filePath) {
+		return "", false
+	}
+	t, err := fileops.DetectFileType(filePath)
+	if err != nil || !thumbnailTypes[t.MIMEType] {
+		return "", false
+	}
+
+	name := record.Hash + ".jpg"
+	dest := filepath.Join(w.dir, thumbnailsDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		w.stats.Thumbnails++
+		return name, true
+	}
+	if err := makeThumbnail(filePath, dest); err != nil {
+		fmt.Printf("Warning: no thumbnail for %s: %v\n", filePath, err)
+		return "", false
+	}
+	w.stats.Thumbnails++
+	return name, true
+}
+
+// makeThumbnail scales an image down to fit thumbnailSize and saves it as a
+// JPEG
+func makeThumbnail(src, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return fmt.Errorf("image is too large")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, scale(img, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
+
+// scale shrinks an image to fit within size by averaging the pixels each
+// thumbnail pixel covers, over a white background for transparent images
+func scale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// The colours are premultiplied, so white shows through
+			// in proportion to the transparency
+			white := 0xffff - a/n
+			thumb.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return thumb
+}
+
+// pruneThumbnails removes the thumbnails of images no longer in the archive
+func pruneThumbnails(dir string, keep map[string]bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] && strings.HasSuffix(entry.Name(), ".jpg") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
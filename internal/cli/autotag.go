@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"go-fart/internal/rules"
+)
+
+// HandleAutotagCommand applies the rules file to files in the archive, and
+// reports which rules fired
+func (c *CLI) HandleAutotagCommand(args []string) error {
+	args, dryRun := hasFlag(args, "--dry-run")
+	if len(args) < 1 {
+		return fmt.Errorf("usage: fart autotag [--dry-run] [<file|directory|pattern>...]")
+	}
+
+	ruleSet, err := rules.Load(rules.File)
+	if err != nil {
+		return err
+	}
+	if len(ruleSet) == 0 {
+		return fmt.Errorf("no rules found in %s", rules.File)
+	}
+
+	var files []string
+	if len(args) > 1 {
+		paths, err := collectFiles(args[1:])
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			filePath, err := archivePath(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filePath)
+		}
+	} else {
+		if files, err = c.db.GetAllFiles(); err != nil {
+			return err
+		}
+		for i, file := range files {
+			files[i] = filepath.Clean(file)
+		}
+		sort.Strings(files)
+	}
+
+	fired := make(map[int]int)
+	for _, filePath := range files {
+		changes, matched := ruleChanges(ruleSet, filePath)
+		for _, rule := range matched {
+			fired[rule.Line]++
+		}
+
+		if dryRun {
+			for _, change := range changes {
+				fmt.Printf("%s: would %s\n", filePath, change)
+			}
+			continue
+		}
+		if err := c.applyMetadata(filePath, changes); err != nil {
+			fmt.Printf("Warning: %s: %v\n", filePath, err)
+		}
+	}
+
+	fmt.Println("Rules fired:")
+	for _, rule := range ruleSet {
+		fmt.Printf("  line %d: %s (%d files)\n", rule.Line, rule.Pattern, fired[rule.Line])
+	}
+	return nil
+}
+
+// ruleChanges returns the tags and properties that the rules give a file,
+// along with the rules that matched it
+func ruleChanges(ruleSet []rules.Rule, filePath string) ([]metadataChange, []rules.Rule) {
+	var changes []metadataChange
+	var matched []rules.Rule
+
+	path := filepath.ToSlash(filePath)
+	for _, rule := range ruleSet {
+		actions, ok := rule.Match(path)
+		if !ok {
+			continue
+		}
+		matched = append(matched, rule)
+		for _, action := range actions {
+			changes = append(changes, metadataChange{
+				Field:    rule.Pattern,
+				Taxonomy: action.Taxonomy,
+				Property: action.Property,
+				Value:    action.Value,
+			})
+		}
+	}
+	return changes, matched
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/importers"
+	"go-fart/internal/query"
+	"go-fart/internal/rules"
+)
+
+// importCalibre adds the books of a Calibre library inside the archive and
+// applies their Calibre metadata. Fields are stored like extracted document
+// fields, so the author goes to the author taxonomy unless mapped elsewhere.
+// Only changes are applied, so importing the library again is safe.
+func (c *CLI) importCalibre(libraryDir string) error {
+	if _, err := archivePath(libraryDir); err != nil {
+		return fmt.Errorf("the Calibre library must be inside the archive: %w", err)
+	}
+	books, err := importers.ReadCalibre(libraryDir)
+	if err != nil {
+		return err
+	}
+
+	var opts addOptions
+	if opts.rules, err = rules.Load(rules.File); err != nil {
+		return err
+	}
+
+	files := 0
+	for _, book := range books {
+		for _, format := range book.Formats {
+			path := filepath.Join(libraryDir, format)
+			if err := c.importCalibreFile(path, book, opts); err != nil {
+				fmt.Printf("Warning: %s: %v\n", path, err)
+				continue
+			}
+			files++
+		}
+	}
+
+	fmt.Printf("Imported %d books (%d files)\n", len(books), files)
+	return nil
+}
+
+// importCalibreFile adds a format of a book unless it is already in the
+// database unchanged, and applies the book's metadata that it doesn't have.
+// Values an earlier import applied that the book no longer has are removed.
+func (c *CLI) importCalibreFile(path string, book *importers.CalibreBook, opts addOptions) error {
+	filePath, err := archivePath(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	record, err := c.db.GetFileRecord(filePath)
+	if err != nil || !sameFileInfo(record, info) {
+		if err := c.addFile(path, opts); err != nil {
+			return err
+		}
+		if record, err = c.db.GetFileRecord(filePath); err != nil {
+			return err
+		}
+	}
+
+	changes, err := c.proposeMetadata(calibreMetadata(book))
+	if err != nil {
+		return err
+	}
+	for _, tag := range book.Tags {
+		changes = append(changes, metadataChange{Taxonomy: query.DefaultField, Value: database.EscapeTagName(tag)})
+	}
+
+	// The values earlier imports applied are recorded, so that those Calibre
+	// no longer has can be removed without touching values added by hand
+	current := make(map[database.CalibreValue]bool)
+	properties := make(map[string]bool)
+	for _, change := range changes {
+		current[database.CalibreValue{Taxonomy: change.Taxonomy, Property: change.Property, Value: change.Value}] = true
+		properties[change.Property] = true
+	}
+	applied, err := c.db.GetCalibreApplied(filePath)
+	if err != nil {
+		return err
+	}
+	recorded := len(applied) > 0
+	kept := make(map[database.CalibreValue]bool)
+	for _, value := range applied {
+		if current[value] {
+			kept[value] = true
+			continue
+		}
+		if value.Property != "" && properties[value.Property] {
+			// Replaced by the new value
+			continue
+		}
+		if err := c.removeApplied(filePath, record, value); err != nil {
+			fmt.Printf("Warning: %s: %v\n", filePath, err)
+		}
+	}
+
+	var missing []metadataChange
+	for _, change := range changes {
+		value := database.CalibreValue{Taxonomy: change.Taxonomy, Property: change.Property, Value: change.Value}
+		if change.Taxonomy != "" && !slices.Contains(record.Tags[change.Taxonomy], change.Value) ||
+			change.Property != "" && record.Properties[change.Property] != change.Value {
+			missing = append(missing, change)
+			kept[value] = true
+		} else if !recorded {
+			// Imported before imports were recorded
+			kept[value] = true
+		}
+	}
+	if err := c.applyMetadata(filePath, missing); err != nil {
+		return err
+	}
+	if err := c.recordApplied(filePath, applied, kept); err != nil {
+		return err
+	}
+
+	// Authors are tagged by the name Calibre sorts by, and can be searched
+	// for by the name shown
+	for _, change := range changes {
+		if change.Field != "doc.author" {
+			continue
+		}
+		for _, author := range book.Authors {
+			if database.EscapeTagName(author.Sort) == change.Value && author.Name != author.Sort {
+				if err := c.taxonomyManager.AddAlias(change.Taxonomy, database.EscapeTagName(author.Name), change.Value); err != nil {
+					fmt.Printf("Warning: cannot alias %q to %q: %v\n", author.Name, author.Sort, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeApplied removes a value that an earlier import applied, unless it
+// has been removed already
+func (c *CLI) removeApplied(filePath string, record *database.FileRecord, value database.CalibreValue) error {
+	if value.Taxonomy != "" {
+		if !slices.Contains(record.Tags[value.Taxonomy], value.Value) {
+			return nil
+		}
+		if err := c.taxonomyManager.UntagFile(filePath, value.Taxonomy, value.Value); err != nil {
+			return fmt.Errorf("cannot untag --%s %q: %w", value.Taxonomy, value.Value, err)
+		}
+		fmt.Printf("%s: untag --%s %q\n", filePath, value.Taxonomy, value.Value)
+		return nil
+	}
+	if record.Properties[value.Property] != value.Value {
+		return nil
+	}
+	if err := c.db.UnsetProperty(filePath, value.Property); err != nil {
+		return fmt.Errorf("cannot unset %s: %w", value.Property, err)
+	}
+	fmt.Printf("%s: unset %s\n", filePath, value.Property)
+	return nil
+}
+
+// recordApplied stores the values that imports have applied to a file,
+// unless they are the ones already recorded
+func (c *CLI) recordApplied(filePath string, applied []database.CalibreValue, kept map[database.CalibreValue]bool) error {
+	values := make([]database.CalibreValue, 0, len(kept))
+	for value := range kept {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		if a.Taxonomy != b.Taxonomy {
+			return a.Taxonomy < b.Taxonomy
+		}
+		if a.Property != b.Property {
+			return a.Property < b.Property
+		}
+		return a.Value < b.Value
+	})
+	if slices.Equal(values, applied) {
+		return nil
+	}
+	return c.db.SetCalibreApplied(filePath, values)
+}
+
+// calibreMetadata converts the metadata of a book into document fields
+func calibreMetadata(book *importers.CalibreBook) fileops.Metadata {
+	md := fileops.Metadata{}
+	md.Add("doc.title", book.Title)
+	for _, author := range book.Authors {
+		md.Add("doc.author", author.Sort)
+	}
+	if book.Series != "" {
+		md.Add("doc.series", book.Series)
+		md.Add("doc.series_index", strconv.FormatFloat(book.SeriesIndex, 'f', -1, 64))
+	}
+	if book.Publisher != "" {
+		md.Add("doc.publisher", book.Publisher)
+	}
+	for kind, value := range book.Identifiers {
+		md.Add("doc."+kind, value)
+	}
+	return md
+}
+
+// sameFileInfo reports whether a file still has the size and modification
+// time it had when it was added. The time is stored in fileops.ModTimeLayout,
+// which the driver reads back from the DATETIME column in RFC 3339.
+func sameFileInfo(record *database.FileRecord, info os.FileInfo) bool {
+	modifiedAt, err := time.Parse(fileops.ModTimeLayout, record.ModifiedAt)
+	if err != nil {
+		modifiedAt, err = time.Parse(time.RFC3339, record.ModifiedAt)
+	}
+	return err == nil && record.Size == info.Size() && modifiedAt.Equal(info.ModTime().UTC().Truncate(time.Second))
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go-fart/internal/importers"
+)
+
+// writeTestLibrary creates a Calibre library in the archive with one book,
+// tagged fantasy, in one format
+func writeTestLibrary(t *testing.T, dir string) *sql.DB {
+	t.Helper()
+	book := filepath.Join(dir, "Robert Jordan", "The Eye of the World (1)", "The Eye of the World.epub")
+	if err := os.MkdirAll(filepath.Dir(book), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(book, []byte("The Eye of the World"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, importers.CalibreDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	queries := []string{
+		`CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT, path TEXT, series_index REAL)`,
+		`CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT, sort TEXT)`,
+		`CREATE TABLE books_authors_link (id INTEGER PRIMARY KEY, book INTEGER, author INTEGER)`,
+		`CREATE TABLE series (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_series_link (id INTEGER PRIMARY KEY, book INTEGER, series INTEGER)`,
+		`CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_tags_link (id INTEGER PRIMARY KEY, book INTEGER, tag INTEGER)`,
+		`CREATE TABLE publishers (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_publishers_link (id INTEGER PRIMARY KEY, book INTEGER, publisher INTEGER)`,
+		`CREATE TABLE identifiers (id INTEGER PRIMARY KEY, book INTEGER, type TEXT, val TEXT)`,
+		`CREATE TABLE data (id INTEGER PRIMARY KEY, book INTEGER, format TEXT, name TEXT)`,
+		`INSERT INTO books VALUES (1, 'The Eye of the World', 'Robert Jordan/The Eye of the World (1)', 1)`,
+		`INSERT INTO authors VALUES (1, 'Robert Jordan', 'Jordan, Robert')`,
+		`INSERT INTO books_authors_link VALUES (1, 1, 1)`,
+		`INSERT INTO tags VALUES (1, 'fantasy')`,
+		`INSERT INTO books_tags_link VALUES (1, 1, 1)`,
+		`INSERT INTO data VALUES (1, 1, 'EPUB', 'The Eye of the World')`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestImportCalibreAgain(t *testing.T) {
+	c, db := newTestCLI(t)
+	library := writeTestLibrary(t, "calibre")
+	book := "calibre/Robert Jordan/The Eye of the World (1)/The Eye of the World.epub"
+
+	if err := c.HandleImportCommand([]string{"import", "calibre", "calibre"}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := db.GetFileRecord(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(record.Tags["tags"], "fantasy") || !slices.Contains(record.Tags["author"], "Jordan, Robert") {
+		t.Fatalf("tags = %v", record.Tags)
+	}
+	for name := range record.Properties {
+		if name != "title" {
+			t.Errorf("unexpected property %s", name)
+		}
+	}
+
+	// A file that looks unchanged isn't hashed again, so changing its content
+	// behind fart's back goes unnoticed
+	info, err := os.Stat(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(book, []byte("The Eye of the Worms"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(book, time.Time{}, info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A tag removed in Calibre goes, a tag added by hand stays
+	if _, err := library.Exec(`DELETE FROM books_tags_link`); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.taxonomyManager.TagFile(book, "tags", "to-read"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.HandleImportCommand([]string{"import", "calibre", "calibre"}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := db.GetFileRecord(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Hash != record.Hash {
+		t.Error("the file was added again")
+	}
+	if got := again.Tags["tags"]; !slices.Equal(got, []string{"to-read"}) {
+		t.Errorf("tags = %v, want [to-read]", got)
+	}
+	if !slices.Contains(again.Tags["author"], "Jordan, Robert") {
+		t.Errorf("author = %v", again.Tags["author"])
+	}
+}
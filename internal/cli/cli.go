@@ -2,7 +2,11 @@ package cli
 
 import (
 	"fmt"
+	"go-fart/internal/database"
 	"go-fart/internal/fileops"
+	"go-fart/internal/query"
+	"go-fart/internal/rules"
+	"go-fart/internal/sidecar"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,15 +20,52 @@ type CLI struct {
 type TaxonomyManager interface {
 	InitTaxonomy(name string) error
 	TagFile(filePath, taxonomyName, tagValue string) error
-	SearchByTag(taxonomyName, tagValue string) ([]string, error)
+	Search(q *query.Query) ([]string, error)
+	TagTree(taxonomyName string) ([]database.TagNode, error)
+	MoveTag(taxonomyName, tagPath, parentPath string) error
+	AddAlias(taxonomyName, alias, canonicalPath string) error
+	RemoveAlias(taxonomyName, alias string) error
+	Taxonomy(name string) (*database.Taxonomy, error)
+	Taxonomies() ([]database.Taxonomy, error)
+	ConfigureTaxonomy(t database.Taxonomy) error
+	RegisterTag(taxonomyName, tagValue string) error
+	UntagFile(filePath, taxonomyName, tagValue string) error
 }
 
 type DatabaseManager interface {
 	FileExists(hash string) (bool, error)
 	AddFile(filename, path, hash string, size int64, modifiedAt string) error
 	GetFilePathByHash(hash string) (string, error)
+	GetFilePathsBySize(size int64) ([]string, error)
+	SetStageDirectory(path string) error
+	GetStageDirectory() (string, error)
 	GetAllFiles() ([]string, error)
+	GetPresentFiles() ([]string, error)
 	UpdateFilePath(oldPath, newPath string) error
+	MarkFileMissing(filePath string) error
+	GetMissingFileByHash(hash string) (string, error)
+	SetProperty(filePath, name, value string) error
+	UnsetProperty(filePath, name string) error
+	GetProperties(filePath string) (map[string]string, error)
+	GetFileRecord(filePath string) (*database.FileRecord, error)
+	GetFileRecords(filePaths []string) ([]*database.FileRecord, error)
+	ClearFileMetadata(filePath string) error
+	GetCalibreApplied(filePath string) ([]database.CalibreValue, error)
+	SetCalibreApplied(filePath string, values []database.CalibreValue) error
+	SetFieldMapping(m database.FieldMapping) error
+	RemoveFieldMapping(field string) error
+	GetFieldMappings() (map[string]database.FieldMapping, error)
+	SetFileType(filePath, mimeType, kind string) error
+	SetContainerMembers(containerPath string, members []database.Member) error
+	GetFileTypes() ([]database.FileType, error)
+	RemoveFile(filePath string) error
+	SaveSearch(name, search string) error
+	GetSavedSearch(name string) (string, error)
+	GetSavedSearches() ([]database.SavedSearch, error)
+	RemoveSavedSearch(name string) error
+	SaveView(v database.View) error
+	GetView(path string) (*database.View, error)
+	GetViews() ([]database.View, error)
 }
 
 func New(tm TaxonomyManager, db DatabaseManager) *CLI {
@@ -37,15 +78,30 @@ func New(tm TaxonomyManager, db DatabaseManager) *CLI {
 // HandleTaxonomyCommand processes taxonomy-related commands
 func (c *CLI) HandleTaxonomyCommand(args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf("usage: fart taxonomy <init|tag|search> [arguments]")
+		return fmt.Errorf("usage: fart taxonomy <init|set|list> [arguments]")
 	}
 
 	switch args[1] {
 	case "init":
-		if len(args) != 3 {
-			return fmt.Errorf("usage: fart taxonomy init <taxonomy-name>")
+		if len(args) < 3 {
+			return fmt.Errorf("usage: fart taxonomy init <taxonomy-name> [options]")
 		}
-		return c.taxonomyManager.InitTaxonomy(args[2])
+		if err := c.taxonomyManager.InitTaxonomy(args[2]); err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			return nil
+		}
+		return c.configureTaxonomy(args[2], args[3:])
+
+	case "set":
+		if len(args) < 4 {
+			return fmt.Errorf("usage: fart taxonomy set <taxonomy-name> <options>")
+		}
+		return c.configureTaxonomy(args[2], args[3:])
+
+	case "list":
+		return c.listTaxonomies()
 
 	default:
 		return fmt.Errorf("unknown taxonomy subcommand: %s", args[1])
@@ -54,58 +110,128 @@ func (c *CLI) HandleTaxonomyCommand(args []string) error {
 
 // HandleTagCommand processes tag-related commands
 func (c *CLI) HandleTagCommand(args []string) error {
-	if len(args) < 3 {
-		return fmt.Errorf("usage: fart tag <file> <tag-value> [--taxonomy <taxonomy-name>]")
+	filePath, taxonomyName, tagValue, err := parseTagArgs(args)
+	if err != nil {
+		return err
 	}
+	return c.taxonomyManager.TagFile(filePath, taxonomyName, tagValue)
+}
 
-	filePath := args[1]
-	tagValue := args[2]
-	taxonomyName := "tags" // default taxonomy
+// HandleUntagCommand removes a tag from a file
+func (c *CLI) HandleUntagCommand(args []string) error {
+	filePath, taxonomyName, tagValue, err := parseTagArgs(args)
+	if err != nil {
+		return err
+	}
+	return c.taxonomyManager.UntagFile(filePath, taxonomyName, tagValue)
+}
 
-	// Check for taxonomy flag
-	for i := 3; i < len(args)-1; i++ {
-		if strings.HasPrefix(args[i], "--") {
-			name, err := parseTaxonomyFlag(args[i])
-			if err != nil {
-				return err
-			}
-			taxonomyName = name
-			tagValue = args[i+1]
-			break
-		}
+// parseTagArgs reads the file, taxonomy and tag value from the arguments of
+// the tag and untag commands
+func parseTagArgs(args []string) (filePath, taxonomyName, tagValue string, err error) {
+	usage := fmt.Errorf("usage: fart %[1]s <file> <tag-value> | fart %[1]s --<taxonomy-name> <tag-value> <file>", args[0])
+	if len(args) < 3 {
+		return "", "", "", usage
 	}
 
-	// Convert to absolute path if necessary
-	if !filepath.IsAbs(filePath) {
-		var err error
-		filePath, err = filepath.Abs(filePath)
+	taxonomyName = "tags" // default taxonomy
+
+	if strings.HasPrefix(args[1], "--") {
+		// fart tag --author "Jordan, Robert" books/eye-of-the-world.pdf
+		if len(args) < 4 {
+			return "", "", "", usage
+		}
+		taxonomyName, err = parseTaxonomyFlag(args[1])
 		if err != nil {
-			return fmt.Errorf("failed to get absolute path: %w", err)
+			return "", "", "", err
+		}
+		tagValue = args[2]
+		filePath = args[3]
+	} else {
+		filePath = args[1]
+		tagValue = args[2]
+
+		// Check for taxonomy flag
+		for i := 3; i < len(args)-1; i++ {
+			if strings.HasPrefix(args[i], "--") {
+				taxonomyName, err = parseTaxonomyFlag(args[i])
+				if err != nil {
+					return "", "", "", err
+				}
+				tagValue = args[i+1]
+				break
+			}
 		}
 	}
 
-	return c.taxonomyManager.TagFile(filePath, taxonomyName, tagValue)
+	filePath, err = archivePath(filePath)
+	if err != nil {
+		return "", "", "", err
+	}
+	return filePath, taxonomyName, tagValue, nil
 }
 
 // HandleSearchCommand processes search-related commands
 func (c *CLI) HandleSearchCommand(args []string) error {
-	if len(args) < 3 {
-		return fmt.Errorf("usage: fart search --<taxonomy-name> <tag-value>")
+	usage := fmt.Errorf("usage: fart search [<term>...] [--saved <name>] [--sort [-]<taxonomy-name>] [--save <name>] [--json] | fart search --list | fart search --forget <name>")
+	args, asJSON := hasFlag(args, "--json")
+	args, list := hasFlag(args, "--list")
+	args, save, err := stringFlag(args, "--save")
+	if err != nil {
+		return err
+	}
+	args, saved, err := stringFlag(args, "--saved")
+	if err != nil {
+		return err
+	}
+	args, forget, err := stringFlag(args, "--forget")
+	if err != nil {
+		return err
 	}
 
-	taxonomyFlag := args[1]
-	if !strings.HasPrefix(taxonomyFlag, "--") {
-		return fmt.Errorf("invalid taxonomy flag format: must start with --")
+	switch {
+	case list:
+		return c.printSavedSearches()
+	case forget != "":
+		return c.db.RemoveSavedSearch(forget)
 	}
 
-	taxonomyName := strings.TrimPrefix(taxonomyFlag, "--")
-	tagValue := args[2]
+	// Terms after a saved search narrow it down
+	terms := args[1:]
+	if saved != "" {
+		savedTerms, err := c.savedSearchTerms(saved)
+		if err != nil {
+			return err
+		}
+		terms = append(savedTerms, terms...)
+	}
+	if len(terms) == 0 {
+		return usage
+	}
 
-	files, err := c.taxonomyManager.SearchByTag(taxonomyName, tagValue)
+	q, err := query.Parse(terms)
 	if err != nil {
 		return err
 	}
 
+	if save != "" {
+		if !validSearchName(save) {
+			return fmt.Errorf("invalid search name %q: it names a directory in views, so it cannot contain / or ,", save)
+		}
+		if err := c.db.SaveSearch(save, query.Join(terms)); err != nil {
+			return err
+		}
+	}
+
+	files, err := c.taxonomyManager.Search(q)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return c.printFileRecords(files)
+	}
+
 	// Print results
 	for _, file := range files {
 		fmt.Println(file)
@@ -113,6 +239,35 @@ func (c *CLI) HandleSearchCommand(args []string) error {
 	return nil
 }
 
+// savedSearchTerms returns the terms of a saved search
+func (c *CLI) savedSearchTerms(name string) ([]string, error) {
+	search, err := c.db.GetSavedSearch(name)
+	if err != nil {
+		return nil, err
+	}
+	if search == "" {
+		return nil, fmt.Errorf("no saved search named %s", name)
+	}
+	return query.Split(search)
+}
+
+// printSavedSearches lists the saved searches
+func (c *CLI) printSavedSearches() error {
+	searches, err := c.db.GetSavedSearches()
+	if err != nil {
+		return err
+	}
+	for _, s := range searches {
+		fmt.Printf("%s: %s\n", s.Name, s.Query)
+	}
+	return nil
+}
+
+// validSearchName reports whether a name can be used for a saved search
+func validSearchName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\,`)
+}
+
 // HandleCheckCommand processes check-related commands
 func (c *CLI) HandleCheckCommand(args []string) error {
 	if len(args) < 2 {
@@ -165,6 +320,60 @@ func (c *CLI) checkSingleFile(filePath string) error {
 	return nil
 }
 
+// archivePath converts a file path into a path relative to the archive root,
+// which is the current directory
+func archivePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	root, err := filepath.Abs(".")
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the archive", path)
+	}
+	return relPath, nil
+}
+
+// hasFlag removes a boolean flag from the arguments, reporting whether it was present
+func hasFlag(args []string, flag string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// stringFlag removes a flag and its value from the arguments, returning the
+// value, or "" if the flag is not present
+func stringFlag(args []string, flag string) ([]string, string, error) {
+	var rest []string
+	value := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] != flag {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, "", fmt.Errorf("%s requires a value", flag)
+		}
+		i++
+		value = args[i]
+	}
+	return rest, value, nil
+}
+
 // Helper function to parse taxonomy flags
 func parseTaxonomyFlag(flag string) (string, error) {
 	if !strings.HasPrefix(flag, "--") {
@@ -177,10 +386,30 @@ func parseTaxonomyFlag(flag string) (string, error) {
 	return name, nil
 }
 
+// addOptions controls what happens to files as they are added
+type addOptions struct {
+	extract bool // extract embedded metadata
+	review  bool // confirm extracted metadata before storing it
+	members bool // index the members of zip and tar containers
+	rules   []rules.Rule
+}
+
 // HandleAddCommand processes add-related commands
 func (c *CLI) HandleAddCommand(args []string) error {
+	var opts addOptions
+	args, opts.extract = hasFlag(args, "--extract")
+	args, opts.review = hasFlag(args, "--review")
+	args, opts.members = hasFlag(args, "--members")
 	if len(args) < 2 {
-		return fmt.Errorf("usage: fart add <file|directory|pattern>")
+		return fmt.Errorf("usage: fart add [--extract [--review]] [--members] <file|directory|pattern>")
+	}
+	if opts.review && !opts.extract {
+		return fmt.Errorf("--review can only be used with --extract")
+	}
+
+	var err error
+	if opts.rules, err = rules.Load(rules.File); err != nil {
+		return err
 	}
 
 	for _, pattern := range args[1:] {
@@ -203,9 +432,9 @@ func (c *CLI) HandleAddCommand(args []string) error {
 			}
 
 			if info.IsDir() {
-				err = c.addDirectory(match)
+				err = c.addDirectory(match, opts)
 			} else {
-				err = c.addFile(match)
+				err = c.addFile(match, opts)
 			}
 
 			if err != nil {
@@ -218,22 +447,22 @@ func (c *CLI) HandleAddCommand(args []string) error {
 }
 
 // addFile adds a single file to the database
-func (c *CLI) addFile(path string) error {
+func (c *CLI) addFile(path string, opts addOptions) error {
 	fileInfo, err := fileops.GetFileInfo(path)
 	if err != nil {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
 	// Get relative path from current directory
-	relPath, err := filepath.Rel(".", filepath.Dir(path))
+	relPath, err := archivePath(path)
 	if err != nil {
-		return fmt.Errorf("failed to get relative path: %w", err)
+		return err
 	}
 
 	// Add file to database
 	err = c.db.AddFile(
-		filepath.Base(path),
-		relPath,
+		filepath.Base(relPath),
+		filepath.Dir(relPath),
 		fileInfo.Hash,
 		fileInfo.Size,
 		fileInfo.ModifiedAt,
@@ -243,22 +472,48 @@ func (c *CLI) addFile(path string) error {
 	}
 
 	fmt.Printf("Added %s\n", path)
+
+	if err := c.detectType(path, relPath); err != nil {
+		fmt.Printf("Warning: %s: %v\n", path, err)
+	}
+
+	if opts.members {
+		if err := c.indexMembers(path, relPath); err != nil {
+			fmt.Printf("Warning: %s: %v\n", path, err)
+		}
+	}
+
+	if changes, _ := ruleChanges(opts.rules, relPath); len(changes) > 0 {
+		if err := c.applyMetadata(relPath, changes); err != nil {
+			fmt.Printf("Warning: %s: %v\n", path, err)
+		}
+	}
+
+	if opts.extract {
+		mode := extractApply
+		if opts.review {
+			mode = extractReview
+		}
+		if err := c.extractFile(path, mode); err != nil {
+			fmt.Printf("Warning: %s: %v\n", path, err)
+		}
+	}
 	return nil
 }
 
 // addDirectory recursively adds all files in a directory
-func (c *CLI) addDirectory(path string) error {
+func (c *CLI) addDirectory(path string, opts addOptions) error {
 	return filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories and hidden files
-		if info.IsDir() || strings.HasPrefix(filepath.Base(filePath), ".") {
+		// Skip directories, hidden files and sidecars
+		if info.IsDir() || strings.HasPrefix(filepath.Base(filePath), ".") || sidecar.IsSidecar(filePath) {
 			return nil
 		}
 
-		return c.addFile(filePath)
+		return c.addFile(filePath, opts)
 	})
 }
 
@@ -285,7 +540,7 @@ func (c *CLI) HandleVerifyCommand(args []string) error {
             if err != nil {
                 return err
             }
-            if !info.IsDir() && !strings.HasPrefix(filepath.Base(path), ".") {
+            if !info.IsDir() && !strings.HasPrefix(filepath.Base(path), ".") && !sidecar.IsSidecar(path) {
                 matches = append(matches, path)
             }
             return nil
@@ -310,7 +565,8 @@ func (c *CLI) HandleVerifyCommand(args []string) error {
             continue
         }
 
-        if matchingPath == "" {
+        // A copy inside a container doesn't account for a file on disk
+        if matchingPath == "" || database.IsContainerMember(matchingPath) {
             fmt.Printf("New file: %s\n", filePath)
         } else if matchingPath != filePath {
             fmt.Printf("Moved/renamed: %s -> %s\n", matchingPath, filePath)
@@ -324,6 +580,9 @@ func (c *CLI) HandleVerifyCommand(args []string) error {
     }
 
     for _, dbFile := range dbFiles {
+        if database.IsContainerMember(dbFile) {
+            continue
+        }
         if _, err := os.Stat(dbFile); os.IsNotExist(err) {
             fmt.Printf("Missing file: %s\n", dbFile)
         }
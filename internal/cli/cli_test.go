@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-fart/internal/database"
+	"go-fart/internal/taxonomy"
+)
+
+// newTestCLI returns a CLI for a new archive in a temporary directory, which
+// is the working directory until the test ends
+func newTestCLI(t *testing.T) (*CLI, *database.DB) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db, err := database.New(filepath.Join(dir, ".fart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return New(taxonomy.New(db), db), db
+}
+
+// addTestFile writes a file into the archive and adds it to the database
+func addTestFile(t *testing.T, c *CLI, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleAddCommand([]string{"add", path}); err != nil {
+		t.Fatal(err)
+	}
+}
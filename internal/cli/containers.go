@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// indexMembers records the members of a zip or tar container in the archive
+// with their own hashes and types. Files that aren't containers are left
+// alone.
+func (c *CLI) indexMembers(path, filePath string) error {
+	members, err := fileops.ListContainer(path)
+	if errors.Is(err, fileops.ErrNotContainer) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	records := make([]database.Member, len(members))
+	for i, m := range members {
+		records[i] = database.Member{Name: m.Name, Hash: m.Hash, Size: m.Size, ModifiedAt: m.ModifiedAt}
+	}
+	if err := c.db.SetContainerMembers(filePath, records); err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		memberPath := database.MemberPath(filePath, m.Name)
+		if err := c.db.SetFileType(memberPath, m.Type.MIMEType, m.Type.Kind); err != nil {
+			return err
+		}
+		if err := c.taxonomyManager.TagFile(memberPath, database.TypeTaxonomy, m.Type.Kind); err != nil {
+			fmt.Printf("Warning: %s: %v\n", memberPath, err)
+		}
+	}
+
+	fmt.Printf("Indexed %d members of %s\n", len(members), path)
+	return nil
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go-fart/internal/database"
+)
+
+// csvHeader is the header row of CSV exports. Each row holds one tag or
+// property of a file, and files without either have a single row with an
+// empty field.
+var csvHeader = []string{"path", "hash", "size", "modified_at", "field", "value"}
+
+// jsonExport is the content of a JSON export
+type jsonExport struct {
+	Taxonomies []taxonomyExport       `json:"taxonomies"`
+	Files      []*database.FileRecord `json:"files"`
+}
+
+// taxonomyExport is a taxonomy in a JSON export, with its settings, the tags
+// registered in it and their aliases
+type taxonomyExport struct {
+	Name         string            `json:"name"`
+	SingleValued bool              `json:"single_valued"`
+	Closed       bool              `json:"closed"`
+	ValuePattern string            `json:"value_pattern,omitempty"`
+	ValueType    string            `json:"value_type"`
+	Vocabulary   []string          `json:"vocabulary"`
+	Aliases      map[string]string `json:"aliases,omitempty"` // alias to tag path
+}
+
+// HandleExportCommand writes every file in the archive with its tags and
+// properties as JSON or CSV, or as HTML pages, or copies the files themselves.
+// JSON exports also hold the taxonomies, while CSV only holds the files.
+func (c *CLI) HandleExportCommand(args []string) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case "html":
+			return c.exportHTML(args[2:])
+		case "files":
+			return c.exportFiles(args[2:])
+		}
+	}
+	usage := fmt.Errorf("usage: fart export [--format json|csv] [--output <file>] | fart export html <out-dir> [--thumbnails] | fart export files <term>... <dest-dir> [--flatten] [--database]")
+
+	args, format, err := stringFlag(args, "--format")
+	if err != nil {
+		return err
+	}
+	args, output, err := stringFlag(args, "--output")
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usage
+	}
+	if format == "" {
+		format = formatFromPath(output)
+	}
+
+	records, err := c.allFileRecords()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch format {
+	case "json":
+		var taxonomies []taxonomyExport
+		if taxonomies, err = c.taxonomyExports(); err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(jsonExport{Taxonomies: taxonomies, Files: records})
+	case "csv":
+		err = writeCSV(w, records)
+	default:
+		return usage
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	if output != "" {
+		fmt.Printf("Exported %d files to %s\n", len(records), output)
+	}
+	return nil
+}
+
+// formatFromPath picks an export format from a file's extension, defaulting
+// to JSON
+func formatFromPath(path string) string {
+	if filepath.Ext(path) == ".csv" {
+		return "csv"
+	}
+	return "json"
+}
+
+// taxonomyExports returns every taxonomy with its settings, vocabulary and
+// aliases
+func (c *CLI) taxonomyExports() ([]taxonomyExport, error) {
+	taxonomies, err := c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]taxonomyExport, 0, len(taxonomies))
+	for _, t := range taxonomies {
+		nodes, err := c.taxonomyManager.TagTree(t.Name)
+		if err != nil {
+			return nil, err
+		}
+		export := taxonomyExport{
+			Name:         t.Name,
+			SingleValued: t.SingleValued,
+			Closed:       t.Closed,
+			ValuePattern: t.ValuePattern,
+			ValueType:    t.ValueType,
+			Vocabulary:   []string{},
+			Aliases:      make(map[string]string),
+		}
+		paths := database.TagPaths(nodes)
+		for _, node := range nodes {
+			export.Vocabulary = append(export.Vocabulary, paths[node.ID])
+			for _, alias := range node.Aliases {
+				export.Aliases[alias] = paths[node.ID]
+			}
+		}
+		sort.Strings(export.Vocabulary)
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+// allFileRecords returns every file in the archive with its metadata, in
+// path order
+func (c *CLI) allFileRecords() ([]*database.FileRecord, error) {
+	files, err := c.db.GetAllFiles()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return c.db.GetFileRecords(files)
+}
+
+// writeCSV writes file records with one row per tag or property. Properties
+// are written with a `prop:` prefix on their name.
+func writeCSV(w io.Writer, records []*database.FileRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		file := []string{r.Path, r.Hash, strconv.FormatInt(r.Size, 10), r.ModifiedAt}
+		rows := 0
+
+		taxonomies := make([]string, 0, len(r.Tags))
+		for taxonomy := range r.Tags {
+			taxonomies = append(taxonomies, taxonomy)
+		}
+		sort.Strings(taxonomies)
+		for _, taxonomy := range taxonomies {
+			for _, tag := range r.Tags[taxonomy] {
+				if err := cw.Write(append(file, taxonomy, tag)); err != nil {
+					return err
+				}
+				rows++
+			}
+		}
+
+		names := make([]string, 0, len(r.Properties))
+		for name := range r.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := cw.Write(append(file, "prop:"+name, r.Properties[name])); err != nil {
+				return err
+			}
+			rows++
+		}
+
+		if rows == 0 {
+			if err := cw.Write(append(file, "", "")); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-fart/internal/database"
+)
+
+// tagTestArchive tags and sets properties on the files of a test archive
+func tagTestArchive(t *testing.T, c *CLI, db *database.DB) {
+	t.Helper()
+	addTestFile(t, c, "books/eye.txt", "The Eye of the World")
+	addTestFile(t, c, "books/hunt.txt", "The Great Hunt")
+
+	for _, tag := range []struct{ file, taxonomy, value string }{
+		{"books/eye.txt", "genre", "fiction/fantasy"},
+		{"books/eye.txt", "author", "Robert Jordan"},
+		{"books/hunt.txt", "genre", "fiction/fantasy"},
+	} {
+		if err := c.taxonomyManager.TagFile(tag.file, tag.taxonomy, tag.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetProperty("books/eye.txt", "isbn", "9780312850098"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			c, db := newTestCLI(t)
+			tagTestArchive(t, c, db)
+			export := filepath.Join(t.TempDir(), "export."+format)
+			if err := c.HandleExportCommand([]string{"export", "--output", export}); err != nil {
+				t.Fatal(err)
+			}
+			want, err := db.GetFileRecord("books/eye.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The files are found by their content in an archive where
+			// they have moved
+			c, db = newTestCLI(t)
+			addTestFile(t, c, "moved/eye.txt", "The Eye of the World")
+			addTestFile(t, c, "moved/hunt.txt", "The Great Hunt")
+			if err := c.HandleImportCommand([]string{"import", export}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := db.GetFileRecord("moved/eye.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Tags, want.Tags) {
+				t.Errorf("tags = %v, want %v", got.Tags, want.Tags)
+			}
+			if !reflect.DeepEqual(got.Properties, want.Properties) {
+				t.Errorf("properties = %v, want %v", got.Properties, want.Properties)
+			}
+		})
+	}
+}
+
+func TestExportImportTaxonomies(t *testing.T) {
+	c, db := newTestCLI(t)
+	tagTestArchive(t, c, db)
+	m := c.taxonomyManager
+	if err := m.InitTaxonomy("rating"); err != nil {
+		t.Fatal(err)
+	}
+	rating := database.Taxonomy{Name: "rating", SingleValued: true, Closed: true, ValueType: database.TypeInt}
+	if err := m.ConfigureTaxonomy(rating); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"1", "2", "3"} {
+		if err := m.RegisterTag("rating", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.AddAlias("author", "Jordan, Robert", "Robert Jordan"); err != nil {
+		t.Fatal(err)
+	}
+	export := filepath.Join(t.TempDir(), "export.json")
+	if err := c.HandleExportCommand([]string{"export", "--output", export}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, db = newTestCLI(t)
+	if err := c.HandleImportCommand([]string{"import", export}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetTaxonomy("rating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SingleValued != rating.SingleValued || got.Closed != rating.Closed || got.ValueType != rating.ValueType {
+		t.Errorf("rating = %+v, want %+v", got, rating)
+	}
+	nodes, err := db.GetTagTree("rating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("rating has %d tags, want 3", len(nodes))
+	}
+	nodes, err = db.GetTagTree("author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || !reflect.DeepEqual(nodes[0].Aliases, []string{"Jordan, Robert"}) {
+		t.Errorf("author tags = %+v, want Robert Jordan aliased as Jordan, Robert", nodes)
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	c, db := newTestCLI(t)
+	tagTestArchive(t, c, db)
+	export := filepath.Join(t.TempDir(), "export.json")
+	if err := c.HandleExportCommand([]string{"export", "--output", export}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{"merge", []string{"fiction/fantasy", "fiction/science"}},
+		{"replace", []string{"fiction/fantasy"}},
+		{"skip", []string{"fiction/science"}},
+	}
+	for _, tt := range tests {
+		c, db := newTestCLI(t)
+		addTestFile(t, c, "books/eye.txt", "The Eye of the World")
+		if err := c.taxonomyManager.TagFile("books/eye.txt", "genre", "fiction/science"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.HandleImportCommand([]string{"import", "--policy", tt.policy, export}); err != nil {
+			t.Fatal(err)
+		}
+
+		record, err := db.GetFileRecord("books/eye.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := record.Tags["genre"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("--policy %s: genre = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestImportUnknownFormat(t *testing.T) {
+	c, _ := newTestCLI(t)
+	if err := os.WriteFile("export.txt", []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleImportCommand([]string{"import", "--format", "xml", "export.txt"}); err == nil {
+		t.Error("import --format xml succeeded, want an error")
+	}
+}
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// defaultFieldMappings apply to extracted fields without a stored mapping.
+// Any other field is stored as a property named after the field without its
+// prefix, so `exif.lens` becomes the property `lens`.
+var defaultFieldMappings = map[string]database.FieldMapping{
+	"exif.camera": {Field: "exif.camera", Taxonomy: "camera"},
+	"exif.year":   {Field: "exif.year", Taxonomy: "year"},
+
+	"audio.artist": {Field: "audio.artist", Taxonomy: "artist"},
+	"audio.album":  {Field: "audio.album", Taxonomy: "album"},
+	"audio.genre":  {Field: "audio.genre", Taxonomy: "genre"},
+	"audio.year":   {Field: "audio.year", Taxonomy: "year"},
+
+	"doc.author": {Field: "doc.author", Taxonomy: "author"},
+	"doc.series": {Field: "doc.series", Taxonomy: "series"},
+}
+
+// extractMode controls whether extracted metadata is stored
+type extractMode int
+
+const (
+	extractApply  extractMode = iota // store the metadata
+	extractDryRun                    // only show what would be stored
+	extractReview                    // show the metadata and ask before storing it
+)
+
+// stdin reads answers to questions asked while reviewing
+var stdin = bufio.NewReader(os.Stdin)
+
+// metadataChange is an extracted value along with where it will be stored
+type metadataChange struct {
+	Field    string
+	Taxonomy string
+	Property string
+	Value    string
+}
+
+// String describes the change for the user
+func (m metadataChange) String() string {
+	if m.Taxonomy != "" {
+		return fmt.Sprintf("tag --%s %q", m.Taxonomy, m.Value)
+	}
+	return fmt.Sprintf("set %s=%q", m.Property, m.Value)
+}
+
+// HandleExtractCommand reads embedded metadata from files already in the
+// archive, and manages where extracted fields are stored
+func (c *CLI) HandleExtractCommand(args []string) error {
+	usage := fmt.Errorf("usage: fart extract [--dry-run|--review] <file|directory|pattern>... | fart extract <map|unmap|mappings> [arguments]")
+	if len(args) < 2 {
+		return usage
+	}
+
+	switch args[1] {
+	case "map":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: fart extract map <field> <--taxonomy-name|prop:name|--ignore>")
+		}
+		m := database.FieldMapping{Field: args[2]}
+		switch target := args[3]; {
+		case target == "--ignore":
+		case strings.HasPrefix(target, "prop:"):
+			m.Property = strings.TrimPrefix(target, "prop:")
+			if m.Property == "" {
+				return fmt.Errorf("property name cannot be empty")
+			}
+		default:
+			taxonomyName, err := parseTaxonomyFlag(target)
+			if err != nil {
+				return err
+			}
+			m.Taxonomy = strings.ToLower(taxonomyName)
+		}
+		return c.db.SetFieldMapping(m)
+
+	case "unmap":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: fart extract unmap <field>")
+		}
+		return c.db.RemoveFieldMapping(args[2])
+
+	case "mappings":
+		return c.printFieldMappings()
+	}
+
+	args, dryRun := hasFlag(args, "--dry-run")
+	args, review := hasFlag(args, "--review")
+	if len(args) < 2 || (dryRun && review) {
+		return usage
+	}
+
+	mode := extractApply
+	switch {
+	case dryRun:
+		mode = extractDryRun
+	case review:
+		mode = extractReview
+	}
+
+	files, err := collectFiles(args[1:])
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := c.extractFile(file, mode); err != nil {
+			fmt.Printf("Warning: %s: %v\n", file, err)
+		}
+	}
+	return nil
+}
+
+// extractFile extracts the metadata of a file in the archive and stores it
+func (c *CLI) extractFile(path string, mode extractMode) error {
+	filePath, err := archivePath(path)
+	if err != nil {
+		return err
+	}
+
+	md, err := fileops.ExtractMetadata(path)
+	if err != nil {
+		return fmt.Errorf("failed to extract metadata: %w", err)
+	}
+
+	changes, err := c.proposeMetadata(md)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case extractDryRun:
+		for _, change := range changes {
+			fmt.Printf("%s: would %s\n", filePath, change)
+		}
+		return nil
+	case extractReview:
+		if len(changes) == 0 {
+			return nil
+		}
+		fmt.Printf("%s:\n", filePath)
+		for _, change := range changes {
+			fmt.Printf("  %s\n", change)
+		}
+		ok, err := confirm("Apply these changes?")
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return c.applyMetadata(filePath, changes)
+}
+
+// confirm asks a yes or no question, defaulting to no
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false, fmt.Errorf("no answer given")
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// proposeMetadata works out where each extracted value is stored
+func (c *CLI) proposeMetadata(md fileops.Metadata) ([]metadataChange, error) {
+	if len(md) == 0 {
+		return nil, nil
+	}
+
+	stored, err := c.db.GetFieldMappings()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []metadataChange
+	for _, field := range md.Fields() {
+		m := fieldMapping(field, stored)
+		switch {
+		case m.Taxonomy != "":
+			// Extracted values are never hierarchical
+			for _, value := range md[field] {
+				changes = append(changes, metadataChange{Field: field, Taxonomy: m.Taxonomy, Value: database.EscapeTagName(value)})
+			}
+		case m.Property != "":
+			changes = append(changes, metadataChange{Field: field, Property: m.Property, Value: strings.Join(md[field], "; ")})
+		}
+	}
+	return changes, nil
+}
+
+// applyMetadata stores extracted values, reporting values that a taxonomy
+// rejects without stopping
+func (c *CLI) applyMetadata(filePath string, changes []metadataChange) error {
+	for _, change := range changes {
+		var err error
+		if change.Taxonomy != "" {
+			err = c.taxonomyManager.TagFile(filePath, change.Taxonomy, change.Value)
+		} else {
+			err = c.db.SetProperty(filePath, change.Property, change.Value)
+		}
+
+		if err != nil {
+			fmt.Printf("Warning: %s: cannot %s: %v\n", filePath, change, err)
+			continue
+		}
+		fmt.Printf("%s: %s\n", filePath, change)
+	}
+	return nil
+}
+
+// fieldMapping returns where a field is stored: its stored mapping, its
+// default mapping, or a property named after the field
+func fieldMapping(field string, stored map[string]database.FieldMapping) database.FieldMapping {
+	if m, ok := stored[field]; ok {
+		return m
+	}
+	if m, ok := defaultFieldMappings[field]; ok {
+		return m
+	}
+	_, name, ok := strings.Cut(field, ".")
+	if !ok {
+		name = field
+	}
+	return database.FieldMapping{Field: field, Property: name}
+}
+
+// printFieldMappings lists the default and stored field mappings
+func (c *CLI) printFieldMappings() error {
+	stored, err := c.db.GetFieldMappings()
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]bool)
+	for field := range defaultFieldMappings {
+		fields[field] = true
+	}
+	for field := range stored {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		m := fieldMapping(field, stored)
+		switch {
+		case m.Taxonomy != "":
+			fmt.Printf("%s -> --%s\n", field, m.Taxonomy)
+		case m.Property != "":
+			fmt.Printf("%s -> prop:%s\n", field, m.Property)
+		default:
+			fmt.Printf("%s -> ignored\n", field)
+		}
+	}
+	fmt.Println("other fields -> prop:<field name without its prefix>")
+	return nil
+}
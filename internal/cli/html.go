@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+
+	"go-fart/internal/catalogue"
+	"go-fart/internal/database"
+)
+
+// exportHTML writes a catalogue of the archive as static HTML pages, which
+// can be opened from the disk or put on any web server
+func (c *CLI) exportHTML(args []string) error {
+	args, thumbnails := hasFlag(args, "--thumbnails")
+	if len(args) != 1 {
+		return fmt.Errorf("usage: fart export html <out-dir> [--thumbnails]")
+	}
+	dir := args[0]
+	if _, err := archivePath(dir); err == nil {
+		return fmt.Errorf("the output directory %s must be outside the archive", dir)
+	}
+
+	taxonomies, err := c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return err
+	}
+	all, err := c.allFileRecords()
+	if err != nil {
+		return err
+	}
+	// Files marked missing have nothing to link to
+	var records []*database.FileRecord
+	for _, record := range all {
+		if record.MissingAt == "" {
+			records = append(records, record)
+		}
+	}
+	stats, err := catalogue.Write(dir, taxonomies, records, catalogue.Options{Thumbnails: thumbnails})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d files to %s: %d pages", stats.Files, dir, stats.Pages)
+	if thumbnails {
+		fmt.Printf(", %d thumbnails", stats.Thumbnails)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// Import policies decide what happens to files that already have metadata
+const (
+	policyMerge   = "merge"   // add the imported tags and properties
+	policyReplace = "replace" // replace the file's tags and properties
+	policySkip    = "skip"    // leave files that already have metadata alone
+)
+
+// importStats counts what happened to the records of an import
+type importStats struct {
+	byHash, byPath, unmatched, skipped int
+}
+
+// HandleImportCommand applies tags and properties from a JSON or CSV export
+// to the files in the archive. Files are matched by hash first and path
+// second, so an export still applies after the archive was reorganised.
+func (c *CLI) HandleImportCommand(args []string) error {
+	usage := fmt.Errorf("usage: fart import [--policy merge|replace|skip] [--format json|csv] <file> | fart import tmsu [--policy merge|replace|skip] <database> | fart import calibre <library-dir>")
+
+	args, policy, err := stringFlag(args, "--policy")
+	if err != nil {
+		return err
+	}
+	args, format, err := stringFlag(args, "--format")
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 && args[1] == "calibre" && policy == "" && format == "" {
+		return c.importCalibre(args[2])
+	}
+	switch policy {
+	case "":
+		policy = policyMerge
+	case policyMerge, policyReplace, policySkip:
+	default:
+		return usage
+	}
+	if len(args) == 3 && args[1] == "tmsu" && format == "" {
+		return c.importTMSU(args[2], policy)
+	}
+	if len(args) != 2 {
+		return usage
+	}
+	if format == "" {
+		format = formatFromPath(args[1])
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", args[1], err)
+	}
+	defer file.Close()
+
+	var export jsonExport
+	switch format {
+	case "json":
+		export, err = readJSONExport(file)
+	case "csv":
+		export.Files, err = readCSV(file)
+	default:
+		return usage
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[1], err)
+	}
+
+	if err := c.importTaxonomies(export.Taxonomies); err != nil {
+		return err
+	}
+	var stats importStats
+	for _, record := range export.Files {
+		c.importRecord(record, policy, &stats)
+	}
+
+	stats.print()
+	return nil
+}
+
+// readJSONExport reads a JSON export. Exports made before taxonomies were
+// exported are a list of files.
+func readJSONExport(r io.Reader) (jsonExport, error) {
+	var export jsonExport
+	var data json.RawMessage
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return export, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(data, &export.Files)
+		return export, err
+	}
+	err := json.Unmarshal(data, &export)
+	return export, err
+}
+
+// importTaxonomies creates the taxonomies of an export and gives them its
+// settings, vocabulary and aliases, before any file is tagged
+func (c *CLI) importTaxonomies(exports []taxonomyExport) error {
+	if len(exports) == 0 {
+		return nil
+	}
+	taxonomies, err := c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, t := range taxonomies {
+		existing[t.Name] = true
+	}
+
+	for _, export := range exports {
+		if !existing[export.Name] {
+			if err := c.taxonomyManager.InitTaxonomy(export.Name); err != nil {
+				return err
+			}
+		}
+		t := database.Taxonomy{
+			Name:         export.Name,
+			SingleValued: export.SingleValued,
+			Closed:       export.Closed,
+			ValuePattern: export.ValuePattern,
+			ValueType:    export.ValueType,
+		}
+		if t.ValueType == "" {
+			t.ValueType = database.TypeText
+		}
+		if err := c.taxonomyManager.ConfigureTaxonomy(t); err != nil {
+			fmt.Printf("Warning: cannot configure %s: %v\n", export.Name, err)
+		}
+		for _, tag := range export.Vocabulary {
+			if err := c.taxonomyManager.RegisterTag(export.Name, tag); err != nil {
+				fmt.Printf("Warning: cannot register %s tag %q: %v\n", export.Name, tag, err)
+			}
+		}
+		aliases := make([]string, 0, len(export.Aliases))
+		for alias := range export.Aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			if err := c.taxonomyManager.AddAlias(export.Name, alias, export.Aliases[alias]); err != nil {
+				fmt.Printf("Warning: cannot alias %q to %s tag %q: %v\n", alias, export.Name, export.Aliases[alias], err)
+			}
+		}
+	}
+	fmt.Printf("Imported %d taxonomies\n", len(exports))
+	return nil
+}
+
+// print summarises an import
+func (s importStats) print() {
+	fmt.Printf("Imported %d files (%d matched by hash, %d by path), %d skipped, %d not found\n",
+		s.byHash+s.byPath-s.skipped, s.byHash, s.byPath, s.skipped, s.unmatched)
+}
+
+// importRecord applies the metadata of a record to the file it matches
+func (c *CLI) importRecord(record *database.FileRecord, policy string, stats *importStats) {
+	target, err := c.matchRecord(record, stats)
+	if err != nil {
+		fmt.Printf("Warning: %s: %v\n", record.Path, err)
+		return
+	}
+	if target == "" {
+		fmt.Printf("Warning: no file matches %s\n", record.Path)
+		stats.unmatched++
+		return
+	}
+	c.applyRecord(target, record, policy, stats)
+}
+
+// applyRecord applies the metadata of a record to a file according to the
+// import policy
+func (c *CLI) applyRecord(target string, record *database.FileRecord, policy string, stats *importStats) {
+	switch policy {
+	case policySkip:
+		current, err := c.db.GetFileRecord(target)
+		if err != nil {
+			fmt.Printf("Warning: %s: %v\n", target, err)
+			return
+		}
+		if hasMetadata(current) {
+			stats.skipped++
+			return
+		}
+	case policyReplace:
+		if err := c.db.ClearFileMetadata(target); err != nil {
+			fmt.Printf("Warning: %s: %v\n", target, err)
+			return
+		}
+	}
+
+	for taxonomy, tags := range record.Tags {
+		for _, tag := range tags {
+			if err := c.taxonomyManager.TagFile(target, taxonomy, tag); err != nil {
+				fmt.Printf("Warning: %s: cannot tag --%s %q: %v\n", target, taxonomy, tag, err)
+			}
+		}
+	}
+	for name, value := range record.Properties {
+		if err := c.db.SetProperty(target, name, value); err != nil {
+			fmt.Printf("Warning: %s: cannot set %s: %v\n", target, name, err)
+		}
+	}
+}
+
+// matchRecord finds the file in the archive that a record describes: the
+// file at its path if the content is unchanged, any file with its hash, or
+// failing that the file at its path. It returns "" if none matches.
+func (c *CLI) matchRecord(record *database.FileRecord, stats *importStats) (string, error) {
+	current, err := c.db.GetFileRecord(record.Path)
+	if err == nil && current.Hash == record.Hash {
+		stats.byHash++
+		return current.Path, nil
+	}
+
+	if record.Hash != "" {
+		path, err := c.db.GetFilePathByHash(record.Hash)
+		if err != nil {
+			return "", err
+		}
+		if path != "" {
+			stats.byHash++
+			return path, nil
+		}
+	}
+
+	if current != nil {
+		stats.byPath++
+		return current.Path, nil
+	}
+	return "", nil
+}
+
+// hasMetadata reports whether a file has any tags or properties besides the
+// detected type
+func hasMetadata(record *database.FileRecord) bool {
+	for taxonomy, tags := range record.Tags {
+		if taxonomy != database.TypeTaxonomy && len(tags) > 0 {
+			return true
+		}
+	}
+	return len(record.Properties) > 0
+}
+
+// readCSV reads file records from a CSV export
+func readCSV(r io.Reader) ([]*database.FileRecord, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("expected the columns %s", strings.Join(csvHeader, ","))
+	}
+
+	var records []*database.FileRecord
+	byPath := make(map[string]*database.FileRecord)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		path, field, value := row[0], row[4], row[5]
+		record, ok := byPath[path]
+		if !ok {
+			size, err := strconv.ParseInt(row[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size for %s: %w", path, err)
+			}
+			record = &database.FileRecord{
+				Path:       path,
+				Hash:       row[1],
+				Size:       size,
+				ModifiedAt: row[3],
+				Tags:       make(map[string][]string),
+				Properties: make(map[string]string),
+			}
+			byPath[path] = record
+			records = append(records, record)
+		}
+
+		switch {
+		case field == "":
+		case strings.HasPrefix(field, "prop:"):
+			record.Properties[strings.TrimPrefix(field, "prop:")] = value
+		default:
+			record.Tags[field] = append(record.Tags[field], value)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// HandleSetCommand sets properties of a file: fart set <file> <name>=<value>...
+func (c *CLI) HandleSetCommand(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: fart set <file> <name>=<value>...")
+	}
+
+	filePath, err := archivePath(args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, assignment := range args[2:] {
+		name, value, ok := strings.Cut(assignment, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid property %q: expected <name>=<value>", assignment)
+		}
+		if err := c.db.SetProperty(filePath, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleGetCommand prints properties of a file: fart get <file> [name] [--json]
+func (c *CLI) HandleGetCommand(args []string) error {
+	args, asJSON := hasFlag(args, "--json")
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("usage: fart get <file> [name] [--json]")
+	}
+
+	filePath, err := archivePath(args[1])
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return c.printFileRecords([]string{filePath})
+	}
+
+	properties, err := c.db.GetProperties(filePath)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 3 {
+		value, ok := properties[args[2]]
+		if !ok {
+			return fmt.Errorf("%s has no property %s", filePath, args[2])
+		}
+		fmt.Println(value)
+		return nil
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s=%s\n", name, properties[name])
+	}
+	return nil
+}
+
+// HandleUnsetCommand removes properties from a file: fart unset <file> <name>...
+func (c *CLI) HandleUnsetCommand(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: fart unset <file> <name>...")
+	}
+
+	filePath, err := archivePath(args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args[2:] {
+		if err := c.db.UnsetProperty(filePath, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printFileRecords prints files with their tags and properties as JSON
+func (c *CLI) printFileRecords(files []string) error {
+	records := make([]*database.FileRecord, 0, len(files))
+	for _, file := range files {
+		record, err := c.db.GetFileRecord(file)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go-fart/internal/server"
+)
+
+// defaultServeAddr is where fart serve listens unless told otherwise
+const defaultServeAddr = "localhost:8750"
+
+// tokenEnv holds the server's token, so that it needn't be on the command line
+const tokenEnv = "FART_TOKEN"
+
+// HandleServeCommand serves the archive over HTTP
+func (c *CLI) HandleServeCommand(args []string) error {
+	args, addr, err := stringFlag(args, "--addr")
+	if err != nil {
+		return err
+	}
+	args, token, err := stringFlag(args, "--token")
+	if err != nil {
+		return err
+	}
+	args, webdav := hasFlag(args, "--webdav")
+	args, opds := hasFlag(args, "--opds")
+	if len(args) != 1 || webdav && opds {
+		return fmt.Errorf("usage: fart serve [--webdav | --opds] [--addr <host:port>] [--token <token>]")
+	}
+	if addr == "" {
+		addr = defaultServeAddr
+	}
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           server.New(c.taxonomyManager, c.db, token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if webdav {
+		srv.Handler = server.NewWebDAV(c.taxonomyManager, c.db, token)
+	} else if opds {
+		srv.Handler = server.NewOPDS(c.taxonomyManager, c.db, token)
+	}
+	srv.Handler = server.SameSite(addr, srv.Handler)
+
+	if token == "" && !server.IsLoopback(addr) {
+		if webdav || opds {
+			fmt.Printf("Warning: serving on %s without a token, so anyone who can reach it can read the files\n", addr)
+		} else {
+			fmt.Printf("Warning: serving on %s without a token, so anyone who can reach it can change tags\n", addr)
+		}
+	}
+	if webdav {
+		fmt.Printf("Serving the archive over WebDAV on http://%s/\n", addr)
+	} else if opds {
+		fmt.Printf("Serving the archive's books as an OPDS catalogue on http://%s/\n", addr)
+	} else {
+		fmt.Printf("Serving the archive on http://%s/\n", addr)
+	}
+	return srv.ListenAndServe()
+}
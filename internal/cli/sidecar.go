@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/query"
+	"go-fart/internal/sidecar"
+)
+
+// Taxonomies that have their own XMP properties rather than keywords
+const (
+	creatorTaxonomy = "author" // dc:creator
+	ratingTaxonomy  = "rating" // xmp:Rating
+)
+
+// HandleSidecarCommand writes the tags and properties of files to sidecars
+// next to them, or reads sidecars back into the database
+func (c *CLI) HandleSidecarCommand(args []string) error {
+	usage := fmt.Errorf("usage: fart sidecar write [--json] [<file|directory|pattern>...] | fart sidecar read [--sync] [<file|directory|pattern>...]")
+	if len(args) < 2 {
+		return usage
+	}
+
+	switch args[1] {
+	case "write":
+		args, asJSON := hasFlag(args[2:], "--json")
+		files, err := c.looseFiles(args)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := c.writeSidecar(file, asJSON); err != nil {
+				fmt.Printf("Warning: %s: %v\n", file, err)
+			}
+		}
+		return nil
+
+	case "read":
+		args, sync := hasFlag(args[2:], "--sync")
+		files, err := c.looseFiles(args)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := c.readSidecars(file); err != nil {
+				fmt.Printf("Warning: %s: %v\n", file, err)
+				continue
+			}
+			if sync {
+				if err := c.writeSidecar(file, false); err != nil {
+					fmt.Printf("Warning: %s: %v\n", file, err)
+				}
+			}
+		}
+		return nil
+	}
+	return usage
+}
+
+// looseFiles returns the archive paths of the given files, or of every file
+// in the database, leaving out container members and sidecars
+func (c *CLI) looseFiles(patterns []string) ([]string, error) {
+	var files []string
+	if len(patterns) == 0 {
+		all, err := c.db.GetAllFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range all {
+			files = append(files, filepath.Clean(file))
+		}
+		sort.Strings(files)
+	} else {
+		paths, err := collectFiles(patterns)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			filePath, err := archivePath(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filePath)
+		}
+	}
+
+	var result []string
+	for _, file := range files {
+		if !database.IsContainerMember(file) && !sidecar.IsSidecar(file) {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// writeSidecar writes an XMP sidecar for an image, or a JSON sidecar for
+// any other file or when asJSON is set. Files without tags or properties
+// are skipped, as are XMP sidecars written by other applications.
+func (c *CLI) writeSidecar(filePath string, asJSON bool) error {
+	record, err := c.db.GetFileRecord(filePath)
+	if err != nil {
+		return err
+	}
+	if !hasMetadata(record) {
+		return nil
+	}
+
+	t, err := fileops.DetectFileType(filePath)
+	if err != nil {
+		return err
+	}
+	if asJSON || t.Kind != fileops.KindImage {
+		path := sidecar.JSONPath(filePath)
+		if err := sidecar.WriteJSON(path, record); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", path)
+		return nil
+	}
+
+	path := sidecar.XMPPath(filePath)
+	ours, err := sidecar.WrittenByFART(path)
+	if err != nil {
+		return err
+	}
+	if !ours {
+		fmt.Printf("Warning: not replacing %s, which was written by another application\n", path)
+		return nil
+	}
+	if err := sidecar.WriteXMP(path, recordXMP(record)); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
+
+// recordXMP converts a file's tags into XMP. Authors become creators, the
+// rating taxonomy the rating, and other tags hierarchical keywords prefixed
+// with their taxonomy unless they are in the default taxonomy. The title is
+// the only property XMP sidecars hold.
+func recordXMP(record *database.FileRecord) *sidecar.XMP {
+	x := &sidecar.XMP{Title: record.Properties["title"]}
+
+	taxonomies := make([]string, 0, len(record.Tags))
+	for taxonomy := range record.Tags {
+		taxonomies = append(taxonomies, taxonomy)
+	}
+	sort.Strings(taxonomies)
+
+	for _, taxonomy := range taxonomies {
+		for _, tag := range record.Tags[taxonomy] {
+			levels := database.SplitTagPath(tag)
+			switch taxonomy {
+			case database.TypeTaxonomy:
+			case creatorTaxonomy:
+				x.Creators = append(x.Creators, levels[len(levels)-1])
+			case ratingTaxonomy:
+				x.Rating = tag
+			default:
+				if taxonomy != query.DefaultField {
+					levels = append([]string{taxonomy}, levels...)
+				}
+				x.Subjects = append(x.Subjects, levels[len(levels)-1])
+				x.Hierarchical = append(x.Hierarchical, levels)
+			}
+		}
+	}
+	return x
+}
+
+// readSidecars applies the tags and properties of a file's sidecars
+func (c *CLI) readSidecars(filePath string) error {
+	var changes []metadataChange
+
+	if path := sidecar.JSONPath(filePath); fileExists(path) {
+		record, err := sidecar.ReadJSON(path)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, recordChanges(record)...)
+	}
+
+	for _, path := range sidecar.XMPPaths(filePath) {
+		if !fileExists(path) {
+			continue
+		}
+		x, err := sidecar.ReadXMP(path)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, c.xmpChanges(x)...)
+	}
+
+	return c.applyMetadata(filePath, changes)
+}
+
+// recordChanges lists the tags and properties of a JSON sidecar. The type
+// taxonomy is left out, since types are detected rather than assigned.
+func recordChanges(record *database.FileRecord) []metadataChange {
+	var changes []metadataChange
+	for taxonomy, tags := range record.Tags {
+		if taxonomy == database.TypeTaxonomy {
+			continue
+		}
+		for _, tag := range tags {
+			changes = append(changes, metadataChange{Taxonomy: taxonomy, Value: tag})
+		}
+	}
+	for name, value := range record.Properties {
+		changes = append(changes, metadataChange{Property: name, Value: value})
+	}
+	return changes
+}
+
+// xmpChanges lists the tags and properties of an XMP sidecar. A hierarchical
+// keyword whose first level names a taxonomy is a tag of that taxonomy, and
+// any other keyword is a tag of the default taxonomy.
+func (c *CLI) xmpChanges(x *sidecar.XMP) []metadataChange {
+	var changes []metadataChange
+	for _, creator := range x.Creators {
+		changes = append(changes, metadataChange{Taxonomy: creatorTaxonomy, Value: database.EscapeTagName(creator)})
+	}
+	if x.Rating != "" {
+		changes = append(changes, metadataChange{Taxonomy: ratingTaxonomy, Value: x.Rating})
+	}
+	if x.Title != "" {
+		changes = append(changes, metadataChange{Property: "title", Value: x.Title})
+	}
+
+	leaves := make(map[string]bool)
+	for _, levels := range x.Hierarchical {
+		leaves[levels[len(levels)-1]] = true
+
+		taxonomy := query.DefaultField
+		if len(levels) > 1 && levels[0] != query.DefaultField {
+			if _, err := c.taxonomyManager.Taxonomy(strings.ToLower(levels[0])); err == nil {
+				taxonomy, levels = strings.ToLower(levels[0]), levels[1:]
+			}
+		}
+
+		escaped := make([]string, len(levels))
+		for i, level := range levels {
+			escaped[i] = database.EscapeTagName(level)
+		}
+		changes = append(changes, metadataChange{Taxonomy: taxonomy, Value: strings.Join(escaped, database.TagPathSeparator)})
+	}
+
+	// Flat keywords are usually repeated as the last level of a
+	// hierarchical one
+	for _, subject := range x.Subjects {
+		if !leaves[subject] {
+			changes = append(changes, metadataChange{Taxonomy: query.DefaultField, Value: database.EscapeTagName(subject)})
+		}
+	}
+	return changes
+}
+
+// fileExists reports whether a regular file exists at a path
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
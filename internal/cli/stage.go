@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// HandleStageCommand sets the stage directory, where new files wait before
+// they are added, or shows it
+func (c *CLI) HandleStageCommand(args []string) error {
+	switch len(args) {
+	case 1:
+		stage, err := c.db.GetStageDirectory()
+		if err != nil {
+			return err
+		}
+		if stage == "" {
+			fmt.Println("No stage directory is set")
+		} else {
+			fmt.Println(stage)
+		}
+		return nil
+	case 2:
+	default:
+		return fmt.Errorf("usage: fart stage [<directory>]")
+	}
+
+	info, err := os.Stat(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to access path: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[1])
+	}
+
+	// The stage is usually outside the archive, so it is stored absolute
+	stage, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if err := c.db.SetStageDirectory(stage); err != nil {
+		return err
+	}
+	fmt.Printf("Set the stage directory to %s\n", stage)
+	return nil
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/query"
+)
+
+// partSuffix marks a copy that is still being written. An interrupted copy
+// leaves it behind, and the next export carries on from where it stopped.
+const partSuffix = ".part"
+
+// subsetCopy is a file copied to the destination of an export
+type subsetCopy struct {
+	record *database.FileRecord
+	path   string // relative to the destination
+}
+
+// exportFiles copies the files matching a search to another directory, such
+// as a removable drive, optionally with a database of their tags
+func (c *CLI) exportFiles(args []string) error {
+	usage := fmt.Errorf("usage: fart export files <term>... <dest-dir> [--flatten] [--database]")
+	args, flatten := hasFlag(args, "--flatten")
+	args, withDatabase := hasFlag(args, "--database")
+	if len(args) < 2 {
+		return usage
+	}
+	terms, dest := args[:len(args)-1], args[len(args)-1]
+	if _, err := archivePath(dest); err == nil {
+		return fmt.Errorf("the destination %s must be outside the archive", dest)
+	}
+
+	q, err := query.Parse(terms)
+	if err != nil {
+		return err
+	}
+	files, err := c.taxonomyManager.Search(q)
+	if err != nil {
+		return err
+	}
+	for i, file := range files {
+		files[i] = filepath.Clean(file)
+	}
+	sort.Strings(files)
+
+	var copies []subsetCopy
+	used := make(map[string]bool)
+	for _, file := range files {
+		if database.IsContainerMember(file) {
+			fmt.Printf("Warning: skipping %s, it is inside a container\n", file)
+			continue
+		}
+		record, err := c.db.GetFileRecord(file)
+		if err != nil {
+			return err
+		}
+		if record.MissingAt != "" {
+			fmt.Printf("Warning: skipping %s, it is missing\n", file)
+			continue
+		}
+		path := file
+		if flatten {
+			path = fileops.UniqueName(filepath.Base(file), used)
+		}
+		copies = append(copies, subsetCopy{record: record, path: path})
+	}
+
+	var copied, present, failed int
+	var size int64
+	var done []subsetCopy
+	for _, cp := range copies {
+		wrote, err := copyVerified(cp.record.Path, filepath.Join(dest, cp.path), cp.record.Hash)
+		if err != nil {
+			fmt.Printf("Warning: %s: %v\n", cp.record.Path, err)
+			failed++
+			continue
+		}
+		if wrote {
+			fmt.Printf("Copied %s\n", cp.record.Path)
+			copied++
+			size += cp.record.Size
+		} else {
+			present++
+		}
+		done = append(done, cp)
+	}
+
+	if withDatabase && len(done) > 0 {
+		if err := c.writeSubsetDatabase(dest, done); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Copied %d files (%d bytes) to %s", copied, size, dest)
+	if present > 0 {
+		fmt.Printf(", %d were already there", present)
+	}
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be copied", failed)
+	}
+	return nil
+}
+
+// copyVerified copies src to dest unless dest already has the content, and
+// checks that the copy has the expected hash. The copy is written to a
+// .part file, resuming any left by an earlier copy, and renamed into place
+// once it is verified. The result is false if dest was already there.
+func copyVerified(src, dest, hash string) (bool, error) {
+	if _, err := os.Stat(dest); err == nil {
+		existing, err := fileops.CalculateFileHash(dest)
+		if err != nil {
+			return false, err
+		}
+		if existing != hash {
+			return false, fmt.Errorf("%s already exists with different content", dest)
+		}
+		return false, nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to access file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	part := dest + partSuffix
+	resumed, err := copyPart(src, part, info.Size())
+	if err != nil {
+		return false, err
+	}
+	written, err := fileops.CalculateFileHash(part)
+	if err != nil {
+		return false, err
+	}
+	if written != hash && resumed {
+		// The interrupted copy may have been of an older version of the
+		// file, so start again
+		os.Remove(part)
+		if _, err := copyPart(src, part, info.Size()); err != nil {
+			return false, err
+		}
+		if written, err = fileops.CalculateFileHash(part); err != nil {
+			return false, err
+		}
+	}
+	if written != hash {
+		os.Remove(part)
+		return false, fmt.Errorf("the copy doesn't match the hash in the database, the file may have changed since it was added")
+	}
+
+	if err := os.Rename(part, dest); err != nil {
+		return false, fmt.Errorf("failed to finish copy: %w", err)
+	}
+	os.Chtimes(dest, info.ModTime(), info.ModTime())
+	return true, nil
+}
+
+// copyPart copies src into part, appending to what an interrupted copy
+// already wrote. The result is whether an earlier copy was resumed.
+func copyPart(src, part string, size int64) (bool, error) {
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", part, err)
+	}
+	defer out.Close()
+
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	if offset > size {
+		if err := out.Truncate(0); err != nil {
+			return false, err
+		}
+		offset, _ = out.Seek(0, io.SeekStart)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer in.Close()
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return false, fmt.Errorf("failed to copy: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		return false, fmt.Errorf("failed to copy: %w", err)
+	}
+	return offset > 0, out.Close()
+}
+
+// writeSubsetDatabase writes a database of the copied files, with their
+// tags, properties and types, to the destination, making it an archive of
+// its own. An existing database there is added to.
+func (c *CLI) writeSubsetDatabase(dest string, copies []subsetCopy) error {
+	db, err := database.New(filepath.Join(dest, ".fart"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		return err
+	}
+
+	taxonomies, err := c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return err
+	}
+	singleValued := make(map[string]bool)
+	for _, t := range taxonomies {
+		singleValued[t.Name] = t.SingleValued
+		existing, err := db.GetTaxonomy(t.Name)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			if err := db.AddTaxonomy(t.Name); err != nil {
+				return err
+			}
+		}
+		if err := db.UpdateTaxonomy(t); err != nil {
+			return err
+		}
+	}
+
+	types, err := c.db.GetFileTypes()
+	if err != nil {
+		return err
+	}
+	typeByPath := make(map[string]database.FileType, len(types))
+	for _, t := range types {
+		typeByPath[filepath.Clean(t.Path)] = t
+	}
+
+	for _, cp := range copies {
+		r := cp.record
+		if err := db.AddFile(filepath.Base(cp.path), filepath.Dir(cp.path), r.Hash, r.Size, r.ModifiedAt); err != nil {
+			return err
+		}
+		if t, ok := typeByPath[filepath.Clean(r.Path)]; ok && t.MIMEType != "" {
+			if err := db.SetFileType(cp.path, t.MIMEType, t.Kind); err != nil {
+				return err
+			}
+		}
+		for taxonomy, tags := range r.Tags {
+			for _, tag := range tags {
+				tagFile := db.TagFile
+				if singleValued[taxonomy] {
+					tagFile = db.SetFileTag
+				}
+				if err := tagFile(cp.path, taxonomy, tag); err != nil {
+					return err
+				}
+			}
+		}
+		for name, value := range r.Properties {
+			if err := db.SetProperty(cp.path, name, value); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("Wrote the tags of %d files to %s\n", len(copies), filepath.Join(dest, ".fart"))
+	return nil
+}
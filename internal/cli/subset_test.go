@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+func TestExportFiles(t *testing.T) {
+	c, db := newTestCLI(t)
+	tagTestArchive(t, c, db)
+	dest := filepath.Join(t.TempDir(), "usb")
+
+	if err := c.HandleExportCommand([]string{"export", "files", "author:Robert Jordan", dest, "--database"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "books/eye.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "The Eye of the World" {
+		t.Errorf("copy = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "books/hunt.txt")); !os.IsNotExist(err) {
+		t.Errorf("a file that doesn't match was copied: %v", err)
+	}
+
+	subset, err := database.New(filepath.Join(dest, ".fart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subset.Close()
+	got, err := subset.GetFileRecord("books/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := db.GetFileRecord("books/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != want.Hash || !reflect.DeepEqual(got.Tags, want.Tags) {
+		t.Errorf("subset record = %+v, want %+v", got, want)
+	}
+	if got.Properties["isbn"] != "9780312850098" {
+		t.Errorf("properties = %v", got.Properties)
+	}
+}
+
+func TestExportFilesFlatten(t *testing.T) {
+	c, _ := newTestCLI(t)
+	addTestFile(t, c, "a/notes.txt", "first")
+	addTestFile(t, c, "b/notes.txt", "second")
+	for _, file := range []string{"a/notes.txt", "b/notes.txt"} {
+		if err := c.taxonomyManager.TagFile(file, "tags", "client-x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dest := t.TempDir()
+
+	if err := c.HandleExportCommand([]string{"export", "files", "client-x", dest, "--flatten"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("copied %d files, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			t.Errorf("%s is a directory", entry.Name())
+		}
+	}
+}
+
+func TestCopyVerifiedResumes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "out", "dest.txt")
+	content := "The Eye of the World"
+	if err := os.WriteFile(src, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash := hashOf(t, src)
+
+	// An interrupted copy left the first half behind
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+partSuffix, []byte(content[:8]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wrote, err := copyVerified(src, dest, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wrote {
+		t.Error("the copy was not written")
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("copy = %q, want %q", data, content)
+	}
+	if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("the .part file is still there: %v", err)
+	}
+
+	// A second copy finds it already there
+	if wrote, err := copyVerified(src, dest, hash); err != nil || wrote {
+		t.Errorf("copyVerified again = %v, %v, want false, nil", wrote, err)
+	}
+}
+
+func TestCopyVerifiedMismatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	if err := os.WriteFile(src, []byte("changed since it was added"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := copyVerified(src, dest, "not the hash"); err == nil {
+		t.Fatal("a copy that doesn't match the hash was accepted")
+	}
+	for _, path := range []string{dest, dest + partSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind: %v", path, err)
+		}
+	}
+}
+
+// hashOf returns the hash fart records for a file
+func hashOf(t *testing.T, path string) string {
+	t.Helper()
+	hash, err := fileops.CalculateFileHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
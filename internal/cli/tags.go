@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// HandleTagsCommand processes commands that manage the tags of a taxonomy
+func (c *CLI) HandleTagsCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: fart tags <tree|add|move|alias|unalias> [arguments]")
+	}
+
+	switch args[1] {
+	case "tree":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: fart tags tree --<taxonomy-name>")
+		}
+		taxonomyName, err := parseTaxonomyFlag(args[2])
+		if err != nil {
+			return err
+		}
+		nodes, err := c.taxonomyManager.TagTree(taxonomyName)
+		if err != nil {
+			return err
+		}
+		printTagTree(nodes)
+		return nil
+
+	case "add":
+		if len(args) < 4 {
+			return fmt.Errorf("usage: fart tags add --<taxonomy-name> <tag>...")
+		}
+		taxonomyName, err := parseTaxonomyFlag(args[2])
+		if err != nil {
+			return err
+		}
+		for _, tag := range args[3:] {
+			if err := c.taxonomyManager.RegisterTag(taxonomyName, tag); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "move":
+		if len(args) != 5 {
+			return fmt.Errorf("usage: fart tags move --<taxonomy-name> <tag> <new-parent|/>")
+		}
+		taxonomyName, err := parseTaxonomyFlag(args[2])
+		if err != nil {
+			return err
+		}
+		return c.taxonomyManager.MoveTag(taxonomyName, args[3], args[4])
+
+	case "alias":
+		if len(args) != 5 {
+			return fmt.Errorf("usage: fart tags alias --<taxonomy-name> <alias> <canonical-tag>")
+		}
+		taxonomyName, err := parseTaxonomyFlag(args[2])
+		if err != nil {
+			return err
+		}
+		return c.taxonomyManager.AddAlias(taxonomyName, args[3], args[4])
+
+	case "unalias":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: fart tags unalias --<taxonomy-name> <alias>")
+		}
+		taxonomyName, err := parseTaxonomyFlag(args[2])
+		if err != nil {
+			return err
+		}
+		return c.taxonomyManager.RemoveAlias(taxonomyName, args[3])
+
+	default:
+		return fmt.Errorf("unknown tags subcommand: %s", args[1])
+	}
+}
+
+// printTagTree renders a tag hierarchy with the number of files under each tag
+func printTagTree(nodes []database.TagNode) {
+	children := make(map[int64][]database.TagNode)
+	for _, node := range nodes {
+		children[node.ParentID] = append(children[node.ParentID], node)
+	}
+
+	var walk func(parentID int64, prefix string)
+	walk = func(parentID int64, prefix string) {
+		siblings := children[parentID]
+		for i, node := range siblings {
+			branch, indent := "├── ", "│   "
+			if i == len(siblings)-1 {
+				branch, indent = "└── ", "    "
+			}
+			if parentID == 0 {
+				branch, indent = "", ""
+			}
+			aliases := ""
+			if len(node.Aliases) > 0 {
+				aliases = " [aka " + strings.Join(node.Aliases, ", ") + "]"
+			}
+			fmt.Printf("%s%s%s (%d)%s\n", prefix, branch, node.Name, node.Count, aliases)
+			walk(node.ID, prefix+indent)
+		}
+	}
+	walk(0, "")
+}
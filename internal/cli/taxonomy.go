@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// configureTaxonomy applies taxonomy options given on the command line:
+// --single or --multi, --closed or --open, --pattern <regex> or --no-pattern,
+// and --type <text|int|float|date|bool>
+func (c *CLI) configureTaxonomy(name string, options []string) error {
+	t, err := c.taxonomyManager.Taxonomy(name)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(options); i++ {
+		switch options[i] {
+		case "--single":
+			t.SingleValued = true
+		case "--multi":
+			t.SingleValued = false
+		case "--closed":
+			t.Closed = true
+		case "--open":
+			t.Closed = false
+		case "--pattern":
+			if i+1 >= len(options) {
+				return fmt.Errorf("--pattern requires a regular expression")
+			}
+			i++
+			t.ValuePattern = options[i]
+		case "--no-pattern":
+			t.ValuePattern = ""
+		case "--type":
+			if i+1 >= len(options) {
+				return fmt.Errorf("--type requires a value type")
+			}
+			i++
+			t.ValueType = options[i]
+		default:
+			return fmt.Errorf("unknown taxonomy option: %s", options[i])
+		}
+	}
+
+	return c.taxonomyManager.ConfigureTaxonomy(*t)
+}
+
+// listTaxonomies prints every taxonomy along with its settings
+func (c *CLI) listTaxonomies() error {
+	taxonomies, err := c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range taxonomies {
+		var settings []string
+		if t.ValueType != database.TypeText {
+			settings = append(settings, t.ValueType)
+		}
+		if t.SingleValued {
+			settings = append(settings, "single-valued")
+		}
+		if t.Closed {
+			settings = append(settings, "closed")
+		}
+		if t.ValuePattern != "" {
+			settings = append(settings, "pattern "+t.ValuePattern)
+		}
+
+		if len(settings) == 0 {
+			fmt.Println(t.Name)
+		} else {
+			fmt.Printf("%s (%s)\n", t.Name, strings.Join(settings, ", "))
+		}
+	}
+	return nil
+}
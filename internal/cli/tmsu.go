@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+
+	"go-fart/internal/database"
+	"go-fart/internal/importers"
+	"go-fart/internal/query"
+)
+
+// importTMSU imports the tags of a TMSU database. Tags without a value are
+// tagged in the default taxonomy, and tag=value pairs in a taxonomy named
+// after the tag. Files are matched by fingerprint first and path second.
+func (c *CLI) importTMSU(dbPath, policy string) error {
+	t, err := importers.ReadTMSU(dbPath)
+	if err != nil {
+		return err
+	}
+	if !t.CanFingerprint() {
+		fmt.Printf("Warning: the TMSU fingerprint algorithm %s is not supported, so files are only matched by path\n", t.Algorithm)
+	}
+
+	// TMSU fingerprints of files in the archive, computed as needed
+	fingerprints := make(map[string]string)
+
+	var stats importStats
+	for _, file := range t.Files {
+		target, err := c.matchTMSUFile(t, file, fingerprints, &stats)
+		if err != nil {
+			fmt.Printf("Warning: %s: %v\n", file.Path, err)
+			continue
+		}
+		if target == "" {
+			fmt.Printf("Warning: no file matches %s\n", file.Path)
+			stats.unmatched++
+			continue
+		}
+		c.applyRecord(target, tmsuRecord(file), policy, &stats)
+	}
+
+	stats.print()
+	return nil
+}
+
+// matchTMSUFile finds the file in the archive that a TMSU file describes: a
+// file with its fingerprint, or failing that the file at its path. It
+// returns "" if none matches.
+func (c *CLI) matchTMSUFile(t *importers.TMSU, file importers.TMSUFile, fingerprints map[string]string, stats *importStats) (string, error) {
+	switch {
+	case t.IsContentHash(file):
+		path, err := c.db.GetFilePathByHash(file.Fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if path != "" {
+			stats.byHash++
+			return path, nil
+		}
+
+	case t.CanFingerprint() && file.Fingerprint != "":
+		// Only files of the same size can have the same fingerprint
+		candidates, err := c.db.GetFilePathsBySize(file.Size)
+		if err != nil {
+			return "", err
+		}
+		for _, candidate := range candidates {
+			fingerprint, ok := fingerprints[candidate]
+			if !ok {
+				fingerprint, err = t.Fingerprint(candidate, file.Size)
+				if err != nil {
+					fmt.Printf("Warning: %s: %v\n", candidate, err)
+				}
+				fingerprints[candidate] = fingerprint
+			}
+			if fingerprint == file.Fingerprint {
+				stats.byHash++
+				return candidate, nil
+			}
+		}
+	}
+
+	// TMSU paths are absolute, and files outside the archive can't match
+	filePath, err := archivePath(file.Path)
+	if err != nil {
+		return "", nil
+	}
+	if record, err := c.db.GetFileRecord(filePath); err == nil {
+		stats.byPath++
+		return record.Path, nil
+	}
+	return "", nil
+}
+
+// tmsuRecord converts the tags of a TMSU file into a file record
+func tmsuRecord(file importers.TMSUFile) *database.FileRecord {
+	record := &database.FileRecord{
+		Path:       file.Path,
+		Tags:       make(map[string][]string),
+		Properties: make(map[string]string),
+	}
+	for _, tag := range file.Tags {
+		if tag.Value == "" {
+			record.Tags[query.DefaultField] = append(record.Tags[query.DefaultField], database.EscapeTagName(tag.Name))
+		} else {
+			record.Tags[tag.Name] = append(record.Tags[tag.Name], database.EscapeTagName(tag.Value))
+		}
+	}
+	return record
+}
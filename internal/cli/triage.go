@@ -0,0 +1,443 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+	"go-fart/internal/terminal"
+)
+
+// triageShortcuts is how many of the most used tags get a number key
+const triageShortcuts = 9
+
+// triageHelp lists the keys of the triage screen
+const triageHelp = "space next  b back  1-9 toggle  t tag  u untag  o open  d delete  q quit"
+
+// triage is a session stepping through files one at a time
+type triage struct {
+	c       *CLI
+	term    *terminal.Terminal
+	files   []string
+	index   int
+	message string
+
+	taxonomies []string
+	// completions are the tag paths and aliases of each taxonomy
+	completions map[string][]string
+	shortcuts   []metadataChange
+}
+
+// HandleTriageCommand steps through files in a full-screen interface for
+// tagging them. Files are given as paths or a search, and default to the
+// files that have no tags or properties yet.
+func (c *CLI) HandleTriageCommand(args []string) error {
+	files, err := c.triageFiles(args[1:])
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("No files to triage")
+		return nil
+	}
+
+	t := &triage{c: c, files: files}
+	if err := t.loadTags(); err != nil {
+		return err
+	}
+
+	t.term, err = terminal.Open()
+	if errors.Is(err, terminal.ErrNotTerminal) {
+		return fmt.Errorf("fart triage must be run in a terminal")
+	}
+	if err != nil {
+		return err
+	}
+	err = t.run()
+	if closeErr := t.term.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// triageFiles returns the files named by paths or patterns if they exist,
+// the results of a search otherwise, or the files without metadata
+func (c *CLI) triageFiles(args []string) ([]string, error) {
+	if len(args) > 0 && !existingPaths(args) {
+		q, err := query.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		return c.taxonomyManager.Search(q)
+	}
+
+	candidates, err := c.looseFiles(args)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range candidates {
+		record, err := c.db.GetFileRecord(file)
+		if errors.Is(err, database.ErrFileNotFound) {
+			fmt.Printf("Warning: %s is not in the archive\n", file)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 0 || !hasMetadata(record) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// existingPaths reports whether every argument names a file, a directory or
+// a pattern matching one
+func existingPaths(args []string) bool {
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err == nil {
+			continue
+		}
+		if matches, _ := filepath.Glob(arg); len(matches) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// loadTags reads the tags of every taxonomy for completion, and picks the
+// most used as shortcuts
+func (t *triage) loadTags() error {
+	taxonomies, err := t.c.taxonomyManager.Taxonomies()
+	if err != nil {
+		return err
+	}
+
+	type usage struct {
+		change metadataChange
+		count  int
+	}
+	var used []usage
+	t.completions = make(map[string][]string)
+	for _, taxonomy := range taxonomies {
+		if taxonomy.Name == database.TypeTaxonomy {
+			continue
+		}
+		t.taxonomies = append(t.taxonomies, taxonomy.Name)
+
+		nodes, err := t.c.taxonomyManager.TagTree(taxonomy.Name)
+		if err != nil {
+			return err
+		}
+		paths := database.TagPaths(nodes)
+		for _, node := range nodes {
+			t.completions[taxonomy.Name] = append(t.completions[taxonomy.Name], paths[node.ID])
+			t.completions[taxonomy.Name] = append(t.completions[taxonomy.Name], node.Aliases...)
+			if node.Count > 0 {
+				used = append(used, usage{metadataChange{Taxonomy: taxonomy.Name, Value: paths[node.ID]}, node.Count})
+			}
+		}
+	}
+	sort.Strings(t.taxonomies)
+
+	sort.SliceStable(used, func(i, j int) bool { return used[i].count > used[j].count })
+	for i := 0; i < len(used) && i < triageShortcuts; i++ {
+		t.shortcuts = append(t.shortcuts, used[i].change)
+	}
+	return nil
+}
+
+// run handles key presses until the user quits
+func (t *triage) run() error {
+	for len(t.files) > 0 {
+		record, err := t.c.db.GetFileRecord(t.files[t.index])
+		if err != nil {
+			return err
+		}
+		t.draw(record)
+		t.message = ""
+
+		key, err := t.term.ReadKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "q", terminal.KeyEscape, terminal.KeyInterrupt:
+			return nil
+		case " ", "n", terminal.KeyRight, terminal.KeyDown:
+			if t.index < len(t.files)-1 {
+				t.index++
+			} else {
+				t.message = "This is the last file, q quits"
+			}
+		case "b", terminal.KeyLeft, terminal.KeyUp:
+			if t.index > 0 {
+				t.index--
+			} else {
+				t.message = "This is the first file"
+			}
+		case "t":
+			err = t.tag(record)
+		case "u":
+			err = t.untag(record)
+		case "o":
+			err = t.open(record.Path)
+		case "d":
+			err = t.delete(record.Path)
+		default:
+			if n := int(key[0] - '1'); len(key) == 1 && n >= 0 && n < len(t.shortcuts) {
+				err = t.toggle(record, t.shortcuts[n])
+			}
+		}
+		if err != nil {
+			t.message = "Error: " + err.Error()
+		}
+	}
+	return nil
+}
+
+// draw shows a file with its metadata, the shortcuts and the keys
+func (t *triage) draw(record *database.FileRecord) {
+	width, height := t.term.Size()
+	lines := []string{
+		fmt.Sprintf("fart triage: %d of %d", t.index+1, len(t.files)),
+		"",
+		record.Path,
+		fmt.Sprintf("  %-12s %d bytes", "size", record.Size),
+		fmt.Sprintf("  %-12s %s", "modified", record.ModifiedAt),
+		fmt.Sprintf("  %-12s %s", "hash", record.Hash),
+		"",
+		"Tags",
+	}
+
+	taxonomies := make([]string, 0, len(record.Tags))
+	for taxonomy := range record.Tags {
+		taxonomies = append(taxonomies, taxonomy)
+	}
+	sort.Strings(taxonomies)
+	for _, taxonomy := range taxonomies {
+		lines = append(lines, fmt.Sprintf("  %-12s %s", taxonomy, strings.Join(record.Tags[taxonomy], ", ")))
+	}
+	if len(taxonomies) == 0 {
+		lines = append(lines, "  (none)")
+	}
+
+	if len(record.Properties) > 0 {
+		lines = append(lines, "", "Properties")
+		names := make([]string, 0, len(record.Properties))
+		for name := range record.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("  %-12s %s", name, record.Properties[name]))
+		}
+	}
+
+	if len(t.shortcuts) > 0 {
+		lines = append(lines, "", "Shortcuts")
+		line := " "
+		for i, shortcut := range t.shortcuts {
+			mark := " "
+			if hasTag(record, shortcut) {
+				mark = "x"
+			}
+			item := fmt.Sprintf(" %d [%s] %s", i+1, mark, triageLabel(shortcut))
+			if len(line)+len(item) > width && line != " " {
+				lines = append(lines, line)
+				line = " "
+			}
+			line += item
+		}
+		lines = append(lines, line)
+	}
+
+	// Keep the message and keys on the last two lines, where prompts go
+	if len(lines) > height-2 {
+		lines = lines[:max(height-2, 0)]
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	t.term.Draw(append(lines, t.message, triageHelp))
+}
+
+// tag asks for a tag and adds it to the file
+func (t *triage) tag(record *database.FileRecord) error {
+	text, ok, err := t.term.Prompt("Tag (taxonomy:tag): ", t.completeTag)
+	if err != nil || !ok {
+		return err
+	}
+	change, ok := parseTriageTag(text)
+	if !ok {
+		return nil
+	}
+	if err := t.c.taxonomyManager.TagFile(record.Path, change.Taxonomy, change.Value); err != nil {
+		return err
+	}
+	t.remember(change)
+	t.message = "Tagged " + triageLabel(change)
+	return nil
+}
+
+// untag asks for one of the file's tags and removes it
+func (t *triage) untag(record *database.FileRecord) error {
+	var current []string
+	for taxonomy, tags := range record.Tags {
+		if taxonomy == database.TypeTaxonomy {
+			continue
+		}
+		for _, tag := range tags {
+			current = append(current, triageLabel(metadataChange{Taxonomy: taxonomy, Value: tag}))
+		}
+	}
+	if len(current) == 0 {
+		t.message = "The file has no tags"
+		return nil
+	}
+
+	complete := func(text string) []string { return terminal.Complete(text, current) }
+	text, ok, err := t.term.Prompt("Untag: ", complete)
+	if err != nil || !ok {
+		return err
+	}
+	change, ok := parseTriageTag(text)
+	if !ok {
+		return nil
+	}
+	if err := t.c.taxonomyManager.UntagFile(record.Path, change.Taxonomy, change.Value); err != nil {
+		return err
+	}
+	t.message = "Untagged " + triageLabel(change)
+	return nil
+}
+
+// toggle adds a shortcut's tag to the file, or removes it if the file has it
+func (t *triage) toggle(record *database.FileRecord, shortcut metadataChange) error {
+	if hasTag(record, shortcut) {
+		t.message = "Untagged " + triageLabel(shortcut)
+		return t.c.taxonomyManager.UntagFile(record.Path, shortcut.Taxonomy, shortcut.Value)
+	}
+	t.message = "Tagged " + triageLabel(shortcut)
+	return t.c.taxonomyManager.TagFile(record.Path, shortcut.Taxonomy, shortcut.Value)
+}
+
+// open shows the file in the viewer from FART_VIEWER, or the desktop's
+// default application
+func (t *triage) open(filePath string) error {
+	if database.IsContainerMember(filePath) {
+		return fmt.Errorf("%s is inside a container", filePath)
+	}
+
+	var cmd *exec.Cmd
+	switch viewer := os.Getenv("FART_VIEWER"); {
+	case viewer != "":
+		cmd = exec.Command(viewer, filePath)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", filePath)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", filePath)
+	default:
+		cmd = exec.Command("xdg-open", filePath)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	go cmd.Wait()
+	t.message = "Opened " + filePath
+	return nil
+}
+
+// delete removes the file from the disk and the archive once confirmed
+func (t *triage) delete(filePath string) error {
+	if database.IsContainerMember(filePath) {
+		return fmt.Errorf("%s is inside a container", filePath)
+	}
+	ok, err := t.term.Confirm(fmt.Sprintf("Delete %s from the disk and the archive?", filePath))
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := t.c.db.RemoveFile(filePath); err != nil {
+		return err
+	}
+	t.files = append(t.files[:t.index], t.files[t.index+1:]...)
+	if t.index == len(t.files) && t.index > 0 {
+		t.index--
+	}
+	t.message = "Deleted " + filePath
+	return nil
+}
+
+// completeTag completes taxonomy names, the tags of the taxonomy before a
+// colon, or the tags of the default taxonomy
+func (t *triage) completeTag(text string) []string {
+	if taxonomy, tag, found := strings.Cut(text, ":"); found {
+		var matches []string
+		for _, match := range terminal.Complete(tag, t.completions[strings.ToLower(taxonomy)]) {
+			matches = append(matches, taxonomy+":"+match)
+		}
+		return matches
+	}
+
+	candidates := append([]string{}, t.completions[query.DefaultField]...)
+	for _, taxonomy := range t.taxonomies {
+		candidates = append(candidates, taxonomy+":")
+	}
+	return terminal.Complete(text, candidates)
+}
+
+// remember adds a new tag to the completions
+func (t *triage) remember(change metadataChange) {
+	for _, tag := range t.completions[change.Taxonomy] {
+		if tag == change.Value {
+			return
+		}
+	}
+	if _, ok := t.completions[change.Taxonomy]; !ok {
+		t.taxonomies = append(t.taxonomies, change.Taxonomy)
+		sort.Strings(t.taxonomies)
+	}
+	t.completions[change.Taxonomy] = append(t.completions[change.Taxonomy], change.Value)
+}
+
+// parseTriageTag reads taxonomy:tag, or a tag of the default taxonomy
+func parseTriageTag(text string) (metadataChange, bool) {
+	text = strings.TrimSpace(text)
+	taxonomy, tag, found := strings.Cut(text, ":")
+	if !found {
+		taxonomy, tag = query.DefaultField, text
+	}
+	taxonomy = strings.ToLower(strings.TrimSpace(taxonomy))
+	tag = strings.TrimSpace(tag)
+	return metadataChange{Taxonomy: taxonomy, Value: tag}, taxonomy != "" && tag != ""
+}
+
+// triageLabel shows a tag as it would be typed
+func triageLabel(change metadataChange) string {
+	if change.Taxonomy == query.DefaultField {
+		return change.Value
+	}
+	return change.Taxonomy + ":" + change.Value
+}
+
+// hasTag reports whether a file has a tag
+func hasTag(record *database.FileRecord, change metadataChange) bool {
+	for _, tag := range record.Tags[change.Taxonomy] {
+		if tag == change.Value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// HandleTypesCommand summarises the types of the files in the archive, lists
+// files whose extension disagrees with their content, or detects the types
+// of files added before types were recorded
+func (c *CLI) HandleTypesCommand(args []string) error {
+	args, mismatched := hasFlag(args, "--mismatched")
+	args, detect := hasFlag(args, "--detect")
+	if len(args) != 1 || (mismatched && detect) {
+		return fmt.Errorf("usage: fart types [--mismatched|--detect]")
+	}
+
+	types, err := c.db.GetFileTypes()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case detect:
+		for _, t := range types {
+			// Members are typed when their container is indexed
+			if database.IsContainerMember(t.Path) {
+				continue
+			}
+			if err := c.detectType(t.Path, t.Path); err != nil {
+				fmt.Printf("Warning: %s: %v\n", t.Path, err)
+			}
+		}
+	case mismatched:
+		for _, t := range types {
+			if expected := fileops.ExtensionMIMEType(t.Path); t.MIMEType != "" && expected != "" && t.MIMEType != expected {
+				fmt.Printf("%s: content is %s, extension suggests %s\n", t.Path, t.MIMEType, expected)
+			}
+		}
+	default:
+		printTypeSummary(types)
+	}
+	return nil
+}
+
+// detectType records the type of a file in the archive and tags it with its
+// kind, warning if its extension disagrees with its content
+func (c *CLI) detectType(path, filePath string) error {
+	t, err := fileops.DetectFileType(path)
+	if err != nil {
+		return err
+	}
+	if t.Expected != "" {
+		fmt.Printf("Warning: %s: content is %s, extension suggests %s\n", filePath, t.MIMEType, t.Expected)
+	}
+
+	if err := c.db.SetFileType(filePath, t.MIMEType, t.Kind); err != nil {
+		return err
+	}
+	return c.taxonomyManager.TagFile(filePath, database.TypeTaxonomy, t.Kind)
+}
+
+// printTypeSummary prints the number of files of each kind and MIME type
+func printTypeSummary(types []database.FileType) {
+	kinds := make(map[string]map[string]int)
+	for _, t := range types {
+		kind, mimeType := t.Kind, t.MIMEType
+		if mimeType == "" {
+			kind, mimeType = "unknown", "not detected, run fart types --detect"
+		}
+		if kinds[kind] == nil {
+			kinds[kind] = make(map[string]int)
+		}
+		kinds[kind][mimeType]++
+	}
+
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+
+	for _, kind := range names {
+		total := 0
+		mimeTypes := make([]string, 0, len(kinds[kind]))
+		for mimeType, count := range kinds[kind] {
+			mimeTypes = append(mimeTypes, mimeType)
+			total += count
+		}
+		sort.Strings(mimeTypes)
+
+		fmt.Printf("%s (%d)\n", kind, total)
+		for _, mimeType := range mimeTypes {
+			fmt.Printf("  %s (%d)\n", mimeType, kinds[kind][mimeType])
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/query"
+)
+
+// viewManifest lists the links fart made in a view directory, so that
+// refreshing the view never removes anything else
+const viewManifest = ".fart-view.json"
+
+// searchesDir holds the views of saved searches, one directory each
+const searchesDir = "searches"
+
+// manifest is the content of a view's manifest
+type manifest struct {
+	// Links maps the path of each link in the view to the archive path of
+	// its file
+	Links map[string]string `json:"links"`
+}
+
+// HandleViewCommand builds directories of links to the files in the archive,
+// arranged by their tags and saved searches, for browsing in other programs
+func (c *CLI) HandleViewCommand(args []string) error {
+	usage := fmt.Errorf("usage: fart view build <out-dir> [--hardlink] [--taxonomy <name>[,<name>...]] [--search <name>[,<name>...]] | fart view refresh [<out-dir>...]")
+	if len(args) < 2 {
+		return usage
+	}
+
+	switch args[1] {
+	case "build":
+		args, hardlinks := hasFlag(args[2:], "--hardlink")
+		args, taxonomies, err := stringFlag(args, "--taxonomy")
+		if err != nil {
+			return err
+		}
+		args, searches, err := stringFlag(args, "--search")
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return usage
+		}
+
+		dir, err := viewDirectory(args[0])
+		if err != nil {
+			return err
+		}
+		view := database.View{
+			Path:       dir,
+			Hardlinks:  hardlinks,
+			Taxonomies: splitNames(strings.ToLower(taxonomies)),
+			Searches:   splitNames(searches),
+		}
+		for _, name := range view.Searches {
+			if _, err := c.savedSearchTerms(name); err != nil {
+				return err
+			}
+		}
+		if err := c.db.SaveView(view); err != nil {
+			return err
+		}
+		return c.refreshView(view)
+
+	case "refresh":
+		var views []database.View
+		if len(args) == 2 {
+			all, err := c.db.GetViews()
+			if err != nil {
+				return err
+			}
+			if len(all) == 0 {
+				fmt.Println("No views have been built, use fart view build <out-dir>")
+			}
+			views = all
+		}
+		for _, arg := range args[2:] {
+			dir, err := filepath.Abs(arg)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+			view, err := c.db.GetView(dir)
+			if err != nil {
+				return err
+			}
+			if view == nil {
+				return fmt.Errorf("%s is not a view, use fart view build %s", arg, arg)
+			}
+			views = append(views, *view)
+		}
+
+		for _, view := range views {
+			if err := c.refreshView(view); err != nil {
+				fmt.Printf("Warning: %s: %v\n", view.Path, err)
+			}
+		}
+		return nil
+	}
+	return usage
+}
+
+// viewDirectory returns the absolute path of a view directory, which must be
+// outside the archive so that its links aren't added as files, and either
+// empty or an earlier view
+func viewDirectory(path string) (string, error) {
+	if _, err := archivePath(path); err == nil {
+		return "", fmt.Errorf("the view directory %s must be outside the archive", path)
+	}
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(entries) > 0 {
+		if _, err := os.Stat(filepath.Join(dir, viewManifest)); err != nil {
+			return "", fmt.Errorf("%s is not empty and doesn't hold a view", path)
+		}
+	}
+	return dir, nil
+}
+
+// refreshView brings the links in a view up to date with the archive,
+// adding missing links and removing those that are no longer wanted
+func (c *CLI) refreshView(view database.View) error {
+	links, err := c.viewLinks(view)
+	if err != nil {
+		return err
+	}
+	old, err := readManifest(view.Path)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	removed := 0
+	for link, file := range old {
+		if links[link] == file {
+			continue
+		}
+		if err := removeLink(filepath.Join(view.Path, link)); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		removed++
+	}
+
+	added := 0
+	for link, file := range links {
+		path := filepath.Join(view.Path, link)
+		target := filepath.Join(root, file)
+		if isLinkTo(path, target, view.Hardlinks) {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			if _, ours := old[link]; !ours {
+				fmt.Printf("Warning: %s already exists, skipping\n", path)
+				delete(links, link)
+				continue
+			}
+			if err := removeLink(path); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fmt.Printf("Warning: failed to create directory: %v\n", err)
+			delete(links, link)
+			continue
+		}
+		if view.Hardlinks {
+			err = os.Link(target, path)
+		} else {
+			err = os.Symlink(target, path)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to link %s: %v\n", file, err)
+			delete(links, link)
+			continue
+		}
+		added++
+	}
+
+	pruneDirectories(view.Path, old)
+	if err := writeManifest(view.Path, links); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d links added, %d removed\n", view.Path, added, removed)
+	return nil
+}
+
+// viewLinks works out the links a view should have, as paths within the
+// view mapped to the archive paths of their files
+func (c *CLI) viewLinks(view database.View) (map[string]string, error) {
+	taxonomies, searches := view.Taxonomies, view.Searches
+	if len(taxonomies) == 0 && len(searches) == 0 {
+		all, err := c.taxonomyManager.Taxonomies()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range all {
+			taxonomies = append(taxonomies, t.Name)
+		}
+		saved, err := c.db.GetSavedSearches()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range saved {
+			searches = append(searches, s.Name)
+		}
+	}
+
+	// Files of each directory in the view
+	dirs := make(map[string][]string)
+	if len(taxonomies) > 0 {
+		selected := make(map[string]bool)
+		for _, name := range taxonomies {
+			selected[name] = true
+		}
+		records, err := c.allFileRecords()
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			file := filepath.Clean(record.Path)
+			if database.IsContainerMember(file) || record.MissingAt != "" {
+				continue
+			}
+			for taxonomy, tags := range record.Tags {
+				if !selected[taxonomy] {
+					continue
+				}
+				for _, tag := range tags {
+					dir := filepath.Join(append([]string{taxonomyDirectory(taxonomy)}, dirNames(database.SplitTagPath(tag))...)...)
+					dirs[dir] = append(dirs[dir], file)
+				}
+			}
+		}
+	}
+
+	for _, name := range searches {
+		terms, err := c.savedSearchTerms(name)
+		if err != nil {
+			return nil, err
+		}
+		q, err := query.Parse(terms)
+		if err != nil {
+			return nil, fmt.Errorf("saved search %s: %w", name, err)
+		}
+		files, err := c.taxonomyManager.Search(q)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(searchesDir, name)
+		for _, file := range files {
+			if file = filepath.Clean(file); !database.IsContainerMember(file) {
+				dirs[dir] = append(dirs[dir], file)
+			}
+		}
+	}
+
+	links := make(map[string]string)
+	for dir, files := range dirs {
+		sort.Strings(files)
+		used := make(map[string]bool)
+		for _, file := range files {
+			links[filepath.Join(dir, fileops.UniqueName(filepath.Base(file), used))] = file
+		}
+	}
+	return links, nil
+}
+
+// taxonomyDirectory names the directory of a taxonomy in a view, such as
+// by-author, or by-tag for the default taxonomy
+func taxonomyDirectory(taxonomy string) string {
+	if taxonomy == query.DefaultField {
+		return "by-tag"
+	}
+	return "by-" + fileops.SafeName(taxonomy)
+}
+
+// dirNames turns the levels of a tag into directory names
+func dirNames(levels []string) []string {
+	names := make([]string, len(levels))
+	for i, level := range levels {
+		names[i] = fileops.SafeName(level)
+	}
+	return names
+}
+
+// splitNames splits a comma-separated list of names
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isLinkTo reports whether path is a link to target of the given kind
+func isLinkTo(path, target string, hardlink bool) bool {
+	if !hardlink {
+		dest, err := os.Readlink(path)
+		return err == nil && dest == target
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	targetInfo, err := os.Stat(target)
+	return err == nil && os.SameFile(info, targetInfo)
+}
+
+// removeLink removes a link made for a view, which is never a directory
+func removeLink(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, leaving it", path)
+	}
+	return os.Remove(path)
+}
+
+// pruneDirectories removes the directories of a view that held its links
+// and are now empty, deepest first, so that directories of tags without files
+// go away. Other directories are left alone, even when they are empty.
+func pruneDirectories(dir string, links map[string]string) {
+	parents := make(map[string]bool)
+	for link := range links {
+		for parent := filepath.Dir(link); parent != "."; parent = filepath.Dir(parent) {
+			parents[parent] = true
+		}
+	}
+	dirs := make([]string, 0, len(parents))
+	for parent := range parents {
+		dirs = append(dirs, parent)
+	}
+	// Children sort after their parents
+	sort.Strings(dirs)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(filepath.Join(dir, dirs[i])) // fails unless empty
+	}
+}
+
+// readManifest reads the links recorded in a view directory, which has none
+// before it is first built
+func readManifest(dir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, viewManifest))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read view manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to read view manifest: %w", err)
+	}
+	if m.Links == nil {
+		m.Links = map[string]string{}
+	}
+	return m.Links, nil
+}
+
+// writeManifest records the links in a view directory
+func writeManifest(dir string, links map[string]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	data, err := json.MarshalIndent(manifest{Links: links}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, viewManifest), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write view manifest: %w", err)
+	}
+	return nil
+}
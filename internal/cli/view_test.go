@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// viewContents lists the files in a view directory with the archive paths
+// of the files they link to, leaving out the manifest
+func viewContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := make(map[string]string)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == viewManifest {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		target, err := os.Readlink(path)
+		if err != nil {
+			// Not a link
+			links[rel] = ""
+			return nil
+		}
+		links[rel], _ = filepath.Rel(root, target)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func TestViewBuildAndRefresh(t *testing.T) {
+	c, db := newTestCLI(t)
+	addTestFile(t, c, "books/eye.txt", "The Eye of the World")
+	addTestFile(t, c, "a/notes.txt", "first notes")
+	addTestFile(t, c, "b/notes.txt", "second notes")
+	for _, tag := range []struct{ file, taxonomy, value string }{
+		{"books/eye.txt", "genre", "fiction/fantasy"},
+		{"a/notes.txt", "tags", "notes"},
+		{"b/notes.txt", "tags", "notes"},
+	} {
+		if err := c.taxonomyManager.TagFile(tag.file, tag.taxonomy, tag.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveSearch("fantasy", "genre:fantasy"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := c.HandleViewCommand([]string{"view", "build", dir, "--taxonomy", "genre,tags", "--search", "fantasy"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		filepath.Join("by-genre", "fiction", "fantasy", "eye.txt"): filepath.Join("books", "eye.txt"),
+		filepath.Join("by-tag", "notes", "notes.txt"):              filepath.Join("a", "notes.txt"),
+		filepath.Join("by-tag", "notes", "notes (2).txt"):          filepath.Join("b", "notes.txt"),
+		filepath.Join("searches", "fantasy", "eye.txt"):            filepath.Join("books", "eye.txt"),
+	}
+	if got := viewContents(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("view = %v, want %v", got, want)
+	}
+
+	// Refreshing removes stale links and their empty directories, and
+	// leaves everything else alone
+	foreign := filepath.Join(dir, "by-genre", "mine.txt")
+	if err := os.WriteFile(foreign, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "by-genre", "empty")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.taxonomyManager.UntagFile("books/eye.txt", "genre", "fiction/fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleViewCommand([]string{"view", "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Errorf("refresh removed a file it didn't make: %v", err)
+	}
+	if _, err := os.Stat(empty); err != nil {
+		t.Errorf("refresh removed a directory it didn't make: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "by-genre", "fiction")); !os.IsNotExist(err) {
+		t.Errorf("refresh kept the directory of a tag without files: %v", err)
+	}
+	var got []string
+	for link := range viewContents(t, dir) {
+		got = append(got, link)
+	}
+	sort.Strings(got)
+	if want := []string{filepath.Join("by-genre", "mine.txt"), filepath.Join("by-tag", "notes", "notes (2).txt"), filepath.Join("by-tag", "notes", "notes.txt")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("view after refresh = %v, want %v", got, want)
+	}
+}
+
+func TestViewInsideArchive(t *testing.T) {
+	c, _ := newTestCLI(t)
+	if err := c.HandleViewCommand([]string{"view", "build", "links"}); err == nil {
+		t.Error("building a view inside the archive succeeded")
+	}
+}
+
+func TestViewForeignDirectory(t *testing.T) {
+	c, _ := newTestCLI(t)
+	addTestFile(t, c, "books/eye.txt", "The Eye of the World")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mine.txt"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleViewCommand([]string{"view", "build", dir}); err == nil {
+		t.Error("building a view in a directory of other files succeeded")
+	}
+
+	// A directory that holds a view can be built again
+	dir = t.TempDir()
+	for i := 0; i < 2; i++ {
+		if err := c.HandleViewCommand([]string{"view", "build", dir}); err != nil {
+			t.Fatalf("build %d failed: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/rules"
+	"go-fart/internal/sidecar"
+)
+
+// watchDelay is how long the archive must be quiet before changes are
+// processed, so that files being written or moved in several steps are only
+// looked at once they are done
+const watchDelay = time.Second
+
+// archiveWatch follows the changes to the files of the archive
+type archiveWatch struct {
+	cli     *CLI
+	watcher *fsnotify.Watcher
+	rules   []rules.Rule
+	stage   string          // archive path of the stage directory, or ""
+	changed map[string]bool // paths with events since the last batch
+}
+
+// HandleWatchCommand keeps the database up to date as files in the archive
+// are added, changed, moved and deleted, until it is interrupted
+func (c *CLI) HandleWatchCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: fart watch")
+	}
+
+	ruleSet, err := rules.Load(rules.File)
+	if err != nil {
+		return err
+	}
+	stage, err := c.watchStage()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch the archive: %w", err)
+	}
+	defer watcher.Close()
+
+	w := &archiveWatch{cli: c, watcher: watcher, rules: ruleSet, stage: stage, changed: make(map[string]bool)}
+	if _, err := w.watchDirectory("."); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Println("Watching the archive, press Ctrl-C to stop")
+
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			w.process()
+			fmt.Println("Stopped watching")
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || ignoredPath(event.Name) {
+				continue
+			}
+			w.changed[filepath.Clean(event.Name)] = true
+			timer.Reset(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				fmt.Println("Warning: too many changes at once, some were missed, run fart verify to find them")
+			} else {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		case <-timer.C:
+			w.process()
+		}
+	}
+}
+
+// watchStage returns the archive path of the stage directory, where new
+// files get the tags of the autotag rules, or "" if there is none within
+// the archive
+func (c *CLI) watchStage() (string, error) {
+	stage, err := c.db.GetStageDirectory()
+	if err != nil || stage == "" {
+		return "", err
+	}
+	path, err := archivePath(stage)
+	if err != nil {
+		fmt.Printf("Warning: the stage directory %s is outside the archive, so autotag rules won't be applied\n", stage)
+		return "", nil
+	}
+	return path, nil
+}
+
+// ignoredPath reports whether a path is never archived: hidden files and
+// directories, such as the database, and sidecars
+func ignoredPath(path string) bool {
+	for _, part := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return sidecar.IsSidecar(path)
+}
+
+// watchDirectory watches a directory and those beneath it, returning the
+// files in them
+func (w *archiveWatch) watchDirectory(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ignoredPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if err := w.watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+		} else if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// process brings the database up to date with the paths changed since the
+// last batch. A file that was deleted and one created with the same content
+// are taken as a move, so the file keeps its tags.
+func (w *archiveWatch) process() {
+	paths := make([]string, 0, len(w.changed))
+	for path := range w.changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	w.changed = make(map[string]bool)
+
+	arrived := make(map[string]bool)
+	gone := make(map[string]string) // archive path to hash
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		switch {
+		case err == nil && info.IsDir():
+			files, err := w.watchDirectory(path)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			for _, file := range files {
+				arrived[file] = true
+			}
+		case err == nil && info.Mode().IsRegular():
+			arrived[path] = true
+		case os.IsNotExist(err):
+			w.findGone(path, gone)
+		}
+	}
+
+	// Files that are gone, by hash, to match moves
+	byHash := make(map[string][]string)
+	for path, hash := range gone {
+		byHash[hash] = append(byHash[hash], path)
+	}
+	for _, paths := range byHash {
+		sort.Strings(paths)
+	}
+
+	files := make([]string, 0, len(arrived))
+	for file := range arrived {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if moved := w.arrive(file, byHash); moved != "" {
+			delete(gone, moved)
+		}
+	}
+
+	missing := make([]string, 0, len(gone))
+	for path := range gone {
+		missing = append(missing, path)
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		if err := w.cli.db.MarkFileMissing(path); err != nil {
+			fmt.Printf("Warning: %s: %v\n", path, err)
+			continue
+		}
+		fmt.Printf("Missing %s\n", path)
+	}
+}
+
+// findGone adds the files of the database at a path that no longer exists,
+// or beneath it if it was a directory, to gone with their hashes
+func (w *archiveWatch) findGone(path string, gone map[string]string) {
+	record, err := w.cli.db.GetFileRecord(path)
+	if err == nil {
+		if record.MissingAt == "" {
+			gone[path] = record.Hash
+		}
+		return
+	}
+
+	files, err := w.cli.db.GetAllFiles()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+	prefix := path + string(filepath.Separator)
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if !strings.HasPrefix(file, prefix) || database.IsContainerMember(file) {
+			continue
+		}
+		if _, err := os.Lstat(file); !os.IsNotExist(err) {
+			continue
+		}
+		if record, err := w.cli.db.GetFileRecord(file); err == nil && record.MissingAt == "" {
+			gone[file] = record.Hash
+		}
+	}
+}
+
+// arrive records a new or changed file. A new file with the content of one
+// that is gone is moved in the database, and the old path is returned.
+func (w *archiveWatch) arrive(file string, byHash map[string][]string) string {
+	info, err := fileops.GetFileInfo(file)
+	if err != nil {
+		fmt.Printf("Warning: %s: %v\n", file, err)
+		return ""
+	}
+
+	record, err := w.cli.db.GetFileRecord(file)
+	if err == nil {
+		if record.Hash == info.Hash && record.MissingAt == "" {
+			return ""
+		}
+		if err := w.cli.db.AddFile(filepath.Base(file), filepath.Dir(file), info.Hash, info.Size, info.ModifiedAt); err != nil {
+			fmt.Printf("Warning: %s: %v\n", file, err)
+			return ""
+		}
+		if err := w.cli.detectType(file, file); err != nil {
+			fmt.Printf("Warning: %s: %v\n", file, err)
+		}
+		fmt.Printf("Updated %s\n", file)
+		return ""
+	}
+	if !errors.Is(err, database.ErrFileNotFound) {
+		fmt.Printf("Warning: %s: %v\n", file, err)
+		return ""
+	}
+
+	// A file that went missing in an earlier batch may turn up too
+	var old string
+	if paths := byHash[info.Hash]; len(paths) > 0 {
+		old, byHash[info.Hash] = paths[0], paths[1:]
+	} else if old, err = w.cli.db.GetMissingFileByHash(info.Hash); err != nil {
+		fmt.Printf("Warning: %s: %v\n", file, err)
+		return ""
+	}
+	if old != "" {
+		if err := w.cli.db.UpdateFilePath(old, file); err != nil {
+			fmt.Printf("Warning: %s: %v\n", file, err)
+			return ""
+		}
+		fmt.Printf("Moved %s -> %s\n", old, file)
+		return old
+	}
+
+	var opts addOptions
+	if w.inStage(file) {
+		opts.rules = w.rules
+	}
+	if err := w.cli.addFile(file, opts); err != nil {
+		fmt.Printf("Warning: %s: %v\n", file, err)
+	}
+	return ""
+}
+
+// inStage reports whether a file is in the stage directory
+func (w *archiveWatch) inStage(file string) bool {
+	if w.stage == "" {
+		return false
+	}
+	return w.stage == "." || strings.HasPrefix(file, w.stage+string(filepath.Separator))
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestWatch returns a watch of a test archive that is processed by hand
+func newTestWatch(t *testing.T, c *CLI) *archiveWatch {
+	t.Helper()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+	w := &archiveWatch{cli: c, watcher: watcher, changed: make(map[string]bool)}
+	if _, err := w.watchDirectory("."); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// processPaths processes a batch of changed paths
+func processPaths(w *archiveWatch, paths ...string) {
+	for _, path := range paths {
+		w.changed[path] = true
+	}
+	w.process()
+}
+
+func TestWatchMove(t *testing.T) {
+	c, db := newTestCLI(t)
+	addTestFile(t, c, "inbox/eye.txt", "The Eye of the World")
+	if err := c.taxonomyManager.TagFile("inbox/eye.txt", "genre", "fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWatch(t, c)
+
+	if err := os.MkdirAll("books", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("inbox/eye.txt", "books/eye.txt"); err != nil {
+		t.Fatal(err)
+	}
+	processPaths(w, "inbox/eye.txt", "books")
+
+	record, err := db.GetFileRecord("books/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(record.Tags["genre"], []string{"fantasy"}) {
+		t.Errorf("moved file has genre %v, want fantasy", record.Tags["genre"])
+	}
+	if _, err := db.GetFileRecord("inbox/eye.txt"); err == nil {
+		t.Error("the old path is still in the database")
+	}
+}
+
+func TestWatchMissing(t *testing.T) {
+	c, db := newTestCLI(t)
+	addTestFile(t, c, "books/eye.txt", "The Eye of the World")
+	if err := c.taxonomyManager.TagFile("books/eye.txt", "genre", "fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWatch(t, c)
+
+	if err := os.Rename("books/eye.txt", filepath.Join(t.TempDir(), "eye.txt")); err != nil {
+		t.Fatal(err)
+	}
+	processPaths(w, "books/eye.txt")
+	record, err := db.GetFileRecord("books/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.MissingAt == "" {
+		t.Error("a deleted file isn't marked missing")
+	}
+
+	// The file turning up again in a later batch is a move
+	if err := os.Mkdir("later", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("later/eye.txt", []byte("The Eye of the World"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	processPaths(w, "later")
+	record, err = db.GetFileRecord("later/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.MissingAt != "" || !reflect.DeepEqual(record.Tags["genre"], []string{"fantasy"}) {
+		t.Errorf("returned file = %+v, want it found with its tags", record)
+	}
+}
+
+func TestWatchChanged(t *testing.T) {
+	c, db := newTestCLI(t)
+	addTestFile(t, c, "notes.txt", "first draft")
+	before, err := db.GetFileRecord("notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWatch(t, c)
+
+	if err := os.WriteFile("notes.txt", []byte("second draft"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("new.txt", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	processPaths(w, "notes.txt", "new.txt")
+
+	after, err := db.GetFileRecord("notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Hash == before.Hash {
+		t.Error("the hash of a changed file wasn't updated")
+	}
+	if _, err := db.GetFileRecord("new.txt"); err != nil {
+		t.Errorf("a new file wasn't added: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+	"go-fart/internal/xattr"
+)
+
+// Extended attributes read by file managers and other tagging tools
+const (
+	xdgTagsAttr    = "user.xdg.tags"
+	xdgCommentAttr = "user.xdg.comment"
+	// fartAttrPrefix namespaces the attributes of other taxonomies
+	fartAttrPrefix = "user.fart."
+)
+
+// commentProperty is the property mirrored to user.xdg.comment
+const commentProperty = "comment"
+
+// HandleXattrCommand mirrors the tags of files to and from their extended
+// attributes
+func (c *CLI) HandleXattrCommand(args []string) error {
+	usage := fmt.Errorf("usage: fart xattr push|pull [--all] [<file|directory|pattern>...]")
+	if len(args) < 2 || (args[1] != "push" && args[1] != "pull") {
+		return usage
+	}
+	push := args[1] == "push"
+
+	args, all := hasFlag(args[2:], "--all")
+	files, err := c.looseFiles(args)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if push {
+			err = c.pushXattrs(file, all)
+		} else {
+			err = c.pullXattrs(file, all)
+		}
+
+		// An archive is usually on a single filesystem, so the rest of the
+		// files would fail too
+		if errors.Is(err, xattr.ErrNotSupported) {
+			fmt.Printf("Warning: %s: the filesystem does not support extended attributes\n", file)
+			return nil
+		}
+		if err != nil {
+			fmt.Printf("Warning: %s: %v\n", file, err)
+		}
+	}
+	return nil
+}
+
+// pushXattrs writes the default taxonomy of a file to user.xdg.tags and its
+// comment to user.xdg.comment, and with all set the other taxonomies to
+// user.fart.<taxonomy>. Attributes for tags that were removed are removed.
+func (c *CLI) pushXattrs(filePath string, all bool) error {
+	record, err := c.db.GetFileRecord(filePath)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]string{
+		xdgTagsAttr:    joinXattrTags(filePath, record.Tags[query.DefaultField]),
+		xdgCommentAttr: record.Properties[commentProperty],
+	}
+	if all {
+		names, err := xattr.List(filePath)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, fartAttrPrefix) {
+				attrs[name] = ""
+			}
+		}
+		for taxonomy, tags := range record.Tags {
+			if taxonomy != query.DefaultField && taxonomy != database.TypeTaxonomy {
+				attrs[fartAttrPrefix+taxonomy] = joinXattrTags(filePath, tags)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := attrs[name]
+		current, set, err := xattr.Get(filePath, name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case value == "" && set:
+			if err := xattr.Remove(filePath, name); err != nil {
+				return err
+			}
+			fmt.Printf("%s: removed %s\n", filePath, name)
+		case value != "" && value != current:
+			if err := xattr.Set(filePath, name, value); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s=%s\n", filePath, name, value)
+		}
+	}
+	return nil
+}
+
+// joinXattrTags joins tags with commas, as user.xdg.tags holds them. Tags
+// containing a comma cannot be held and are left out.
+func joinXattrTags(filePath string, tags []string) string {
+	var kept []string
+	for _, tag := range tags {
+		if strings.Contains(tag, ",") {
+			fmt.Printf("Warning: %s: tag %q contains a comma and is not pushed\n", filePath, tag)
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	return strings.Join(kept, ",")
+}
+
+// pullXattrs tags a file with the tags of its user.xdg.tags attribute, sets
+// its comment from user.xdg.comment, and with all set tags it with the
+// user.fart.<taxonomy> attributes. Existing tags are kept.
+func (c *CLI) pullXattrs(filePath string, all bool) error {
+	names := []string{xdgTagsAttr, xdgCommentAttr}
+	if all {
+		listed, err := xattr.List(filePath)
+		if err != nil {
+			return err
+		}
+		for _, name := range listed {
+			if strings.HasPrefix(name, fartAttrPrefix) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var changes []metadataChange
+	for _, name := range names {
+		value, set, err := xattr.Get(filePath, name)
+		if err != nil {
+			return err
+		}
+		if !set || strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		if name == xdgCommentAttr {
+			changes = append(changes, metadataChange{Property: commentProperty, Value: value})
+			continue
+		}
+
+		taxonomy := query.DefaultField
+		if name != xdgTagsAttr {
+			taxonomy = strings.TrimPrefix(name, fartAttrPrefix)
+		}
+		if taxonomy == database.TypeTaxonomy {
+			continue
+		}
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				changes = append(changes, metadataChange{Taxonomy: taxonomy, Value: tag})
+			}
+		}
+	}
+	return c.applyMetadata(filePath, changes)
+}
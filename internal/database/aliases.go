@@ -0,0 +1,173 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AddTagAlias makes an alternative name resolve to a canonical tag. The
+// canonical tag is created if it does not exist yet. If the alias is already
+// in use as a tag of its own, that tag is merged into the canonical tag.
+func (db *DB) AddTagAlias(taxonomyName, alias, canonicalPath string) error {
+	names := SplitTagPath(alias)
+	if len(names) != 1 {
+		return fmt.Errorf("invalid alias %q: must be a single non-empty tag name", alias)
+	}
+	alias = names[0]
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	taxonomyID, err := requireTaxonomy(tx, taxonomyName)
+	if err != nil {
+		return err
+	}
+
+	canonicalID, err := ensureTagPath(tx, taxonomyID, canonicalPath)
+	if err != nil {
+		return err
+	}
+
+	existingID, err := resolveTagName(tx, taxonomyID, alias)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case existingID == canonicalID:
+		// Either the canonical tag itself or an existing alias of it
+		return tx.Commit()
+	default:
+		var isAlias bool
+		err := tx.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM tag_aliases WHERE tag_id = ? AND name = ?)",
+			existingID, alias,
+		).Scan(&isAlias)
+		if err != nil {
+			return fmt.Errorf("failed to look up alias: %w", err)
+		}
+		if isAlias {
+			return fmt.Errorf("%q is already an alias of another tag", alias)
+		}
+		if err := mergeTag(tx, existingID, canonicalID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO tag_aliases (tag_id, name) VALUES (?, ?)", canonicalID, alias)
+	if err != nil {
+		return fmt.Errorf("failed to add alias: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RemoveTagAlias removes an alias from the tag it resolves to
+func (db *DB) RemoveTagAlias(taxonomyName, alias string) error {
+	taxonomyID, err := requireTaxonomy(db, taxonomyName)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`
+        DELETE FROM tag_aliases
+        WHERE name = ? AND tag_id IN (SELECT id FROM tags WHERE taxonomy_id = ?)
+    `, alias, taxonomyID)
+	if err != nil {
+		return fmt.Errorf("failed to remove alias: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("alias not found: %s", alias)
+	}
+	return nil
+}
+
+// mergeTag folds one tag into another. Its files, child tags and aliases are
+// moved to the target, the tag itself is removed and its name kept as an
+// alias by the caller. A child with the same name as one of the target's
+// children is merged into it in turn.
+func mergeTag(tx *sql.Tx, fromID, toID int64) error {
+	isAncestor, err := inSubtree(tx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	if isAncestor {
+		return fmt.Errorf("cannot merge a tag into one of its descendants")
+	}
+
+	rows, err := tx.Query(`
+        SELECT c.id, t.id FROM tags c
+        JOIN tags t ON t.parent_id = ? AND t.name = c.name
+        WHERE c.parent_id = ?
+    `, toID, fromID)
+	if err != nil {
+		return fmt.Errorf("failed to merge tag: %w", err)
+	}
+	collisions := make(map[int64]int64)
+	for rows.Next() {
+		var childID, targetID int64
+		if err := rows.Scan(&childID, &targetID); err != nil {
+			rows.Close()
+			return err
+		}
+		collisions[childID] = targetID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for childID, targetID := range collisions {
+		if err := mergeTag(tx, childID, targetID); err != nil {
+			return err
+		}
+	}
+
+	queries := []string{
+		`INSERT OR IGNORE INTO file_tags (file_id, tag_id)
+            SELECT file_id, ? FROM file_tags WHERE tag_id = ?`,
+		`DELETE FROM file_tags WHERE tag_id = ?2`,
+		`UPDATE tags SET parent_id = ?1 WHERE parent_id = ?2`,
+		`INSERT OR IGNORE INTO tag_aliases (tag_id, name)
+            SELECT ?, name FROM tag_aliases WHERE tag_id = ?`,
+		`DELETE FROM tag_aliases WHERE tag_id = ?2`,
+		`DELETE FROM tags WHERE id = ?2`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, toID, fromID); err != nil {
+			return fmt.Errorf("failed to merge tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// tagAliases returns the aliases of every tag in a taxonomy, keyed by tag ID
+func tagAliases(q queryer, taxonomyID int64) (map[int64][]string, error) {
+	rows, err := q.Query(`
+        SELECT a.tag_id, a.name
+        FROM tag_aliases a
+        JOIN tags t ON a.tag_id = t.id
+        WHERE t.taxonomy_id = ?
+        ORDER BY a.name
+    `, taxonomyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := make(map[int64][]string)
+	for rows.Next() {
+		var tagID int64
+		var name string
+		if err := rows.Scan(&tagID, &name); err != nil {
+			return nil, err
+		}
+		aliases[tagID] = append(aliases[tagID], name)
+	}
+	return aliases, rows.Err()
+}
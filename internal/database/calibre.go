@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+)
+
+// CalibreValue is a tag or property that importing a Calibre library applied
+// to a file. Either Taxonomy or Property is set.
+type CalibreValue struct {
+	Taxonomy string
+	Property string
+	Value    string
+}
+
+// GetCalibreApplied returns the values that imports of a Calibre library have
+// applied to a file, ordered by taxonomy, property and value
+func (db *DB) GetCalibreApplied(filePath string) ([]CalibreValue, error) {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT taxonomy, property, value FROM calibre_applied
+        WHERE file_id = ?
+        ORDER BY taxonomy, property, value
+    `, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Calibre values: %w", err)
+	}
+	defer rows.Close()
+
+	var values []CalibreValue
+	for rows.Next() {
+		var v CalibreValue
+		if err := rows.Scan(&v.Taxonomy, &v.Property, &v.Value); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// SetCalibreApplied replaces the values recorded as applied to a file by
+// imports of a Calibre library
+func (db *DB) SetCalibreApplied(filePath string, values []CalibreValue) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM calibre_applied WHERE file_id = ?", fileID); err != nil {
+		return fmt.Errorf("failed to record Calibre values: %w", err)
+	}
+	for _, v := range values {
+		_, err := tx.Exec(`
+            INSERT OR IGNORE INTO calibre_applied (file_id, taxonomy, property, value)
+            VALUES (?, ?, ?, ?)
+        `, fileID, v.Taxonomy, v.Property, v.Value)
+		if err != nil {
+			return fmt.Errorf("failed to record Calibre values: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalibreApplied(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AddFile("eye.epub", ".", "hash", 1, "2024-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	values := []CalibreValue{
+		{Property: "title", Value: "The Eye of the World"},
+		{Taxonomy: "tags", Value: "fantasy"},
+	}
+	if err := db.SetCalibreApplied("eye.epub", values); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetCalibreApplied("eye.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("applied = %v, want %v", got, values)
+	}
+	record, err := db.GetFileRecord("eye.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Properties) != 0 {
+		t.Errorf("properties = %v, want none", record.Properties)
+	}
+
+	if err := db.RemoveFile("eye.epub"); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM calibre_applied").Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d values left after the file was removed", left)
+	}
+}
+
+func TestMigrateCalibreApplied(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AddFile("eye.epub", ".", "hash", 1, "2024-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	err := db.SetProperty("eye.epub", "calibre.applied", `[{"taxonomy":"tags","value":"fantasy"},{"property":"title","value":"The Eye of the World"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetCalibreApplied("eye.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CalibreValue{
+		{Property: "title", Value: "The Eye of the World"},
+		{Taxonomy: "tags", Value: "fantasy"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applied = %v, want %v", got, want)
+	}
+	if properties, err := db.GetProperties("eye.epub"); err != nil || len(properties) != 0 {
+		t.Errorf("properties = %v, %v, want none", properties, err)
+	}
+}
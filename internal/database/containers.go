@@ -0,0 +1,108 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContainerSeparator separates the path of a zip or tar container from the
+// path of a member inside it, as in `bundle.zip!/inner/file.pdf`
+const ContainerSeparator = "!/"
+
+// Member is a file inside a container in the archive
+type Member struct {
+	Name       string // path within the container
+	Hash       string
+	Size       int64
+	ModifiedAt string
+}
+
+// IsContainerMember reports whether a path refers to a file inside a
+// container rather than a file on disk
+func IsContainerMember(filePath string) bool {
+	return strings.Contains(filePath, ContainerSeparator)
+}
+
+// MemberPath returns the archive path of a member of a container
+func MemberPath(containerPath, name string) string {
+	return containerPath + ContainerSeparator + name
+}
+
+// SetContainerMembers records the members of a container file. Existing
+// members keep their tags and properties, and members that are no longer in
+// the container are removed.
+func (db *DB) SetContainerMembers(containerPath string, members []Member) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	containerID, err := fileIDByPath(tx, containerPath)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[int64]bool)
+	for _, m := range members {
+		dir, filename := splitFilePath(MemberPath(containerPath, m.Name))
+		var id int64
+		err := tx.QueryRow(`
+            INSERT INTO files (filename, path, hash, size, modified_at, container_id)
+            VALUES (?, ?, ?, ?, ?, ?)
+            ON CONFLICT(path, filename) DO UPDATE SET
+                hash = excluded.hash,
+                size = excluded.size,
+                modified_at = excluded.modified_at,
+                container_id = excluded.container_id
+            RETURNING id
+        `, filename, dir, m.Hash, m.Size, m.ModifiedAt, containerID).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to add member %s: %w", m.Name, err)
+		}
+		keep[id] = true
+	}
+
+	rows, err := tx.Query(`SELECT id FROM files WHERE container_id = ?`, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to get container members: %w", err)
+	}
+	var stale []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range stale {
+		if err := deleteFile(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteFile removes a file along with its tags and properties
+func deleteFile(q queryer, fileID int64) error {
+	queries := []string{
+		`DELETE FROM file_tags WHERE file_id = ?`,
+		`DELETE FROM properties WHERE file_id = ?`,
+		`DELETE FROM calibre_applied WHERE file_id = ?`,
+		`DELETE FROM files WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := q.Exec(query, fileID); err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateFilePathMovesMembers(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AddFile("bundle.zip", "inbox", "zip", 2, "2024-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	members := []Member{
+		{Name: "a.txt", Hash: "a", Size: 1, ModifiedAt: "2024-01-01 00:00:00"},
+		{Name: "docs/b.txt", Hash: "b", Size: 1, ModifiedAt: "2024-01-01 00:00:00"},
+	}
+	if err := db.SetContainerMembers("inbox/bundle.zip", members); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTaxonomy("genre"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TagFile("inbox/bundle.zip!/docs/b.txt", "genre", "notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateFilePath("inbox/bundle.zip", "archive/bundle.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := db.GetAllFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"archive/bundle.zip", "archive/bundle.zip!/a.txt", "archive/bundle.zip!/docs/b.txt"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+	record, err := db.GetFileRecord("archive/bundle.zip!/docs/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(record.Tags["genre"], []string{"notes"}) {
+		t.Errorf("moved member has genre %v, want notes", record.Tags["genre"])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -31,18 +32,27 @@ func (db *DB) Initialize() error {
             hash TEXT NOT NULL,
             size INTEGER NOT NULL,
             modified_at DATETIME NOT NULL,
+            mime_type TEXT NOT NULL DEFAULT '',
+            kind TEXT NOT NULL DEFAULT '',
+            container_id INTEGER REFERENCES files(id),
+            missing_at DATETIME,
             UNIQUE(path, filename)
         )`,
 		`CREATE TABLE IF NOT EXISTS taxonomies (
             id INTEGER PRIMARY KEY,
-            name TEXT NOT NULL UNIQUE
+            name TEXT NOT NULL UNIQUE,
+            single_valued BOOLEAN NOT NULL DEFAULT 0,
+            closed BOOLEAN NOT NULL DEFAULT 0,
+            value_pattern TEXT NOT NULL DEFAULT '',
+            value_type TEXT NOT NULL DEFAULT 'text'
         )`,
-		`CREATE TABLE IF NOT EXISTS tags (
+		`CREATE TABLE IF NOT EXISTS tags ` + tagsSchema,
+		`CREATE TABLE IF NOT EXISTS tag_aliases (
             id INTEGER PRIMARY KEY,
-            taxonomy_id INTEGER NOT NULL,
+            tag_id INTEGER NOT NULL,
             name TEXT NOT NULL,
-            FOREIGN KEY(taxonomy_id) REFERENCES taxonomies(id),
-            UNIQUE(taxonomy_id, name)
+            FOREIGN KEY(tag_id) REFERENCES tags(id),
+            UNIQUE(tag_id, name)
         )`,
 		`CREATE TABLE IF NOT EXISTS file_tags (
             file_id INTEGER NOT NULL,
@@ -50,10 +60,41 @@ func (db *DB) Initialize() error {
             PRIMARY KEY(file_id, tag_id),
             FOREIGN KEY(file_id) REFERENCES files(id),
             FOREIGN KEY(tag_id) REFERENCES tags(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS properties (
+            file_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL,
+            PRIMARY KEY(file_id, name),
+            FOREIGN KEY(file_id) REFERENCES files(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS calibre_applied (
+            file_id INTEGER NOT NULL,
+            taxonomy TEXT NOT NULL DEFAULT '',
+            property TEXT NOT NULL DEFAULT '',
+            value TEXT NOT NULL,
+            PRIMARY KEY(file_id, taxonomy, property, value),
+            FOREIGN KEY(file_id) REFERENCES files(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS field_mappings (
+            field TEXT PRIMARY KEY,
+            taxonomy_id INTEGER,
+            property TEXT,
+            FOREIGN KEY(taxonomy_id) REFERENCES taxonomies(id)
         )`,
 		`CREATE TABLE IF NOT EXISTS stage_directory (
             id INTEGER PRIMARY KEY,
             path TEXT NOT NULL UNIQUE
+        )`,
+		`CREATE TABLE IF NOT EXISTS saved_searches (
+            name TEXT PRIMARY KEY,
+            query TEXT NOT NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS views (
+            path TEXT PRIMARY KEY,
+            hardlinks BOOLEAN NOT NULL DEFAULT 0,
+            taxonomies TEXT NOT NULL DEFAULT '',
+            searches TEXT NOT NULL DEFAULT ''
         )`,
 		`INSERT OR IGNORE INTO taxonomies (name) VALUES ('tags')`,
 	}
@@ -63,9 +104,151 @@ func (db *DB) Initialize() error {
 			return fmt.Errorf("failed to execute query: %w", err)
 		}
 	}
+	if err := db.migrate(); err != nil {
+		return err
+	}
+
+	// The type taxonomy holds the kind of each file, detected when it's added
+	_, err := db.Exec(`INSERT OR IGNORE INTO taxonomies (name, single_valued) VALUES (?, 1)`, TypeTaxonomy)
+	if err != nil {
+		return fmt.Errorf("failed to create the %s taxonomy: %w", TypeTaxonomy, err)
+	}
+	return nil
+}
+
+// tagsSchema defines the tags table. Tag names are unique among the children
+// of a parent, which the tags_parent_name index enforces.
+const tagsSchema = `(
+            id INTEGER PRIMARY KEY,
+            taxonomy_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            parent_id INTEGER,
+            FOREIGN KEY(taxonomy_id) REFERENCES taxonomies(id),
+            FOREIGN KEY(parent_id) REFERENCES tags(id)
+        )`
+
+// migrations lists columns added after a table was first created, so that
+// databases created by older versions can be upgraded by running `fart init`
+var migrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"tags", "parent_id", "INTEGER REFERENCES tags(id)"},
+	{"taxonomies", "single_valued", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"taxonomies", "closed", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"taxonomies", "value_pattern", "TEXT NOT NULL DEFAULT ''"},
+	{"taxonomies", "value_type", "TEXT NOT NULL DEFAULT 'text'"},
+	{"files", "mime_type", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "kind", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "container_id", "INTEGER REFERENCES files(id)"},
+	{"files", "missing_at", "DATETIME"},
+}
+
+// migrate adds any missing columns to existing tables and rebuilds the ones
+// whose constraints have changed
+func (db *DB) migrate() error {
+	for _, m := range migrations {
+		exists, err := db.columnExists(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	if err := db.migrateTagNames(); err != nil {
+		return err
+	}
+	return db.migrateCalibreApplied()
+}
+
+// migrateCalibreApplied moves the values recorded by Calibre imports from the
+// calibre.applied property, where earlier versions kept them, to their table
+func (db *DB) migrateCalibreApplied() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`INSERT OR IGNORE INTO calibre_applied (file_id, taxonomy, property, value)
+            SELECT p.file_id,
+                IFNULL(json_extract(v.value, '$.taxonomy'), ''),
+                IFNULL(json_extract(v.value, '$.property'), ''),
+                IFNULL(json_extract(v.value, '$.value'), '')
+            FROM properties p, json_each(p.value) v
+            WHERE p.name = 'calibre.applied' AND json_valid(p.value)`,
+		`DELETE FROM properties WHERE name = 'calibre.applied'`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to move Calibre values: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateTagNames rebuilds the tags table of databases where tag names were
+// unique within a taxonomy, rather than among the children of a parent, and
+// creates the index that keeps them unique
+func (db *DB) migrateTagNames() error {
+	var schema string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'tags'").Scan(&schema)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table tags: %w", err)
+	}
+
+	if strings.Contains(schema, "UNIQUE(taxonomy_id, name)") {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		queries := []string{
+			`CREATE TABLE tags_rebuilt ` + tagsSchema,
+			`INSERT INTO tags_rebuilt (id, taxonomy_id, name, parent_id)
+                SELECT id, taxonomy_id, name, parent_id FROM tags`,
+			`DROP TABLE tags`,
+			`ALTER TABLE tags_rebuilt RENAME TO tags`,
+		}
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return fmt.Errorf("failed to rebuild table tags: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS tags_parent_name
+        ON tags (taxonomy_id, IFNULL(parent_id, 0), name)`)
+	if err != nil {
+		return fmt.Errorf("failed to create tag name index: %w", err)
+	}
 	return nil
 }
 
+// columnExists checks whether a table has a column with the given name
+func (db *DB) columnExists(table, column string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)",
+		table, column,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	return exists, nil
+}
+
 // AddFile adds a file to the database
 func (db *DB) AddFile(filename, path, hash string, size int64, modifiedAt string) error {
 	query := `
@@ -74,7 +257,8 @@ func (db *DB) AddFile(filename, path, hash string, size int64, modifiedAt string
         ON CONFLICT(path, filename) DO UPDATE SET
             hash = excluded.hash,
             size = excluded.size,
-            modified_at = excluded.modified_at
+            modified_at = excluded.modified_at,
+            missing_at = NULL
     `
 	_, err := db.Exec(query, filename, path, hash, size, modifiedAt)
 	if err != nil {
@@ -102,22 +286,30 @@ func (db *DB) AddTaxonomy(name string) error {
 	return nil
 }
 
-// TagFile adds a tag to a file
+// TagFile adds a tag to a file. The tag name may be a `/` separated path
+// such as `fiction/fantasy/epic`, in which case the parent tags are created
+// as needed and the file is tagged with the last tag in the path.
 func (db *DB) TagFile(filePath, taxonomyName, tagName string) error {
+	return db.tagFile(filePath, taxonomyName, tagName, false)
+}
+
+// SetFileTag tags a file, replacing any tags it already has in the taxonomy
+func (db *DB) SetFileTag(filePath, taxonomyName, tagName string) error {
+	return db.tagFile(filePath, taxonomyName, tagName, true)
+}
+
+// tagFile links a file to a tag, optionally removing the file's other tags
+// in the same taxonomy
+func (db *DB) tagFile(filePath, taxonomyName, tagName string, replace bool) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Get path components
-	filename := filepath.Base(filePath)
-
-	// Get file ID using path components
-	var fileID int64
-	err = tx.QueryRow("SELECT id FROM files WHERE path = ? AND filename = ?", "players", filename).Scan(&fileID)
+	fileID, err := fileIDByPath(tx, filePath)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return err
 	}
 
 	// Get or create taxonomy
@@ -131,16 +323,21 @@ func (db *DB) TagFile(filePath, taxonomyName, tagName string) error {
 		return fmt.Errorf("failed to get/create taxonomy: %w", err)
 	}
 
-	// Insert or get tag
-	var tagID int64
-	err = tx.QueryRow(`
-        INSERT INTO tags (taxonomy_id, name) 
-        VALUES (?, ?)
-        ON CONFLICT(taxonomy_id, name) DO UPDATE SET name = excluded.name
-        RETURNING id
-    `, taxonomyID, tagName).Scan(&tagID)
+	// Insert or get tag, including any parents
+	tagID, err := ensureTagPath(tx, taxonomyID, tagName)
 	if err != nil {
-		return fmt.Errorf("failed to create/get tag: %w", err)
+		return err
+	}
+
+	if replace {
+		_, err = tx.Exec(`
+            DELETE FROM file_tags
+            WHERE file_id = ? AND tag_id != ?
+            AND tag_id IN (SELECT id FROM tags WHERE taxonomy_id = ?)
+        `, fileID, tagID, taxonomyID)
+		if err != nil {
+			return fmt.Errorf("failed to replace tags: %w", err)
+		}
 	}
 
 	// Link file to tag
@@ -156,17 +353,37 @@ func (db *DB) TagFile(filePath, taxonomyName, tagName string) error {
 	return tx.Commit()
 }
 
-// SearchByTag returns all files with a specific tag
+// SearchByTag returns all files with a specific tag or any of its
+// descendants, leaving out files marked missing
 func (db *DB) SearchByTag(taxonomyName, tagName string) ([]string, error) {
+	taxonomyID, err := taxonomyIDByName(db, taxonomyName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tagID, err := findTagPath(db, taxonomyID, tagName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-        SELECT f.path || '/' || f.filename
+        WITH RECURSIVE subtree(id) AS (
+            SELECT ?
+            UNION
+            SELECT t.id FROM tags t JOIN subtree s ON t.parent_id = s.id
+        )
+        SELECT DISTINCT f.path || '/' || f.filename
         FROM files f
         JOIN file_tags ft ON f.id = ft.file_id
-        JOIN tags t ON ft.tag_id = t.id
-        JOIN taxonomies tax ON t.taxonomy_id = tax.id
-        WHERE tax.name = ? AND t.name = ?
+        WHERE ft.tag_id IN (SELECT id FROM subtree) AND f.missing_at IS NULL
     `
-	rows, err := db.Query(query, taxonomyName, tagName)
+	rows, err := db.Query(query, tagID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search files: %w", err)
 	}
@@ -183,10 +400,14 @@ func (db *DB) SearchByTag(taxonomyName, tagName string) ([]string, error) {
 	return files, nil
 }
 
-// GetFilePathByHash returns the filepath of a file with the given hash
+// GetFilePathByHash returns the filepath of a file with the given hash,
+// preferring files stored directly in the archive over container members
 func (db *DB) GetFilePathByHash(hash string) (string, error) {
 	var path, filename string
-	err := db.QueryRow("SELECT path, filename FROM files WHERE hash = ?", hash).Scan(&path, &filename)
+	err := db.QueryRow(`
+        SELECT path, filename FROM files WHERE hash = ?
+        ORDER BY container_id IS NOT NULL, id LIMIT 1
+    `, hash).Scan(&path, &filename)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
@@ -197,6 +418,29 @@ func (db *DB) GetFilePathByHash(hash string) (string, error) {
 	return filepath.Join(path, filename), nil
 }
 
+// GetFilePathsBySize returns the paths of the files stored directly in the
+// archive that have the given size
+func (db *DB) GetFilePathsBySize(size int64) ([]string, error) {
+	rows, err := db.Query(`
+        SELECT path, filename FROM files
+        WHERE size = ? AND container_id IS NULL ORDER BY id
+    `, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var path, filename string
+		if err := rows.Scan(&path, &filename); err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.Join(path, filename))
+	}
+	return files, rows.Err()
+}
+
 // GetAllFiles returns all file paths in the database
 func (db *DB) GetAllFiles() ([]string, error) {
     query := `SELECT path || '/' || filename FROM files`
@@ -217,38 +461,82 @@ func (db *DB) GetAllFiles() ([]string, error) {
     return files, nil
 }
 
-// UpdateFilePath updates a file's path in the database
+// UpdateFilePath updates a file's path in the database, and the paths of
+// its members if it is a container
 func (db *DB) UpdateFilePath(oldPath, newPath string) error {
-	oldDir := filepath.Dir(oldPath)
-	oldName := filepath.Base(oldPath)
-	newDir := filepath.Dir(newPath)
-	newName := filepath.Base(newPath)
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	oldDir, oldName := splitFilePath(oldPath)
+	newDir, newName := splitFilePath(newPath)
 
-	if oldDir == "." {
-		oldDir = ""
-	}
-	if newDir == "." {
-		newDir = ""
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	query := `
+	var fileID int64
+	err = tx.QueryRow(`
 		UPDATE files 
-		SET filename = ?, path = ?
+		SET filename = ?, path = ?, missing_at = NULL
 		WHERE filename = ? AND path = ?
-	`
-	result, err := db.Exec(query, newName, newDir, oldName, oldDir)
+		RETURNING id
+	`, newName, newDir, oldName, oldDir).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no file found with path: %s", oldPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update file path: %w", err)
 	}
 
-	rows, err := result.RowsAffected()
+	// Members are stored as container!/inner, so they move with it
+	_, err = tx.Exec(`
+		UPDATE files
+		SET path = ? || substr(path, length(?) + 1), missing_at = NULL
+		WHERE container_id = ?
+	`, newPath, oldPath, fileID)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to update container member paths: %w", err)
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("no file found with path: %s", oldPath)
+	return tx.Commit()
+}
+
+// RemoveFile removes a file from the database along with its tags and
+// properties, and the members of a container with it
+func (db *DB) RemoveFile(filePath string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
+	fileID, err := fileIDByPath(tx, filePath)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id FROM files WHERE container_id = ?`, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to get container members: %w", err)
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range append(ids, fileID) {
+		if err := deleteFile(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
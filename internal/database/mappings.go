@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// FieldMapping says where an extracted metadata field is stored: as tags of
+// a taxonomy, as a property, or not at all when both are empty
+type FieldMapping struct {
+	Field    string
+	Taxonomy string
+	Property string
+}
+
+// SetFieldMapping stores where an extracted metadata field is written to. The
+// taxonomy is created if it does not exist.
+func (db *DB) SetFieldMapping(m FieldMapping) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taxonomyID, property any
+	if m.Taxonomy != "" {
+		var id int64
+		err = tx.QueryRow(`
+            INSERT INTO taxonomies (name)
+            VALUES (?)
+            ON CONFLICT(name) DO UPDATE SET name = excluded.name
+            RETURNING id`, m.Taxonomy).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to get/create taxonomy: %w", err)
+		}
+		taxonomyID = id
+	} else if m.Property != "" {
+		property = m.Property
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO field_mappings (field, taxonomy_id, property)
+        VALUES (?, ?, ?)
+        ON CONFLICT(field) DO UPDATE SET
+            taxonomy_id = excluded.taxonomy_id,
+            property = excluded.property
+    `, m.Field, taxonomyID, property)
+	if err != nil {
+		return fmt.Errorf("failed to set field mapping: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RemoveFieldMapping removes a stored field mapping, reverting the field to
+// its default
+func (db *DB) RemoveFieldMapping(field string) error {
+	result, err := db.Exec("DELETE FROM field_mappings WHERE field = ?", field)
+	if err != nil {
+		return fmt.Errorf("failed to remove field mapping: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("no mapping for field: %s", field)
+	}
+	return nil
+}
+
+// GetFieldMappings returns the stored field mappings keyed by field
+func (db *DB) GetFieldMappings() (map[string]FieldMapping, error) {
+	rows, err := db.Query(`
+        SELECT m.field, tax.name, m.property
+        FROM field_mappings m
+        LEFT JOIN taxonomies tax ON m.taxonomy_id = tax.id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query field mappings: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := make(map[string]FieldMapping)
+	for rows.Next() {
+		var m FieldMapping
+		var taxonomy, property sql.NullString
+		if err := rows.Scan(&m.Field, &taxonomy, &property); err != nil {
+			return nil, err
+		}
+		m.Taxonomy, m.Property = taxonomy.String, property.String
+		mappings[m.Field] = m
+	}
+	return mappings, rows.Err()
+}
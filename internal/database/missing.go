@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// MarkFileMissing records that a file has gone from the disk, keeping its
+// tags and properties in case it comes back. The members of a container are
+// marked with it.
+func (db *DB) MarkFileMissing(filePath string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+        UPDATE files SET missing_at = ?
+        WHERE (id = ? OR container_id = ?) AND missing_at IS NULL
+    `, time.Now().UTC().Format(time.RFC3339), fileID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to mark file missing: %w", err)
+	}
+	return nil
+}
+
+// GetMissingFileByHash returns the path of a file marked missing that has
+// the given hash, the most recently missed first, or "" if there is none
+func (db *DB) GetMissingFileByHash(hash string) (string, error) {
+	var path, filename string
+	err := db.QueryRow(`
+        SELECT path, filename FROM files
+        WHERE hash = ? AND missing_at IS NOT NULL AND container_id IS NULL
+        ORDER BY missing_at DESC, id LIMIT 1
+    `, hash).Scan(&path, &filename)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query missing files: %w", err)
+	}
+	return filepath.Join(path, filename), nil
+}
+
+// GetPresentFiles returns the paths of the files that aren't marked missing,
+// like GetAllFiles does for every file
+func (db *DB) GetPresentFiles() ([]string, error) {
+	rows, err := db.Query("SELECT path || '/' || filename FROM files WHERE missing_at IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingFilesLeftOut(t *testing.T) {
+	db := newTestDB(t)
+	for _, name := range []string{"eye.epub", "hunt.epub"} {
+		if err := db.AddFile(name, "books", name, 1, "2024-01-01 00:00:00"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.TagFile("books/"+name, "tags", "fantasy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.MarkFileMissing("books/hunt.epub"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"books/eye.epub"}
+	found, err := db.Search(SearchOptions{Filters: []Filter{{Taxonomy: "tags", Op: "=", Value: "fantasy"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Search = %v, want %v", found, want)
+	}
+	if found, err = db.SearchByTag("tags", "fantasy"); err != nil || !reflect.DeepEqual(found, want) {
+		t.Errorf("SearchByTag = %v, %v, want %v", found, err, want)
+	}
+	if found, err = db.GetPresentFiles(); err != nil || !reflect.DeepEqual(found, want) {
+		t.Errorf("GetPresentFiles = %v, %v, want %v", found, err, want)
+	}
+	if all, err := db.GetAllFiles(); err != nil || len(all) != 2 {
+		t.Errorf("GetAllFiles = %v, %v, want both files", all, err)
+	}
+}
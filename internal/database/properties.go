@@ -0,0 +1,271 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// FileRecord is a file along with all of its metadata
+type FileRecord struct {
+	Path       string              `json:"path"`
+	Hash       string              `json:"hash"`
+	Size       int64               `json:"size"`
+	ModifiedAt string              `json:"modified_at"`
+	MissingAt  string              `json:"missing_at,omitempty"` // when the file was found gone from the disk
+	Tags       map[string][]string `json:"tags"`                 // taxonomy name to tag paths
+	Properties map[string]string   `json:"properties"`           // property name to value
+}
+
+// SetProperty sets a property of a file, replacing any previous value
+func (db *DB) SetProperty(filePath, name, value string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO properties (file_id, name, value)
+        VALUES (?, ?, ?)
+        ON CONFLICT(file_id, name) DO UPDATE SET value = excluded.value
+    `, fileID, name, value)
+	if err != nil {
+		return fmt.Errorf("failed to set property: %w", err)
+	}
+	return nil
+}
+
+// UnsetProperty removes a property from a file
+func (db *DB) UnsetProperty(filePath, name string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec("DELETE FROM properties WHERE file_id = ? AND name = ?", fileID, name)
+	if err != nil {
+		return fmt.Errorf("failed to unset property: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%s has no property %s", filePath, name)
+	}
+	return nil
+}
+
+// GetProperties returns all properties of a file
+func (db *DB) GetProperties(filePath string) (map[string]string, error) {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return nil, err
+	}
+	properties, err := fileProperties(db, []int64{fileID})
+	if err != nil {
+		return nil, err
+	}
+	if properties[fileID] == nil {
+		return make(map[string]string), nil
+	}
+	return properties[fileID], nil
+}
+
+// ClearFileMetadata removes all tags and properties from a file
+func (db *DB) ClearFileMetadata(filePath string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		`DELETE FROM file_tags WHERE file_id = ?`,
+		`DELETE FROM properties WHERE file_id = ?`,
+		`DELETE FROM calibre_applied WHERE file_id = ?`,
+	} {
+		if _, err := db.Exec(query, fileID); err != nil {
+			return fmt.Errorf("failed to clear file metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetFileRecord returns a file with its tags and properties
+func (db *DB) GetFileRecord(filePath string) (*FileRecord, error) {
+	records, err := db.GetFileRecords([]string{filePath})
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// GetFileRecords returns files with their tags and properties, in the order
+// they are given. The files are read with a few queries, however many there
+// are.
+func (db *DB) GetFileRecords(filePaths []string) ([]*FileRecord, error) {
+	keys := make([][2]string, len(filePaths))
+	for i, filePath := range filePaths {
+		keys[i][0], keys[i][1] = splitFilePath(filePath)
+	}
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT f.id, f.path, f.filename, f.hash, f.size, f.modified_at, f.missing_at
+        FROM json_each(?) k
+        JOIN files f ON f.path = json_extract(k.value, '$[0]') AND f.filename = json_extract(k.value, '$[1]')
+    `, string(keysJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up files: %w", err)
+	}
+	byPath := make(map[string]*FileRecord, len(filePaths))
+	idByPath := make(map[string]int64, len(filePaths))
+	var fileIDs []int64
+	for rows.Next() {
+		var fileID int64
+		var dir, filename string
+		var record FileRecord
+		var missingAt sql.NullString
+		if err := rows.Scan(&fileID, &dir, &filename, &record.Hash, &record.Size, &record.ModifiedAt, &missingAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		record.Path = filepath.Join(dir, filename)
+		record.MissingAt = missingAt.String
+		byPath[record.Path] = &record
+		idByPath[record.Path] = fileID
+		fileIDs = append(fileIDs, fileID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up files: %w", err)
+	}
+
+	tags, err := fileTags(db, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	properties, err := fileProperties(db, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	for path, record := range byPath {
+		fileID := idByPath[path]
+		if record.Tags = tags[fileID]; record.Tags == nil {
+			record.Tags = make(map[string][]string)
+		}
+		if record.Properties = properties[fileID]; record.Properties == nil {
+			record.Properties = make(map[string]string)
+		}
+	}
+
+	records := make([]*FileRecord, len(filePaths))
+	for i, filePath := range filePaths {
+		if records[i] = byPath[filepath.Join(keys[i][0], keys[i][1])]; records[i] == nil {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+	}
+	return records, nil
+}
+
+// fileIDsJSON returns file IDs as a JSON array, for queries to read with
+// json_each
+func fileIDsJSON(fileIDs []int64) (string, error) {
+	data, err := json.Marshal(fileIDs)
+	return string(data), err
+}
+
+// fileTags returns the full hierarchical path of each of the tags of some
+// files, grouped by taxonomy, keyed by file ID
+func fileTags(q queryer, fileIDs []int64) (map[int64]map[string][]string, error) {
+	ids, err := fileIDsJSON(fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The levels are collected as a JSON array, from the tag up to the top,
+	// so that they can be escaped before they are joined
+	rows, err := q.Query(`
+        WITH RECURSIVE chain(file_id, tag_id, ancestor_id, path) AS (
+            SELECT ft.file_id, t.id, t.parent_id, json_array(t.name)
+            FROM tags t JOIN file_tags ft ON ft.tag_id = t.id
+            WHERE ft.file_id IN (SELECT value FROM json_each(?))
+            UNION ALL
+            SELECT c.file_id, c.tag_id, p.parent_id, json_insert(c.path, '$[#]', p.name)
+            FROM chain c JOIN tags p ON p.id = c.ancestor_id
+        )
+        SELECT c.file_id, tax.name, c.path
+        FROM chain c
+        JOIN tags t ON t.id = c.tag_id
+        JOIN taxonomies tax ON tax.id = t.taxonomy_id
+        WHERE c.ancestor_id IS NULL
+    `, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int64]map[string][]string)
+	for rows.Next() {
+		var fileID int64
+		var taxonomy, path string
+		if err := rows.Scan(&fileID, &taxonomy, &path); err != nil {
+			return nil, err
+		}
+		var names []string
+		if err := json.Unmarshal([]byte(path), &names); err != nil {
+			return nil, fmt.Errorf("failed to read tag path: %w", err)
+		}
+		slices.Reverse(names)
+		if tags[fileID] == nil {
+			tags[fileID] = make(map[string][]string)
+		}
+		tags[fileID][taxonomy] = append(tags[fileID][taxonomy], JoinTagPath(names))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, byTaxonomy := range tags {
+		for _, paths := range byTaxonomy {
+			sort.Strings(paths)
+		}
+	}
+	return tags, nil
+}
+
+// fileProperties returns the properties of some files, keyed by file ID
+func fileProperties(q queryer, fileIDs []int64) (map[int64]map[string]string, error) {
+	ids, err := fileIDsJSON(fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+        SELECT file_id, name, value FROM properties
+        WHERE file_id IN (SELECT value FROM json_each(?))
+    `, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file properties: %w", err)
+	}
+	defer rows.Close()
+
+	properties := make(map[int64]map[string]string)
+	for rows.Next() {
+		var fileID int64
+		var name, value string
+		if err := rows.Scan(&fileID, &name, &value); err != nil {
+			return nil, err
+		}
+		if properties[fileID] == nil {
+			properties[fileID] = make(map[string]string)
+		}
+		properties[fileID][name] = value
+	}
+	return properties, rows.Err()
+}
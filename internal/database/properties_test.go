@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetFileRecords(t *testing.T) {
+	db := newTestDB(t)
+	for _, name := range []string{"eye.epub", "hunt.epub", "notes.txt"} {
+		if err := db.AddFile(name, "books", name, 1, "2024-01-01 00:00:00"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.TagFile("books/eye.epub", "tags", "fiction/fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetProperty("books/hunt.epub", "title", "The Great Hunt"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := db.GetFileRecords([]string{"books/hunt.epub", "./books/eye.epub", "books/notes.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, record := range records {
+		paths = append(paths, record.Path)
+	}
+	if want := []string{"books/hunt.epub", "books/eye.epub", "books/notes.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	for _, record := range records {
+		single, err := db.GetFileRecord(record.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(record, single) {
+			t.Errorf("GetFileRecords gave %+v, GetFileRecord %+v", record, single)
+		}
+	}
+	if records[2].Tags == nil || records[2].Properties == nil {
+		t.Errorf("a file without tags or properties has nil maps: %+v", records[2])
+	}
+
+	if _, err := db.GetFileRecords([]string{"books/eye.epub", "books/gone.epub"}); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("reading a file that isn't there = %v, want ErrFileNotFound", err)
+	}
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Filter is a condition on the tags of a taxonomy, a property or the type of
+// a file, that files must match
+type Filter struct {
+	Taxonomy  string
+	Property  string // set instead of Taxonomy for property filters
+	Attribute string // set instead of Taxonomy for file type filters, AttrMIMEType or AttrKind
+	ValueType string // how values are compared, one of the Type constants
+	// Op is "=", "<", "<=", ">", ">=" or ".." for an inclusive range.
+	// Property filters support "=", "~" for contains and "?" for exists.
+	Op     string
+	Value  string // canonical value, or the lower bound of a range
+	Value2 string // upper bound of a range
+}
+
+// SearchOptions describes a search over the files in the archive
+type SearchOptions struct {
+	Filters      []Filter
+	SortTaxonomy string
+	SortType     string
+	SortDesc     bool
+}
+
+// valueExpr wraps a tag value expression so that it compares according to
+// the taxonomy's value type
+func valueExpr(valueType, expr string) string {
+	switch valueType {
+	case TypeInt, TypeFloat:
+		return "CAST(" + expr + " AS REAL)"
+	case TypeDate:
+		return "julianday(" + expr + ")"
+	case TypeBool:
+		return "(" + expr + " = 'true')"
+	default:
+		return expr
+	}
+}
+
+// Search returns the files that match every filter. Equality filters match
+// the tag, its aliases and its descendants. Files marked missing are left out.
+func (db *DB) Search(opts SearchOptions) ([]string, error) {
+	where := []string{"f.missing_at IS NULL"}
+	var args []any
+
+	for _, f := range opts.Filters {
+		if f.Attribute != "" {
+			condition, err := attributeCondition(f)
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, condition)
+			args = append(args, f.Value)
+			continue
+		}
+
+		if f.Property != "" {
+			condition, err := propertyCondition(f)
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, condition)
+			args = append(args, f.Property)
+			if f.Op != "?" {
+				args = append(args, f.Value)
+			}
+			continue
+		}
+
+		taxonomyID, err := taxonomyIDByName(db, f.Taxonomy)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Op == "=" {
+			tagID, err := findTagPath(db, taxonomyID, f.Value)
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, `f.id IN (
+                WITH RECURSIVE subtree(id) AS (
+                    SELECT ?
+                    UNION
+                    SELECT t.id FROM tags t JOIN subtree s ON t.parent_id = s.id
+                )
+                SELECT file_id FROM file_tags WHERE tag_id IN (SELECT id FROM subtree)
+            )`)
+			args = append(args, tagID)
+			continue
+		}
+
+		value := valueExpr(f.ValueType, "t.name")
+		var conditions []string
+		switch f.Op {
+		case "<", "<=", ">", ">=":
+			conditions = append(conditions, value+" "+f.Op+" "+valueExpr(f.ValueType, "?"))
+			args = append(args, taxonomyID, f.Value)
+		case "..":
+			args = append(args, taxonomyID)
+			if f.Value != "" {
+				conditions = append(conditions, value+" >= "+valueExpr(f.ValueType, "?"))
+				args = append(args, f.Value)
+			}
+			if f.Value2 != "" {
+				conditions = append(conditions, value+" <= "+valueExpr(f.ValueType, "?"))
+				args = append(args, f.Value2)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported search operator: %s", f.Op)
+		}
+		where = append(where, `f.id IN (
+                SELECT ft.file_id FROM file_tags ft
+                JOIN tags t ON ft.tag_id = t.id
+                WHERE t.taxonomy_id = ? AND `+strings.Join(conditions, " AND ")+`
+            )`)
+	}
+
+	query := "SELECT f.path || '/' || f.filename FROM files f WHERE " + strings.Join(where, " AND ")
+
+	query += " ORDER BY "
+	if opts.SortTaxonomy != "" {
+		aggregate, direction := "MIN", "ASC"
+		if opts.SortDesc {
+			aggregate, direction = "MAX", "DESC"
+		}
+		query += `(
+            SELECT ` + aggregate + `(` + valueExpr(opts.SortType, "t.name") + `)
+            FROM file_tags ft
+            JOIN tags t ON ft.tag_id = t.id
+            JOIN taxonomies tax ON t.taxonomy_id = tax.id
+            WHERE ft.file_id = f.id AND tax.name = ?
+        ) ` + direction + ` NULLS LAST, `
+		args = append(args, opts.SortTaxonomy)
+	}
+	query += "f.path, f.filename"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// propertyCondition returns the SQL condition for a property filter, which
+// takes the property name and, unless it is an existence check, the value
+func propertyCondition(f Filter) (string, error) {
+	var match string
+	switch f.Op {
+	case "=":
+		match = " AND value = ?"
+	case "~":
+		match = " AND instr(lower(value), lower(?)) > 0"
+	case "?":
+	default:
+		return "", fmt.Errorf("unsupported property search operator: %s", f.Op)
+	}
+	return "f.id IN (SELECT file_id FROM properties WHERE name = ?" + match + ")", nil
+}
+
+// attributeCondition returns the SQL condition for a file type filter, which
+// takes a glob pattern such as "image/*"
+func attributeCondition(f Filter) (string, error) {
+	if f.Op != "=" {
+		return "", fmt.Errorf("unsupported file type search operator: %s", f.Op)
+	}
+	switch f.Attribute {
+	case AttrMIMEType, AttrKind:
+		return "f." + f.Attribute + " GLOB ?", nil
+	}
+	return "", fmt.Errorf("unknown file attribute: %s", f.Attribute)
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SavedSearch is a search stored under a name, written as a single string
+// as query.Split reads it
+type SavedSearch struct {
+	Name  string
+	Query string
+}
+
+// SaveSearch stores a search under a name, replacing any search saved under
+// it before
+func (db *DB) SaveSearch(name, search string) error {
+	_, err := db.Exec(`
+        INSERT INTO saved_searches (name, query)
+        VALUES (?, ?)
+        ON CONFLICT(name) DO UPDATE SET query = excluded.query
+    `, name, search)
+	if err != nil {
+		return fmt.Errorf("failed to save search: %w", err)
+	}
+	return nil
+}
+
+// GetSavedSearch returns the search saved under a name, or "" if there is
+// none
+func (db *DB) GetSavedSearch(name string) (string, error) {
+	var search string
+	err := db.QueryRow("SELECT query FROM saved_searches WHERE name = ?", name).Scan(&search)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get saved search: %w", err)
+	}
+	return search, nil
+}
+
+// GetSavedSearches returns all saved searches ordered by name
+func (db *DB) GetSavedSearches() ([]SavedSearch, error) {
+	rows, err := db.Query("SELECT name, query FROM saved_searches ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	var searches []SavedSearch
+	for rows.Next() {
+		var s SavedSearch
+		if err := rows.Scan(&s.Name, &s.Query); err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+// RemoveSavedSearch removes a saved search
+func (db *DB) RemoveSavedSearch(name string) error {
+	result, err := db.Exec("DELETE FROM saved_searches WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("failed to remove saved search: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no saved search named %s", name)
+	}
+	return nil
+}
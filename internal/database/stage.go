@@ -0,0 +1,37 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetStageDirectory sets the directory new files are staged in before they
+// are added to the archive, replacing any previous one
+func (db *DB) SetStageDirectory(path string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM stage_directory"); err != nil {
+		return fmt.Errorf("failed to set stage directory: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO stage_directory (path) VALUES (?)", path); err != nil {
+		return fmt.Errorf("failed to set stage directory: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetStageDirectory returns the stage directory, or "" if none is set
+func (db *DB) GetStageDirectory() (string, error) {
+	var path string
+	err := db.QueryRow("SELECT path FROM stage_directory ORDER BY id DESC LIMIT 1").Scan(&path)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get stage directory: %w", err)
+	}
+	return path, nil
+}
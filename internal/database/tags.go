@@ -0,0 +1,481 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TagPathSeparator separates the levels of a hierarchical tag name
+const TagPathSeparator = "/"
+
+// TagNode is a tag within a taxonomy's hierarchy
+type TagNode struct {
+	ID       int64
+	ParentID int64 // 0 for top-level tags
+	Name     string
+	Count    int // files tagged with this tag or any of its descendants
+	Aliases  []string
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// splitFilePath splits an archive-relative file path into the directory and
+// filename columns of the files table
+func splitFilePath(filePath string) (string, string) {
+	return filepath.Dir(filePath), filepath.Base(filePath)
+}
+
+// SplitTagPath splits a hierarchical tag name into its non-empty levels. A
+// separator preceded by a backslash, as in `AC\/DC`, is part of the name.
+// Other backslashes are kept as they are, except that a pair of them before a
+// separator or at the end of the name stands for a single one.
+func SplitTagPath(tagPath string) []string {
+	var names []string
+	var name strings.Builder
+	flush := func() {
+		if n := strings.TrimSpace(name.String()); n != "" {
+			names = append(names, n)
+		}
+		name.Reset()
+	}
+
+	for i := 0; i < len(tagPath); i++ {
+		switch {
+		case tagPath[i] == '\\':
+			end := i
+			for end < len(tagPath) && tagPath[end] == '\\' {
+				end++
+			}
+			run := end - i
+			switch {
+			case end < len(tagPath) && !strings.HasPrefix(tagPath[end:], TagPathSeparator):
+				name.WriteString(tagPath[i:end])
+			case run%2 == 0:
+				name.WriteString(strings.Repeat(`\`, run/2))
+			case end < len(tagPath):
+				name.WriteString(strings.Repeat(`\`, run/2) + TagPathSeparator)
+				end += len(TagPathSeparator)
+			default:
+				name.WriteString(strings.Repeat(`\`, run/2+1))
+			}
+			i = end - 1
+		case strings.HasPrefix(tagPath[i:], TagPathSeparator):
+			flush()
+		default:
+			name.WriteByte(tagPath[i])
+		}
+	}
+	flush()
+	return names
+}
+
+// EscapeTagName escapes a tag name so that it is a single level of a
+// hierarchical tag name
+func EscapeTagName(name string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\':
+			end := i
+			for end < len(name) && name[end] == '\\' {
+				end++
+			}
+			escaped.WriteString(name[i:end])
+			if end == len(name) || strings.HasPrefix(name[end:], TagPathSeparator) {
+				escaped.WriteString(name[i:end])
+			}
+			i = end - 1
+		case strings.HasPrefix(name[i:], TagPathSeparator):
+			escaped.WriteString(`\` + TagPathSeparator)
+			i += len(TagPathSeparator) - 1
+		default:
+			escaped.WriteByte(name[i])
+		}
+	}
+	return escaped.String()
+}
+
+// JoinTagPath joins the levels of a hierarchical tag name, escaping each one
+func JoinTagPath(names []string) string {
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = EscapeTagName(name)
+	}
+	return strings.Join(escaped, TagPathSeparator)
+}
+
+// ErrFileNotFound is returned when a path is not in the database
+var ErrFileNotFound = errors.New("file not found")
+
+// fileIDByPath looks up a file's ID from its archive-relative path
+func fileIDByPath(q queryer, filePath string) (int64, error) {
+	dir, filename := splitFilePath(filePath)
+
+	var fileID int64
+	err := q.QueryRow("SELECT id FROM files WHERE path = ? AND filename = ?", dir, filename).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up file: %w", err)
+	}
+	return fileID, nil
+}
+
+// taxonomyIDByName looks up a taxonomy's ID, returning sql.ErrNoRows if it
+// does not exist
+func taxonomyIDByName(q queryer, name string) (int64, error) {
+	var taxonomyID int64
+	err := q.QueryRow("SELECT id FROM taxonomies WHERE name = ?", name).Scan(&taxonomyID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to look up taxonomy: %w", err)
+	}
+	return taxonomyID, err
+}
+
+// requireTaxonomy looks up a taxonomy's ID, returning an error if it does not exist
+func requireTaxonomy(q queryer, name string) (int64, error) {
+	taxonomyID, err := taxonomyIDByName(q, name)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("taxonomy not found: %s", name)
+	}
+	return taxonomyID, err
+}
+
+// lookupChild finds a tag among the children of a parent, or among the
+// top-level tags if parentID is 0, by its name or one of its aliases.
+// Returns sql.ErrNoRows if there is no match.
+func lookupChild(q queryer, taxonomyID, parentID int64, name string) (int64, error) {
+	var tagID int64
+	err := q.QueryRow(`
+        SELECT id FROM tags
+        WHERE taxonomy_id = ?1 AND IFNULL(parent_id, 0) = ?2 AND name = ?3
+        UNION ALL
+        SELECT t.id FROM tag_aliases a
+        JOIN tags t ON a.tag_id = t.id
+        WHERE t.taxonomy_id = ?1 AND IFNULL(t.parent_id, 0) = ?2 AND a.name = ?3
+        LIMIT 1
+    `, taxonomyID, parentID, name).Scan(&tagID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to look up tag: %w", err)
+	}
+	return tagID, err
+}
+
+// resolveTagName finds the tag that the first level of a hierarchical tag
+// name refers to: the top-level tag with the name or alias, or else the only
+// tag anywhere in the hierarchy with it. A name that several nested tags share
+// is ambiguous and has to be given with its parents. Returns sql.ErrNoRows if
+// there is no match.
+func resolveTagName(q queryer, taxonomyID int64, name string) (int64, error) {
+	tagID, err := lookupChild(q, taxonomyID, 0, name)
+	if err != sql.ErrNoRows {
+		return tagID, err
+	}
+
+	rows, err := q.Query(`
+        SELECT id FROM tags WHERE taxonomy_id = ?1 AND name = ?2
+        UNION
+        SELECT t.id FROM tag_aliases a
+        JOIN tags t ON a.tag_id = t.id
+        WHERE t.taxonomy_id = ?1 AND a.name = ?2
+        ORDER BY 1
+    `, taxonomyID, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up tag: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		if err := rows.Scan(&tagID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, tagID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], nil
+	}
+	paths := make([]string, len(ids))
+	for i, id := range ids {
+		if paths[i], err = tagPathByID(q, id); err != nil {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("tag %q is ambiguous, it could be any of %s", name, strings.Join(paths, ", "))
+}
+
+// lookupFirstLevel finds the tag that the first level of a hierarchical tag
+// name refers to. A name that starts with the separator is taken from the top
+// level, any other is resolved by resolveTagName.
+func lookupFirstLevel(q queryer, taxonomyID int64, tagPath, name string) (int64, error) {
+	if strings.HasPrefix(strings.TrimSpace(tagPath), TagPathSeparator) {
+		return lookupChild(q, taxonomyID, 0, name)
+	}
+	return resolveTagName(q, taxonomyID, name)
+}
+
+// tagPathByID returns the full path of a tag
+func tagPathByID(q queryer, tagID int64) (string, error) {
+	var names []string
+	for id := tagID; id != 0; {
+		var name string
+		var parent sql.NullInt64
+		err := q.QueryRow("SELECT name, parent_id FROM tags WHERE id = ?", id).Scan(&name, &parent)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up tag: %w", err)
+		}
+		names = append([]string{name}, names...)
+		id = parent.Int64
+	}
+	return JoinTagPath(names), nil
+}
+
+// inSubtree reports whether a tag is the root of a subtree or one of its
+// descendants
+func inSubtree(q queryer, rootID, tagID int64) (bool, error) {
+	var found bool
+	err := q.QueryRow(`
+        WITH RECURSIVE subtree(id) AS (
+            SELECT ?
+            UNION
+            SELECT t.id FROM tags t JOIN subtree s ON t.parent_id = s.id
+        )
+        SELECT EXISTS(SELECT 1 FROM subtree WHERE id = ?)
+    `, rootID, tagID).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("failed to check tag hierarchy: %w", err)
+	}
+	return found, nil
+}
+
+// findTagPath resolves a hierarchical tag name to the ID of its last level.
+// The first level is found by lookupFirstLevel, each following level must be a
+// child of the one before. Returns sql.ErrNoRows if there is no match.
+func findTagPath(q queryer, taxonomyID int64, tagPath string) (int64, error) {
+	names := SplitTagPath(tagPath)
+	if len(names) == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	tagID, err := lookupFirstLevel(q, taxonomyID, tagPath, names[0])
+	for _, name := range names[1:] {
+		if err != nil {
+			break
+		}
+		tagID, err = lookupChild(q, taxonomyID, tagID, name)
+	}
+	return tagID, err
+}
+
+// ensureTagPath creates any missing levels of a hierarchical tag name and
+// returns the ID of the last level. An existing top-level tag is adopted by
+// the parent named before it, unless it is one of the parent's ancestors, but
+// a tag is never silently moved from one parent to another.
+func ensureTagPath(q queryer, taxonomyID int64, tagPath string) (int64, error) {
+	names := SplitTagPath(tagPath)
+	if len(names) == 0 {
+		return 0, fmt.Errorf("tag name cannot be empty")
+	}
+
+	var tagID, parentID int64
+	for i, name := range names {
+		var err error
+		if i == 0 {
+			tagID, err = lookupFirstLevel(q, taxonomyID, tagPath, name)
+		} else if tagID, err = lookupChild(q, taxonomyID, parentID, name); err == sql.ErrNoRows {
+			tagID, err = adoptTag(q, taxonomyID, parentID, name)
+		}
+
+		switch {
+		case err == sql.ErrNoRows:
+			var parentArg any
+			if i > 0 {
+				parentArg = parentID
+			}
+			err = q.QueryRow(
+				"INSERT INTO tags (taxonomy_id, name, parent_id) VALUES (?, ?, ?) RETURNING id",
+				taxonomyID, name, parentArg,
+			).Scan(&tagID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to create tag: %w", err)
+			}
+		case err != nil:
+			return 0, err
+		}
+		parentID = tagID
+	}
+	return tagID, nil
+}
+
+// adoptTag moves the top-level tag with a name under a parent, unless it is
+// the parent or one of its ancestors. Returns sql.ErrNoRows if there is no
+// such tag.
+func adoptTag(q queryer, taxonomyID, parentID int64, name string) (int64, error) {
+	tagID, err := lookupChild(q, taxonomyID, 0, name)
+	if err != nil {
+		return 0, err
+	}
+	ancestor, err := inSubtree(q, tagID, parentID)
+	if err != nil {
+		return 0, err
+	}
+	if ancestor {
+		return 0, sql.ErrNoRows
+	}
+	if _, err := q.Exec("UPDATE tags SET parent_id = ? WHERE id = ?", parentID, tagID); err != nil {
+		return 0, fmt.Errorf("failed to set tag parent: %w", err)
+	}
+	return tagID, nil
+}
+
+// GetTagTree returns every tag in a taxonomy ordered by name, with file counts
+// that include the files tagged with any descendant tag
+func (db *DB) GetTagTree(taxonomyName string) ([]TagNode, error) {
+	taxonomyID, err := requireTaxonomy(db, taxonomyName)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        WITH RECURSIVE closure(ancestor, descendant) AS (
+            SELECT id, id FROM tags WHERE taxonomy_id = ?
+            UNION ALL
+            SELECT c.ancestor, t.id FROM closure c JOIN tags t ON t.parent_id = c.descendant
+        )
+        SELECT t.id, COALESCE(t.parent_id, 0), t.name, COUNT(DISTINCT ft.file_id)
+        FROM tags t
+        JOIN closure c ON c.ancestor = t.id
+        LEFT JOIN file_tags ft ON ft.tag_id = c.descendant
+        GROUP BY t.id
+        ORDER BY t.name
+    `
+	rows, err := db.Query(query, taxonomyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []TagNode
+	for rows.Next() {
+		var node TagNode
+		if err := rows.Scan(&node.ID, &node.ParentID, &node.Name, &node.Count); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	aliases, err := tagAliases(db, taxonomyID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range nodes {
+		nodes[i].Aliases = aliases[nodes[i].ID]
+	}
+	return nodes, nil
+}
+
+// TagPaths returns the full path of each tag in a tree, keyed by tag ID
+func TagPaths(nodes []TagNode) map[int64]string {
+	byID := make(map[int64]TagNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	paths := make(map[int64]string, len(nodes))
+	var path func(node TagNode) string
+	path = func(node TagNode) string {
+		if p, ok := paths[node.ID]; ok {
+			return p
+		}
+		p := EscapeTagName(node.Name)
+		if parent, ok := byID[node.ParentID]; ok {
+			p = path(parent) + TagPathSeparator + p
+		}
+		paths[node.ID] = p
+		return p
+	}
+	for _, node := range nodes {
+		path(node)
+	}
+	return paths
+}
+
+// MoveTag moves a tag, along with its descendants, under a new parent. An
+// empty parent path makes it a top-level tag.
+func (db *DB) MoveTag(taxonomyName, tagPath, parentPath string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	taxonomyID, err := requireTaxonomy(tx, taxonomyName)
+	if err != nil {
+		return err
+	}
+
+	tagID, err := findTagPath(tx, taxonomyID, tagPath)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("tag not found: %s", tagPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	var parentArg any
+	if len(SplitTagPath(parentPath)) > 0 {
+		parentID, err := ensureTagPath(tx, taxonomyID, parentPath)
+		if err != nil {
+			return err
+		}
+
+		// Refuse to move a tag underneath itself
+		cycle, err := inSubtree(tx, tagID, parentID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("cannot move tag %q under itself or its descendants", tagPath)
+		}
+		parentArg = parentID
+	}
+
+	var taken bool
+	err = tx.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM tags t JOIN tags moved ON moved.id = ?1
+            WHERE t.taxonomy_id = moved.taxonomy_id AND IFNULL(t.parent_id, 0) = IFNULL(?2, 0)
+                AND t.name = moved.name AND t.id != moved.id
+        )
+    `, tagID, parentArg).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check tag names: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("a tag with the name of %q already exists there", tagPath)
+	}
+
+	if _, err := tx.Exec("UPDATE tags SET parent_id = ? WHERE id = ?", parentArg, tagID); err != nil {
+		return fmt.Errorf("failed to move tag: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSplitTagPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"fantasy", []string{"fantasy"}},
+		{"fiction/fantasy/epic", []string{"fiction", "fantasy", "epic"}},
+		{" europe / uk ", []string{"europe", "uk"}},
+		{"a//b/", []string{"a", "b"}},
+		{"", nil},
+		{"/", nil},
+
+		// Escaped separators
+		{`AC\/DC`, []string{"AC/DC"}},
+		{`music/AC\/DC`, []string{"music", "AC/DC"}},
+		{`back\\/slash`, []string{`back\`, "slash"}},
+		{`back\\\/slash`, []string{`back\/slash`}},
+		{`ends\\`, []string{`ends\`}},
+
+		// Other backslashes are literal
+		{`back\slash`, []string{`back\slash`}},
+		{`back\\slash`, []string{`back\\slash`}},
+		{`trailing\`, []string{`trailing\`}},
+		{`C:\Music/rock`, []string{`C:\Music`, "rock"}},
+	}
+	for _, tt := range tests {
+		if got := SplitTagPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitTagPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeTagName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fantasy", "fantasy"},
+		{"AC/DC", `AC\/DC`},
+		{`back\slash`, `back\slash`},
+		{`ends\`, `ends\\`},
+		{`\/`, `\\\/`},
+	}
+	for _, tt := range tests {
+		if got := EscapeTagName(tt.name); got != tt.want {
+			t.Errorf("EscapeTagName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeTagNameRoundTrip(t *testing.T) {
+	names := []string{"fantasy", "AC/DC", "a/b/c", `back\slash`, `back\\slash`, `trailing\`, `\/`, `\\`, `\`, "1/2"}
+	for _, name := range names {
+		if got := SplitTagPath(EscapeTagName(name)); !reflect.DeepEqual(got, []string{name}) {
+			t.Errorf("SplitTagPath(EscapeTagName(%q)) = %q, want one level", name, got)
+		}
+		path := JoinTagPath([]string{name, name})
+		if got := SplitTagPath(path); !reflect.DeepEqual(got, []string{name, name}) {
+			t.Errorf("SplitTagPath(%q) = %q, want two levels of %q", path, got, name)
+		}
+	}
+}
+
+func TestFileTagsEscapesLevels(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AddTaxonomy("artist"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddFile("thunderstruck.mp3", ".", "hash", 1, "2024-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{`music/AC\/DC`, `back\slash`} {
+		if err := db.TagFile("thunderstruck.mp3", "artist", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record, err := db.GetFileRecord("thunderstruck.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := record.Tags["artist"], []string{`back\slash`, `music/AC\/DC`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %q, want %q", got, want)
+	}
+}
+
+func TestTagNamesUniquePerParent(t *testing.T) {
+	db := newTestDB(t)
+	for _, tag := range []string{"fiction/fantasy", "games/fantasy"} {
+		if err := db.RegisterTag("tags", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.TagExists("tags", "fantasy"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("looking up fantasy = %v, want it to be ambiguous", err)
+	}
+	for _, tag := range []string{"fiction/fantasy", "games/fantasy"} {
+		if exists, err := db.TagExists("tags", tag); err != nil || !exists {
+			t.Errorf("%s exists = %v, %v", tag, exists, err)
+		}
+	}
+
+	// A top-level tag is what a bare name refers to
+	if err := db.RegisterTag("tags", "/fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := db.GetTagTree("tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 5 {
+		t.Errorf("tags = %v, want 5", nodes)
+	}
+	if exists, err := db.TagExists("tags", "fantasy"); err != nil || !exists {
+		t.Errorf("fantasy exists = %v, %v", exists, err)
+	}
+}
+
+func TestMergeTagMergesChildren(t *testing.T) {
+	db := newTestDB(t)
+	for _, tag := range []string{"sf/space opera", "sf/cyberpunk", "science fiction/space opera"} {
+		if err := db.RegisterTag("tags", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.AddTagAlias("tags", "sf", "science fiction"); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := db.GetTagTree("tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, path := range TagPaths(nodes) {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	want := []string{"science fiction", "science fiction/cyberpunk", "science fiction/space opera"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %q, want %q", got, want)
+	}
+}
+
+func TestMoveTagRefusesNameTaken(t *testing.T) {
+	db := newTestDB(t)
+	for _, tag := range []string{"fiction/fantasy", "/fantasy"} {
+		if err := db.RegisterTag("tags", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.MoveTag("tags", "fiction/fantasy", "/"); err == nil {
+		t.Error("moved a tag next to one with the same name")
+	}
+	if err := db.MoveTag("tags", "fantasy", "fiction"); err == nil {
+		t.Error("moved a tag next to one with the same name")
+	}
+}
+
+func TestEnsureTagPathDoesNotAdoptAncestors(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.RegisterTag("tags", "fiction/fantasy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RegisterTag("tags", "fantasy/fiction"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.TagExists("tags", "fiction/fantasy/fiction"); err != nil || !exists {
+		t.Errorf("fiction/fantasy/fiction exists = %v, %v", exists, err)
+	}
+}
+
+func TestMigrateTagNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fart.db")
+	old, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{
+		`CREATE TABLE taxonomies (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE tags (
+            id INTEGER PRIMARY KEY,
+            taxonomy_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            FOREIGN KEY(taxonomy_id) REFERENCES taxonomies(id),
+            UNIQUE(taxonomy_id, name)
+        )`,
+		`INSERT INTO taxonomies (id, name) VALUES (1, 'tags')`,
+		`INSERT INTO tags (id, taxonomy_id, name) VALUES (7, 1, 'fantasy')`,
+	}
+	for _, query := range queries {
+		if _, err := old.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"fiction/fantasy", "games/fantasy"} {
+		if err := db.RegisterTag("tags", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes, err := db.GetTagTree("tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := TagPaths(nodes)
+	if paths[7] != "fiction/fantasy" || len(paths) != 4 {
+		t.Errorf("tags = %v, want fantasy adopted by fiction and games/fantasy added", paths)
+	}
+	if _, err := db.Exec("INSERT INTO tags (taxonomy_id, name) VALUES (1, 'fiction')"); err == nil {
+		t.Error("added a second top-level fiction tag")
+	}
+}
+
+// newTestDB returns a new, initialized database
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := New(filepath.Join(t.TempDir(), "fart.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Value types of a taxonomy's tags
+const (
+	TypeText  = "text"
+	TypeInt   = "int"
+	TypeFloat = "float"
+	TypeDate  = "date"
+	TypeBool  = "bool"
+)
+
+// Taxonomy holds a taxonomy's settings
+type Taxonomy struct {
+	ID           int64
+	Name         string
+	SingleValued bool   // tagging a file replaces its previous tag
+	Closed       bool   // only registered tags may be used
+	ValuePattern string // regular expression that tag values must match
+	ValueType    string // one of the Type constants
+}
+
+const taxonomyColumns = "id, name, single_valued, closed, value_pattern, value_type"
+
+// scanTaxonomy reads a row selected with taxonomyColumns
+func scanTaxonomy(row interface{ Scan(...any) error }) (*Taxonomy, error) {
+	var t Taxonomy
+	if err := row.Scan(&t.ID, &t.Name, &t.SingleValued, &t.Closed, &t.ValuePattern, &t.ValueType); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetTaxonomy returns a taxonomy's settings, or nil if it does not exist
+func (db *DB) GetTaxonomy(name string) (*Taxonomy, error) {
+	row := db.QueryRow("SELECT "+taxonomyColumns+" FROM taxonomies WHERE name = ?", name)
+	t, err := scanTaxonomy(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get taxonomy: %w", err)
+	}
+	return t, nil
+}
+
+// GetTaxonomies returns every taxonomy ordered by name
+func (db *DB) GetTaxonomies() ([]Taxonomy, error) {
+	rows, err := db.Query("SELECT " + taxonomyColumns + " FROM taxonomies ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query taxonomies: %w", err)
+	}
+	defer rows.Close()
+
+	var taxonomies []Taxonomy
+	for rows.Next() {
+		t, err := scanTaxonomy(rows)
+		if err != nil {
+			return nil, err
+		}
+		taxonomies = append(taxonomies, *t)
+	}
+	return taxonomies, rows.Err()
+}
+
+// UpdateTaxonomy saves a taxonomy's settings
+func (db *DB) UpdateTaxonomy(t Taxonomy) error {
+	return updateTaxonomy(db, t)
+}
+
+// TagMerge merges one tag into another
+type TagMerge struct {
+	FromID int64
+	ToID   int64
+}
+
+// RetypeTaxonomy saves a taxonomy's settings together with the changes to its
+// tags that a new value type needs: merges are applied in order, and renames
+// maps tag IDs to new names. Either everything is changed or nothing is.
+func (db *DB) RetypeTaxonomy(t Taxonomy, merges []TagMerge, renames map[int64]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, merge := range merges {
+		if err := mergeTag(tx, merge.FromID, merge.ToID); err != nil {
+			return err
+		}
+	}
+	for tagID, name := range renames {
+		if _, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", name, tagID); err != nil {
+			return fmt.Errorf("failed to rename tag: %w", err)
+		}
+	}
+	if err := updateTaxonomy(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateTaxonomy saves a taxonomy's settings
+func updateTaxonomy(q queryer, t Taxonomy) error {
+	result, err := q.Exec(`
+        UPDATE taxonomies
+        SET single_valued = ?, closed = ?, value_pattern = ?, value_type = ?
+        WHERE name = ?
+    `, t.SingleValued, t.Closed, t.ValuePattern, t.ValueType, t.Name)
+	if err != nil {
+		return fmt.Errorf("failed to update taxonomy: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("taxonomy not found: %s", t.Name)
+	}
+	return nil
+}
+
+// TagExists checks whether a tag, or an alias of one, exists in a taxonomy
+func (db *DB) TagExists(taxonomyName, tagPath string) (bool, error) {
+	taxonomyID, err := taxonomyIDByName(db, taxonomyName)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = findTagPath(db, taxonomyID, tagPath)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RegisterTag adds a tag to a taxonomy without tagging any file, which is how
+// the vocabulary of a closed taxonomy is defined
+func (db *DB) RegisterTag(taxonomyName, tagPath string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	taxonomyID, err := requireTaxonomy(tx, taxonomyName)
+	if err != nil {
+		return err
+	}
+	if _, err := ensureTagPath(tx, taxonomyID, tagPath); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UntagFile removes a tag from a file
+func (db *DB) UntagFile(filePath, taxonomyName, tagPath string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+
+	taxonomyID, err := requireTaxonomy(db, taxonomyName)
+	if err != nil {
+		return err
+	}
+
+	tagID, err := findTagPath(db, taxonomyID, tagPath)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("tag not found: %s", tagPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec("DELETE FROM file_tags WHERE file_id = ? AND tag_id = ?", fileID, tagID)
+	if err != nil {
+		return fmt.Errorf("failed to untag file: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%s is not tagged with %s", filePath, tagPath)
+	}
+	return nil
+}
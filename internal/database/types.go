@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// TypeTaxonomy is the built-in taxonomy tagged with the kind of each file
+const TypeTaxonomy = "type"
+
+// File attributes that search filters can match
+const (
+	AttrMIMEType = "mime_type"
+	AttrKind     = "kind"
+)
+
+// FileType is the detected type of a file in the archive
+type FileType struct {
+	Path     string
+	MIMEType string
+	Kind     string
+}
+
+// SetFileType records the MIME type and kind of a file
+func (db *DB) SetFileType(filePath, mimeType, kind string) error {
+	fileID, err := fileIDByPath(db, filePath)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE files SET mime_type = ?, kind = ? WHERE id = ?`, mimeType, kind, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to set file type: %w", err)
+	}
+	return nil
+}
+
+// GetFileTypes returns the type of every file in the archive. Files added
+// before types were detected have an empty MIME type.
+func (db *DB) GetFileTypes() ([]FileType, error) {
+	rows, err := db.Query(`
+        SELECT path, filename, mime_type, kind FROM files
+        ORDER BY path, filename
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []FileType
+	for rows.Next() {
+		var dir, name string
+		var t FileType
+		if err := rows.Scan(&dir, &name, &t.MIMEType, &t.Kind); err != nil {
+			return nil, err
+		}
+		t.Path = filepath.Join(dir, name)
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
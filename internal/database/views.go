@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// View is a directory of links to the files in the archive, arranged by
+// their tags and by saved searches. A view that names neither taxonomies
+// nor searches has all of them.
+type View struct {
+	Path       string // absolute path of the directory
+	Hardlinks  bool   // hard links rather than symbolic links
+	Taxonomies []string
+	Searches   []string // names of saved searches
+}
+
+// SaveView records the settings of a view, replacing those of a view built
+// in the same directory before
+func (db *DB) SaveView(v View) error {
+	_, err := db.Exec(`
+        INSERT INTO views (path, hardlinks, taxonomies, searches)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT(path) DO UPDATE SET
+            hardlinks = excluded.hardlinks,
+            taxonomies = excluded.taxonomies,
+            searches = excluded.searches
+    `, v.Path, v.Hardlinks, strings.Join(v.Taxonomies, ","), strings.Join(v.Searches, ","))
+	if err != nil {
+		return fmt.Errorf("failed to save view: %w", err)
+	}
+	return nil
+}
+
+// GetView returns the view built in a directory, or nil if there is none
+func (db *DB) GetView(path string) (*View, error) {
+	views, err := db.queryViews("WHERE path = ?", path)
+	if err != nil || len(views) == 0 {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// GetViews returns all views ordered by path
+func (db *DB) GetViews() ([]View, error) {
+	return db.queryViews("ORDER BY path")
+}
+
+func (db *DB) queryViews(clause string, args ...any) ([]View, error) {
+	rows, err := db.Query("SELECT path, hardlinks, taxonomies, searches FROM views "+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get views: %w", err)
+	}
+	defer rows.Close()
+
+	var views []View
+	for rows.Next() {
+		var v View
+		var taxonomies, searches string
+		if err := rows.Scan(&v.Path, &v.Hardlinks, &taxonomies, &searches); err != nil {
+			return nil, err
+		}
+		v.Taxonomies = splitList(taxonomies)
+		v.Searches = splitList(searches)
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// splitList splits a comma-separated list, where "" is the empty list
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,173 @@
+package fileops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrNotContainer is returned when listing the members of a file that isn't
+// a zip or tar container
+var ErrNotContainer = errors.New("not a zip or tar container")
+
+// ContainerMember is a file stored inside a zip or tar container
+type ContainerMember struct {
+	Name       string // path within the container, using / as the separator
+	Hash       string
+	Size       int64
+	ModifiedAt string
+	Type       FileType
+}
+
+// ListContainer hashes the members of a zip, tar, tar.gz, tar.bz2 or tar.zst
+// file. Directories and links are skipped, and paths that would leave the
+// container are kept inside it. Nested containers are not opened.
+func ListContainer(filePath string) ([]ContainerMember, error) {
+	mimeType, err := DetectMIMEType(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == "application/zip" {
+		return listZip(filePath)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader
+	switch mimeType {
+	case "application/x-tar":
+		r = file
+	case "application/x-gzip":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case "application/x-bzip2":
+		r = bzip2.NewReader(file)
+	case "application/zstd":
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, ErrNotContainer
+	}
+	return listTar(r, mimeType != "application/x-tar")
+}
+
+// listZip hashes the members of a zip file
+func listZip(filePath string) ([]ContainerMember, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip: %w", err)
+	}
+	defer archive.Close()
+
+	var members []ContainerMember
+	for _, f := range archive.File {
+		name, ok := memberName(f.Name)
+		if !ok || !f.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		member, err := readMember(name, r, f.Modified)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// listTar hashes the members of a tar stream. A compressed stream that turns
+// out not to hold a tar is not a container.
+func listTar(r io.Reader, compressed bool) ([]ContainerMember, error) {
+	var members []ContainerMember
+
+	tr := tar.NewReader(r)
+	for first := true; ; first = false {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			if compressed && first {
+				return nil, ErrNotContainer
+			}
+			return nil, fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		name, ok := memberName(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		member, err := readMember(name, tr, header.ModTime)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+}
+
+// memberName cleans the path of a member so that it stays inside the
+// container, rejecting directories
+func memberName(name string) (string, bool) {
+	if strings.HasSuffix(name, "/") {
+		return "", false
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" || name == "." {
+		return "", false
+	}
+	return name, true
+}
+
+// readMember hashes the content of a member and detects its type
+func readMember(name string, r io.Reader, modified time.Time) (ContainerMember, error) {
+	hash := sha256.New()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ContainerMember{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	hash.Write(header[:n])
+
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return ContainerMember{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return ContainerMember{
+		Name:       name,
+		Hash:       hex.EncodeToString(hash.Sum(nil)),
+		Size:       size + int64(n),
+		ModifiedAt: modified.UTC().Format(ModTimeLayout),
+		Type:       fileType(name, sniffMIMEType(header[:n])),
+	}, nil
+}
@@ -0,0 +1,139 @@
+package fileops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// containerFiles are written to each test container, in order. A name ending
+// in / is a directory.
+var containerFiles = []struct {
+	name    string
+	content string
+}{
+	{"docs/", ""},
+	{"docs/readme.txt", "read me"},
+	{"../outside.txt", "kept inside"},
+	{"/abs/notes.md", "# notes"},
+}
+
+// wantMembers are the names and contents of the members of a test container
+var wantMembers = map[string]string{
+	"docs/readme.txt": "read me",
+	"outside.txt":     "kept inside",
+	"abs/notes.md":    "# notes",
+}
+
+func writeZip(t *testing.T, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range containerFiles {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: f.name, Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(f.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, f := range containerFiles {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		if f.content == "" {
+			header.Typeflag = tar.TypeDir
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := w.WriteHeader(&tar.Header{Name: "link", Linkname: "docs/readme.txt", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListContainer(t *testing.T) {
+	dir := t.TempDir()
+	for name, write := range map[string]func(*testing.T, string){
+		"docs.zip":    writeZip,
+		"docs.tar.gz": writeTarGz,
+	} {
+		path := filepath.Join(dir, name)
+		write(t, path)
+
+		members, err := ListContainer(path)
+		if err != nil {
+			t.Fatalf("ListContainer(%s) failed: %v", name, err)
+		}
+		got := make(map[string]string)
+		for _, member := range members {
+			content := wantMembers[member.Name]
+			sum := sha256.Sum256([]byte(content))
+			if member.Hash != hex.EncodeToString(sum[:]) || member.Size != int64(len(content)) {
+				t.Errorf("%s: %s has hash %s and size %d", name, member.Name, member.Hash, member.Size)
+			}
+			if member.ModifiedAt != "2024-01-02 03:04:05" {
+				t.Errorf("%s: %s modified at %q", name, member.Name, member.ModifiedAt)
+			}
+			got[member.Name] = content
+		}
+		if !reflect.DeepEqual(got, wantMembers) {
+			t.Errorf("%s: members = %v, want %v", name, got, wantMembers)
+		}
+	}
+}
+
+func TestListContainerNotContainer(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{
+		"notes.txt": []byte("just text"),
+		"notes.gz":  gzipped(t, "not a tar archive, only some text that is long enough"),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ListContainer(path); !errors.Is(err, ErrNotContainer) {
+			t.Errorf("ListContainer(%s) = %v, want ErrNotContainer", name, err)
+		}
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
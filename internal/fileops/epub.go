@@ -0,0 +1,167 @@
+package fileops
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor("application/epub+zip", EPUBExtractor{})
+}
+
+// maxOPFSize limits the size of an EPUB package document read into memory
+const maxOPFSize = 4 << 20
+
+// EPUBExtractor reads the package metadata of EPUB files, including the
+// series written by calibre and EPUB 3 collections
+type EPUBExtractor struct{}
+
+// opfContainer is META-INF/container.xml, which locates the package document
+type opfContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfElement is a metadata element of a package document
+type opfElement struct {
+	XMLName  xml.Name
+	ID       string     `xml:"id,attr"`
+	Name     string     `xml:"name,attr"`
+	Content  string     `xml:"content,attr"`
+	Property string     `xml:"property,attr"`
+	Refines  string     `xml:"refines,attr"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Value    string     `xml:",chardata"`
+}
+
+// attr returns the value of an attribute by its local name, such as the
+// opf:role and opf:file-as attributes of EPUB 2
+func (e opfElement) attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// opfPackage is the metadata section of a package document
+type opfPackage struct {
+	Metadata struct {
+		Elements []opfElement `xml:",any"`
+	} `xml:"metadata"`
+}
+
+// Extract reads the metadata of an EPUB file
+func (EPUBExtractor) Extract(filePath string) (Metadata, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	defer archive.Close()
+
+	var container opfContainer
+	if err := readZipXML(&archive.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("EPUB has no package document")
+	}
+
+	var pkg opfPackage
+	if err := readZipXML(&archive.Reader, path.Clean(container.Rootfiles[0].FullPath), &pkg); err != nil {
+		return nil, err
+	}
+	return opfMetadata(pkg.Metadata.Elements), nil
+}
+
+// readZipXML decodes an XML file in a zip archive
+func readZipXML(archive *zip.Reader, name string, v any) error {
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer r.Close()
+
+		decoder := xml.NewDecoder(io.LimitReader(r, maxOPFSize))
+		decoder.Strict = false
+		if err := decoder.Decode(v); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("EPUB has no %s", name)
+}
+
+// opfMetadata reads the document fields of package metadata. EPUB 3 refines
+// elements by ID with meta elements, so those are collected first.
+func opfMetadata(elements []opfElement) Metadata {
+	refinements := make(map[string]map[string]string)
+	for _, e := range elements {
+		if e.XMLName.Local == "meta" && strings.HasPrefix(e.Refines, "#") {
+			id := e.Refines[1:]
+			if refinements[id] == nil {
+				refinements[id] = make(map[string]string)
+			}
+			refinements[id][e.Property] = strings.TrimSpace(e.Value)
+		}
+	}
+	refined := func(e opfElement, property string) string {
+		if e.ID == "" {
+			return ""
+		}
+		return refinements[e.ID][property]
+	}
+
+	md := Metadata{}
+	for _, e := range elements {
+		switch e.XMLName.Local {
+		case "title", "publisher", "subject":
+			addDocumentField(md, e.XMLName.Local, e.Value)
+		case "creator":
+			role := e.attr("role")
+			if role == "" {
+				role = refined(e, "role")
+			}
+			if role != "" && role != "aut" {
+				continue
+			}
+
+			// Authors are named in their sort form, "Jordan, Robert", when
+			// the book records it
+			name := e.attr("file-as")
+			if name == "" {
+				name = refined(e, "file-as")
+			}
+			if name == "" {
+				name = e.Value
+			}
+			addDocumentField(md, "author", name)
+		case "identifier":
+			addDocumentField(md, "isbn", e.Value)
+		case "meta":
+			switch {
+			case e.Name == "calibre:series":
+				addDocumentField(md, "series", e.Content)
+			case e.Name == "calibre:series_index":
+				addDocumentField(md, "series_index", e.Content)
+			case e.Property == "belongs-to-collection" && e.Refines == "":
+				if kind := refined(e, "collection-type"); kind != "" && kind != "series" {
+					continue
+				}
+				addDocumentField(md, "series", e.Value)
+				addDocumentField(md, "series_index", refined(e, "group-position"))
+			}
+		}
+	}
+	return md
+}
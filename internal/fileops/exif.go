@@ -0,0 +1,304 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EXIF tags read by the EXIF extractor
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagLensMake         = 0xA433
+	tagLensModel        = 0xA434
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+// maxTIFFValue limits the size of a single TIFF value read into memory
+const maxTIFFValue = 64 * 1024
+
+// exifDateLayout is the date format used by EXIF
+const exifDateLayout = "2006:01:02 15:04:05"
+
+func init() {
+	e := ExifExtractor{}
+	RegisterExtractor("image/jpeg", e)
+	RegisterExtractor("image/tiff", e)
+}
+
+// ExifExtractor reads EXIF data from JPEG and TIFF images. It produces the
+// fields exif.camera, exif.lens, exif.taken_at, exif.year, exif.orientation
+// and exif.gps.
+type ExifExtractor struct{}
+
+// Extract reads the EXIF data of an image
+func (ExifExtractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var r io.ReaderAt = file
+	if bytes.HasPrefix(magic, []byte{0xFF, 0xD8}) {
+		if _, err := file.Seek(2, io.SeekStart); err != nil {
+			return nil, err
+		}
+		exif, err := jpegExifSegment(bufio.NewReader(file))
+		if err != nil || exif == nil {
+			return Metadata{}, err
+		}
+		r = bytes.NewReader(exif)
+	}
+
+	t, err := newTIFFReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return t.exifMetadata()
+}
+
+// jpegExifSegment returns the TIFF data of a JPEG's APP1 Exif segment, or nil
+// if it has none. The reader must be positioned after the SOI marker.
+func jpegExifSegment(r *bufio.Reader) ([]byte, error) {
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, nil
+		}
+		if marker[0] != 0xFF {
+			return nil, fmt.Errorf("invalid JPEG marker")
+		}
+
+		// Image data follows start of scan, there is no metadata after it
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, fmt.Errorf("invalid JPEG segment length")
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, fmt.Errorf("truncated JPEG segment: %w", err)
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// tiffReader reads the image file directories of TIFF data
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	first uint32
+}
+
+// tiffEntry is a raw value of an image file directory
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// tiffTypeSizes is the size in bytes of each TIFF value type
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// newTIFFReader reads a TIFF header
+func newTIFFReader(r io.ReaderAt) (*tiffReader, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF header: %w", err)
+	}
+
+	t := &tiffReader{r: r}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF byte order")
+	}
+	if t.order.Uint16(header[2:]) != 42 {
+		return nil, fmt.Errorf("invalid TIFF header")
+	}
+	t.first = t.order.Uint32(header[4:])
+	return t, nil
+}
+
+// readIFD reads the entries of the image file directory at an offset
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]tiffEntry, error) {
+	countBuf := make([]byte, 2)
+	if _, err := t.r.ReadAt(countBuf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read IFD: %w", err)
+	}
+	count := int(t.order.Uint16(countBuf))
+
+	raw := make([]byte, count*12)
+	if _, err := t.r.ReadAt(raw, int64(offset)+2); err != nil {
+		return nil, fmt.Errorf("failed to read IFD entries: %w", err)
+	}
+
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		field := raw[i*12 : (i+1)*12]
+		entry := tiffEntry{typ: t.order.Uint16(field[2:]), count: t.order.Uint32(field[4:])}
+
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok || entry.count == 0 || entry.count > maxTIFFValue/size {
+			continue
+		}
+
+		length := size * entry.count
+		if length <= 4 {
+			entry.data = field[8 : 8+length]
+		} else {
+			entry.data = make([]byte, length)
+			if _, err := t.r.ReadAt(entry.data, int64(t.order.Uint32(field[8:]))); err != nil {
+				continue
+			}
+		}
+		entries[t.order.Uint16(field)] = entry
+	}
+	return entries, nil
+}
+
+// subIFD reads the directory that an entry points to, if it is present
+func (t *tiffReader) subIFD(entries map[uint16]tiffEntry, tag uint16) map[uint16]tiffEntry {
+	offset, ok := t.uint(entries, tag)
+	if !ok {
+		return nil
+	}
+	sub, err := t.readIFD(uint32(offset))
+	if err != nil {
+		return nil
+	}
+	return sub
+}
+
+// string returns an ASCII value
+func (t *tiffReader) string(entries map[uint16]tiffEntry, tag uint16) string {
+	entry, ok := entries[tag]
+	if !ok || (entry.typ != 2 && entry.typ != 7) {
+		return ""
+	}
+	if i := bytes.IndexByte(entry.data, 0); i >= 0 {
+		return strings.TrimSpace(string(entry.data[:i]))
+	}
+	return strings.TrimSpace(string(entry.data))
+}
+
+// uint returns the first value of a SHORT or LONG entry
+func (t *tiffReader) uint(entries map[uint16]tiffEntry, tag uint16) (uint64, bool) {
+	entry, ok := entries[tag]
+	if !ok {
+		return 0, false
+	}
+	switch entry.typ {
+	case 3:
+		return uint64(t.order.Uint16(entry.data)), true
+	case 4:
+		return uint64(t.order.Uint32(entry.data)), true
+	}
+	return 0, false
+}
+
+// rationals returns the values of a RATIONAL entry
+func (t *tiffReader) rationals(entries map[uint16]tiffEntry, tag uint16) []float64 {
+	entry, ok := entries[tag]
+	if !ok || entry.typ != 5 {
+		return nil
+	}
+	values := make([]float64, entry.count)
+	for i := range values {
+		numerator := t.order.Uint32(entry.data[i*8:])
+		denominator := t.order.Uint32(entry.data[i*8+4:])
+		if denominator == 0 {
+			return nil
+		}
+		values[i] = float64(numerator) / float64(denominator)
+	}
+	return values
+}
+
+// exifMetadata reads the fields of the EXIF extractor from the first IFD and
+// the EXIF and GPS directories it points to
+func (t *tiffReader) exifMetadata() (Metadata, error) {
+	ifd0, err := t.readIFD(t.first)
+	if err != nil {
+		return nil, err
+	}
+	exif := t.subIFD(ifd0, tagExifIFD)
+	gps := t.subIFD(ifd0, tagGPSIFD)
+
+	md := Metadata{}
+
+	cameraMake, model := t.string(ifd0, tagMake), t.string(ifd0, tagModel)
+	if cameraMake != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(cameraMake)[0])) {
+		model = cameraMake + " " + model
+	}
+	md.Add("exif.camera", model)
+
+	lens := t.string(exif, tagLensModel)
+	if lensMake := t.string(exif, tagLensMake); lensMake != "" && !strings.HasPrefix(lens, lensMake) {
+		lens = lensMake + " " + lens
+	}
+	md.Add("exif.lens", lens)
+
+	taken := t.string(exif, tagDateTimeOriginal)
+	if taken == "" {
+		taken = t.string(ifd0, tagDateTime)
+	}
+	if date, err := time.Parse(exifDateLayout, taken); err == nil {
+		md.Add("exif.taken_at", date.Format("2006-01-02 15:04:05"))
+		md.Add("exif.year", strconv.Itoa(date.Year()))
+	}
+
+	if orientation, ok := t.uint(ifd0, tagOrientation); ok {
+		md.Add("exif.orientation", strconv.FormatUint(orientation, 10))
+	}
+
+	lat := gpsCoordinate(t.rationals(gps, tagGPSLatitude), t.string(gps, tagGPSLatitudeRef), "S")
+	lon := gpsCoordinate(t.rationals(gps, tagGPSLongitude), t.string(gps, tagGPSLongitudeRef), "W")
+	if lat != "" && lon != "" {
+		md.Add("exif.gps", lat+","+lon)
+	}
+
+	return md, nil
+}
+
+// gpsCoordinate converts degrees, minutes and seconds into decimal degrees
+func gpsCoordinate(dms []float64, ref, negativeRef string) string {
+	if len(dms) != 3 {
+		return ""
+	}
+	degrees := dms[0] + dms[1]/60 + dms[2]/3600
+	if strings.EqualFold(ref, negativeRef) {
+		degrees = -degrees
+	}
+	return strconv.FormatFloat(degrees, 'f', 6, 64)
+}
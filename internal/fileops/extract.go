@@ -0,0 +1,67 @@
+package fileops
+
+import (
+	"sort"
+	"strings"
+)
+
+// Metadata maps the fields read from a file, such as `exif.camera`, to their
+// values. Field names are prefixed with the kind of metadata they come from.
+type Metadata map[string][]string
+
+// Add appends a value to a field, ignoring empty values
+func (md Metadata) Add(field, value string) {
+	value = strings.TrimSpace(strings.Trim(value, "\x00"))
+	if value == "" {
+		return
+	}
+	for _, v := range md[field] {
+		if v == value {
+			return
+		}
+	}
+	md[field] = append(md[field], value)
+}
+
+// Fields returns the field names in alphabetical order
+func (md Metadata) Fields() []string {
+	fields := make([]string, 0, len(md))
+	for field := range md {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Extractor reads the metadata embedded in a file
+type Extractor interface {
+	Extract(path string) (Metadata, error)
+}
+
+// extractors holds the registered extractors keyed by MIME type
+var extractors = make(map[string]Extractor)
+
+// RegisterExtractor makes an extractor handle files of a MIME type
+func RegisterExtractor(mimeType string, e Extractor) {
+	extractors[mimeType] = e
+}
+
+// ExtractorFor returns the extractor for a MIME type, or nil if there is none
+func ExtractorFor(mimeType string) Extractor {
+	return extractors[mimeType]
+}
+
+// ExtractMetadata detects the type of a file and extracts its metadata. It
+// returns nil metadata if no extractor handles the file's type.
+func ExtractMetadata(path string) (Metadata, error) {
+	mimeType, err := DetectMIMEType(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := ExtractorFor(mimeType)
+	if e == nil {
+		return nil, nil
+	}
+	return e.Extract(path)
+}
@@ -9,6 +9,9 @@ import (
     "path/filepath"
 )
 
+// ModTimeLayout is the layout in which modification times are stored
+const ModTimeLayout = "2006-01-02 15:04:05"
+
 // FileInfo represents metadata about a file
 type FileInfo struct {
     Path       string
@@ -54,7 +57,7 @@ func GetFileInfo(path string) (*FileInfo, error) {
         Path:       absPath,
         Hash:       hash,
         Size:       stat.Size(),
-        ModifiedAt: stat.ModTime().UTC().Format("2006-01-02 15:04:05"),
+        ModifiedAt: stat.ModTime().UTC().Format(ModTimeLayout),
     }, nil
 }
 
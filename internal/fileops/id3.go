@@ -0,0 +1,321 @@
+package fileops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+func init() {
+	RegisterExtractor("audio/mpeg", ID3Extractor{})
+}
+
+// ID3Extractor reads ID3v2 and ID3v1 tags from MP3 files. ID3v2 values take
+// precedence, ID3v1 fills in any fields that are missing.
+type ID3Extractor struct{}
+
+// id3v2Frames maps the ID3v2.2 and ID3v2.3/4 frame IDs to audio fields
+var id3v2Frames = map[string]string{
+	"TT2": "title", "TIT2": "title",
+	"TP1": "artist", "TPE1": "artist",
+	"TP2": "album_artist", "TPE2": "album_artist",
+	"TAL": "album", "TALB": "album",
+	"TRK": "track", "TRCK": "track",
+	"TYE": "year", "TYER": "year", "TDRC": "year",
+	"TCO": "genre", "TCON": "genre",
+}
+
+// maxID3Size limits the size of an ID3v2 tag read into memory
+const maxID3Size = 16 << 20
+
+// Extract reads the ID3 tags of an MP3 file
+func (ID3Extractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	md := Metadata{}
+	if err := readID3v2(file, md); err != nil {
+		return nil, err
+	}
+	if err := readID3v1(file, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// readID3v2 reads an ID3v2 tag at the start of a file
+func readID3v2(file *os.File, md Metadata) error {
+	header := make([]byte, 10)
+	if _, err := file.ReadAt(header, 0); err != nil || !bytes.HasPrefix(header, []byte("ID3")) {
+		return nil
+	}
+
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	if version < 2 || version > 4 || size > maxID3Size {
+		return nil
+	}
+
+	tag := make([]byte, size)
+	if _, err := file.ReadAt(tag, 10); err != nil {
+		return fmt.Errorf("truncated ID3v2 tag: %w", err)
+	}
+	if flags&0x80 != 0 && version < 4 {
+		tag = unsynchronise(tag)
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 {
+		extended := int(binary.BigEndian.Uint32(tag))
+		if version == 3 {
+			extended += 4
+		} else {
+			extended = int(syncsafe(tag[:4]))
+		}
+		if extended > len(tag) {
+			return nil
+		}
+		tag = tag[extended:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+
+		var frameSize int
+		var formatFlags byte
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+			if tag[9]&0xC0 != 0 {
+				formatFlags = 0xFF // compressed or encrypted
+			}
+		case 4:
+			frameSize = int(syncsafe(tag[4:8]))
+			formatFlags = tag[9]
+		}
+		if frameSize < 0 || headerLen+frameSize > len(tag) {
+			break
+		}
+		frame := tag[headerLen : headerLen+frameSize]
+		tag = tag[headerLen+frameSize:]
+
+		field, ok := id3v2Frames[id]
+		if !ok || formatFlags&0x0C != 0 {
+			continue
+		}
+		if version == 4 {
+			if formatFlags&0x02 != 0 {
+				frame = unsynchronise(frame)
+			}
+			if formatFlags&0x01 != 0 && len(frame) >= 4 {
+				frame = frame[4:]
+			}
+		}
+
+		for _, value := range id3Text(frame) {
+			addAudioField(md, field, value)
+		}
+	}
+	return nil
+}
+
+// readID3v1 reads an ID3v1 tag at the end of a file, only filling in fields
+// that are not already set
+func readID3v1(file *os.File, md Metadata) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() < 128 {
+		return nil
+	}
+
+	tag := make([]byte, 128)
+	if _, err := file.ReadAt(tag, info.Size()-128); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read ID3v1 tag: %w", err)
+	}
+	if !bytes.HasPrefix(tag, []byte("TAG")) {
+		return nil
+	}
+
+	fields := []struct {
+		name  string
+		value []byte
+	}{
+		{"title", tag[3:33]},
+		{"artist", tag[33:63]},
+		{"album", tag[63:93]},
+		{"year", tag[93:97]},
+	}
+	for _, f := range fields {
+		if len(md["audio."+f.name]) == 0 {
+			addAudioField(md, f.name, latin1(bytes.TrimRight(f.value, "\x00 ")))
+		}
+	}
+
+	// ID3v1.1 stores the track number at the end of the comment
+	if tag[125] == 0 && tag[126] != 0 && len(md["audio.track"]) == 0 {
+		md.Add("audio.track", strconv.Itoa(int(tag[126])))
+	}
+	if len(md["audio.genre"]) == 0 && int(tag[127]) < len(id3Genres) {
+		md.Add("audio.genre", id3Genres[tag[127]])
+	}
+	return nil
+}
+
+// addAudioField adds a value to an audio field, normalising track numbers,
+// years and numeric ID3 genre references
+func addAudioField(md Metadata, field, value string) {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "track":
+		// "3/12" is track 3 of 12
+		value, _, _ = strings.Cut(value, "/")
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			value = strconv.Itoa(n)
+		}
+	case "year":
+		if len(value) > 4 {
+			value = value[:4]
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			return
+		}
+	case "genre":
+		value = id3Genre(value)
+	}
+	md.Add("audio."+field, value)
+}
+
+// id3Genre resolves genres written as "(17)", "(17)Rock" or "17"
+func id3Genre(value string) string {
+	ref := value
+	if strings.HasPrefix(ref, "(") {
+		end := strings.IndexByte(ref, ')')
+		if end < 0 {
+			return value
+		}
+		if rest := strings.TrimSpace(ref[end+1:]); rest != "" {
+			return rest
+		}
+		ref = ref[1:end]
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(id3Genres) {
+		return id3Genres[n]
+	}
+	return value
+}
+
+// id3Text decodes the values of an ID3v2 text frame. ID3v2.4 frames may hold
+// several values separated by null characters.
+func id3Text(frame []byte) []string {
+	if len(frame) < 2 {
+		return nil
+	}
+
+	var text string
+	data := frame[1:]
+	switch frame[0] {
+	case 0:
+		text = latin1(data)
+	case 1, 2:
+		text = decodeUTF16(data, frame[0] == 2)
+	case 3:
+		text = string(data)
+	default:
+		return nil
+	}
+
+	var values []string
+	for _, value := range strings.Split(text, "\x00") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// decodeUTF16 decodes UTF-16 text that starts with a byte order mark, or is
+// big endian when bigEndian is set
+func decodeUTF16(data []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	var units []uint16
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := order.Uint16(data[i:])
+		switch unit {
+		case 0xFEFF:
+			continue
+		case 0xFFFE:
+			// A byte order mark read the wrong way round
+			if order == binary.LittleEndian {
+				order = binary.BigEndian
+			} else {
+				order = binary.LittleEndian
+			}
+			continue
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+// latin1 decodes ISO-8859-1 text
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// syncsafe decodes a 28 bit integer stored in four 7 bit bytes
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// unsynchronise removes the zero bytes inserted after 0xFF bytes
+func unsynchronise(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// id3Genres lists the ID3v1 genres, including the Winamp extensions
+var id3Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebob", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall",
+}
@@ -0,0 +1,82 @@
+package fileops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is the number of bytes read from the start of a file to detect its type
+const sniffLen = 512
+
+// unknownMIMEType is the type of content that isn't recognised
+const unknownMIMEType = "application/octet-stream"
+
+// signature identifies a file type by the bytes found at an offset
+type signature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+// signatures lists the types that http.DetectContentType doesn't recognise.
+// They are checked in order before falling back to it.
+var signatures = []signature{
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{4, []byte("ftypM4A "), "audio/mp4"},
+	{4, []byte("ftypM4B "), "audio/mp4"},
+	{0, []byte{0xFF, 0xFB}, "audio/mpeg"},
+	{0, []byte{0xFF, 0xF3}, "audio/mpeg"},
+	{0, []byte{0xFF, 0xF2}, "audio/mpeg"},
+	// An EPUB is a zip whose first entry is an uncompressed "mimetype" file
+	{30, []byte("mimetypeapplication/epub+zip"), "application/epub+zip"},
+	{60, []byte("BOOKMOBI"), "application/x-mobipocket-ebook"},
+	{4, []byte("ftypqt  "), "video/quicktime"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypavif"), "image/avif"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte{0x28, 0xB5, 0x2F, 0xFD}, "application/zstd"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, "application/x-xz"},
+	{0, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, "application/x-7z-compressed"},
+}
+
+// DetectMIMEType detects the MIME type of a file from its content
+func DetectMIMEType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return sniffMIMEType(header[:n]), nil
+}
+
+// sniffMIMEType detects a MIME type from the first bytes of a file. An empty
+// file has no type.
+func sniffMIMEType(header []byte) string {
+	if len(header) == 0 {
+		return unknownMIMEType
+	}
+	for _, sig := range signatures {
+		if len(header) >= sig.offset+len(sig.magic) && bytes.Equal(header[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.mimeType
+		}
+	}
+
+	mimeType := http.DetectContentType(header)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
@@ -0,0 +1,170 @@
+package fileops
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+func init() {
+	RegisterExtractor("audio/mp4", MP4Extractor{})
+}
+
+// mp4Fields maps iTunes metadata atoms to audio fields
+var mp4Fields = map[string]string{
+	"\xa9nam": "title",
+	"\xa9ART": "artist",
+	"aART":    "album_artist",
+	"\xa9alb": "album",
+	"\xa9day": "year",
+	"\xa9gen": "genre",
+	"trkn":    "track",
+	"gnre":    "genre",
+}
+
+// maxAtomValue limits the size of a metadata value read into memory
+const maxAtomValue = 1 << 20
+
+// MP4Extractor reads the iTunes metadata of M4A and M4B files
+type MP4Extractor struct{}
+
+// mp4Atom is the position of an atom within a file
+type mp4Atom struct {
+	kind   string
+	offset int64 // start of the atom's content
+	size   int64 // size of the atom's content
+}
+
+// Extract reads the moov/udta/meta/ilst atoms of an MP4 file
+func (MP4Extractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	md := Metadata{}
+	parent := mp4Atom{offset: 0, size: info.Size()}
+	for _, kind := range []string{"moov", "udta", "meta", "ilst"} {
+		atoms, err := mp4Children(file, parent)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, atom := range atoms {
+			if atom.kind == kind {
+				parent, found = atom, true
+				break
+			}
+		}
+		if !found {
+			return md, nil
+		}
+
+		// meta is a full box with a version and flags before its children,
+		// except in some QuickTime files
+		if kind == "meta" {
+			header := make([]byte, 8)
+			if _, err := file.ReadAt(header, parent.offset); err == nil && string(header[4:8]) != "hdlr" {
+				parent.offset += 4
+				parent.size -= 4
+			}
+		}
+	}
+
+	items, err := mp4Children(file, parent)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		field, ok := mp4Fields[item.kind]
+		if !ok {
+			continue
+		}
+		readMP4Item(file, item, field, md)
+	}
+	return md, nil
+}
+
+// mp4Children lists the atoms directly inside a parent atom
+func mp4Children(r io.ReaderAt, parent mp4Atom) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	offset, end := parent.offset, parent.offset+parent.size
+
+	for offset+8 <= end {
+		header := make([]byte, 16)
+		n, err := r.ReadAt(header, offset)
+		if n < 8 {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("failed to read MP4 atom: %w", err)
+		}
+
+		size, headerLen := int64(binary.BigEndian.Uint32(header)), int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if n < 16 {
+				return nil, fmt.Errorf("truncated MP4 atom")
+			}
+			size, headerLen = int64(binary.BigEndian.Uint64(header[8:])), 16
+		}
+		if size < headerLen || offset+size > end {
+			break
+		}
+
+		atoms = append(atoms, mp4Atom{
+			kind:   string(header[4:8]),
+			offset: offset + headerLen,
+			size:   size - headerLen,
+		})
+		offset += size
+	}
+	return atoms, nil
+}
+
+// readMP4Item reads the data atoms of a metadata item
+func readMP4Item(r io.ReaderAt, item mp4Atom, field string, md Metadata) {
+	atoms, err := mp4Children(r, item)
+	if err != nil {
+		return
+	}
+
+	for _, atom := range atoms {
+		// A data atom starts with its type and locale
+		if atom.kind != "data" || atom.size < 8 || atom.size > maxAtomValue {
+			continue
+		}
+		data := make([]byte, atom.size)
+		if _, err := r.ReadAt(data, atom.offset); err != nil {
+			continue
+		}
+		value := data[8:]
+
+		switch item.kind {
+		case "trkn":
+			if len(value) >= 4 {
+				md.Add("audio.track", strconv.Itoa(int(binary.BigEndian.Uint16(value[2:]))))
+			}
+		case "gnre":
+			// ID3v1 genre number plus one
+			if len(value) >= 2 {
+				if n := int(binary.BigEndian.Uint16(value)); n > 0 && n <= len(id3Genres) {
+					md.Add("audio.genre", id3Genres[n-1])
+				}
+			}
+		default:
+			addAudioField(md, field, string(value))
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package fileops
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SafeName makes a tag or other name safe to use as a single file or
+// directory name
+func SafeName(name string) string {
+	name = strings.ReplaceAll(name, "/", "-")
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// UniqueName returns name, or name with a number if it is already used in
+// the same directory, as in `report (2).pdf`. The name is marked as used.
+func UniqueName(name string, used map[string]bool) string {
+	candidate := name
+	ext := filepath.Ext(name)
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
@@ -0,0 +1,324 @@
+package fileops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+func init() {
+	RegisterExtractor("application/pdf", PDFExtractor{})
+}
+
+// PDFExtractor reads the Info dictionary and XMP metadata of PDF files. XMP
+// values take precedence. Metadata held in compressed object streams is not
+// read.
+type PDFExtractor struct{}
+
+// pdfInfoFields maps Info dictionary keys to document fields
+var pdfInfoFields = map[string]string{
+	"Title":   "title",
+	"Author":  "author",
+	"Subject": "subject",
+}
+
+const (
+	// pdfTailLen is how much of the end of a file is searched for the trailer
+	pdfTailLen = 64 * 1024
+	// pdfChunkLen is the size of the chunks a file is scanned in
+	pdfChunkLen = 1 << 20
+	// pdfObjectLen is how much of an object is read to parse its dictionary
+	pdfObjectLen = 64 * 1024
+	// maxXMPLen limits the size of an XMP packet read into memory
+	maxXMPLen = 4 << 20
+)
+
+var pdfInfoRef = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+
+// Extract reads the metadata of a PDF file
+func (PDFExtractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	// The trailer, or the cross-reference stream that replaces it, is at the
+	// end of the file and points to the Info dictionary
+	tailStart := max(info.Size()-pdfTailLen, 0)
+	tail := make([]byte, info.Size()-tailStart)
+	if _, err := file.ReadAt(tail, tailStart); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var infoObject []byte
+	if refs := pdfInfoRef.FindAllSubmatch(tail, -1); len(refs) > 0 {
+		ref := refs[len(refs)-1]
+		infoObject = []byte(fmt.Sprintf("%s %s obj", ref[1], ref[2]))
+	}
+
+	infoOffset, xmpOffset, err := scanPDF(file, infoObject)
+	if err != nil {
+		return nil, err
+	}
+
+	md := Metadata{}
+	if xmpOffset >= 0 {
+		packet := make([]byte, maxXMPLen)
+		n, _ := file.ReadAt(packet, xmpOffset)
+		packet = packet[:n]
+		if end := bytes.Index(packet, []byte("</x:xmpmeta>")); end >= 0 {
+			readXMP(packet[:end+len("</x:xmpmeta>")], md)
+		}
+	}
+
+	if infoOffset >= 0 {
+		object := make([]byte, pdfObjectLen)
+		n, _ := file.ReadAt(object, infoOffset+int64(len(infoObject)))
+		for key, value := range parsePDFDict(object[:n]) {
+			field, ok := pdfInfoFields[key]
+			if !ok || len(md["doc."+field]) > 0 {
+				continue
+			}
+			if field == "author" {
+				for _, author := range splitAuthors(value) {
+					addDocumentField(md, field, author)
+				}
+				continue
+			}
+			addDocumentField(md, field, value)
+		}
+	}
+	return md, nil
+}
+
+// scanPDF finds the offsets of the Info dictionary object and the first XMP
+// packet, or -1 if they are not found
+func scanPDF(r io.ReaderAt, infoObject []byte) (int64, int64, error) {
+	infoOffset, xmpOffset := int64(-1), int64(-1)
+	xmpStart := []byte("<x:xmpmeta")
+	overlap := int64(len(xmpStart) + len(infoObject) + 1)
+
+	chunk := make([]byte, pdfChunkLen)
+	for offset := int64(0); ; offset += pdfChunkLen - overlap {
+		n, err := r.ReadAt(chunk, offset)
+		data := chunk[:n]
+
+		if infoOffset < 0 && infoObject != nil {
+			if i := indexPDFObject(data, infoObject); i >= 0 {
+				infoOffset = offset + int64(i)
+			}
+		}
+		if xmpOffset < 0 {
+			if i := bytes.Index(data, xmpStart); i >= 0 {
+				xmpOffset = offset + int64(i)
+			}
+		}
+
+		if (infoOffset >= 0 || infoObject == nil) && xmpOffset >= 0 {
+			break
+		}
+		if err == io.EOF || n < len(chunk) {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	return infoOffset, xmpOffset, nil
+}
+
+// indexPDFObject finds an object header such as `12 0 obj` that starts a line
+// or follows whitespace, so that `112 0 obj` doesn't match
+func indexPDFObject(data, object []byte) int {
+	for start := 0; ; {
+		i := bytes.Index(data[start:], object)
+		if i < 0 {
+			return -1
+		}
+		i += start
+		if i == 0 || isPDFSpace(data[i-1]) {
+			return i
+		}
+		start = i + 1
+	}
+}
+
+// isPDFSpace reports whether a byte is PDF whitespace
+func isPDFSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+// parsePDFDict reads the string values of the first dictionary in the data
+func parsePDFDict(data []byte) map[string]string {
+	values := make(map[string]string)
+
+	start := bytes.Index(data, []byte("<<"))
+	if start < 0 {
+		return values
+	}
+	data = data[start+2:]
+
+	var key string
+	for len(data) > 0 {
+		switch c := data[0]; {
+		case isPDFSpace(c):
+			data = data[1:]
+		case c == '>' && len(data) > 1 && data[1] == '>':
+			return values
+		case c == '/':
+			end := 1
+			for end < len(data) && !isPDFSpace(data[end]) && !strings.ContainsRune("/()<>[]{}%", rune(data[end])) {
+				end++
+			}
+			name := string(data[1:end])
+			data = data[end:]
+			if key == "" {
+				key = name
+			} else {
+				key = "" // a name used as a value
+			}
+		case c == '(':
+			value, rest := parsePDFLiteral(data)
+			if key != "" {
+				values[key] = value
+			}
+			key, data = "", rest
+		case c == '<' && (len(data) < 2 || data[1] != '<'):
+			end := bytes.IndexByte(data, '>')
+			if end < 0 {
+				return values
+			}
+			if key != "" {
+				values[key] = decodePDFText(decodePDFHex(data[1:end]))
+			}
+			key, data = "", data[end+1:]
+		default:
+			// Numbers, references, dates and arrays are skipped
+			end := 1
+			for end < len(data) && !isPDFSpace(data[end]) && !strings.ContainsRune("/(<>", rune(data[end])) {
+				end++
+			}
+			key, data = "", data[end:]
+		}
+	}
+	return values
+}
+
+// parsePDFLiteral reads a literal string starting at an opening parenthesis,
+// returning the decoded string and the remaining data
+func parsePDFLiteral(data []byte) (string, []byte) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// Line continuation
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+						n = n*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					out = append(out, byte(n))
+				} else {
+					out = append(out, e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return decodePDFText(out), data[i+1:]
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return decodePDFText(out), nil
+}
+
+// decodePDFHex decodes the contents of a hexadecimal string
+func decodePDFHex(hex []byte) []byte {
+	var digits []byte
+	for _, c := range hex {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return out
+		}
+		out = append(out, byte(n))
+	}
+	return out
+}
+
+// decodePDFText decodes a text string, which is either UTF-16BE with a byte
+// order mark or PDFDocEncoding, treated here as Latin-1
+func decodePDFText(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		units := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) {
+		return string(data[3:])
+	}
+	return latin1(data)
+}
+
+// splitAuthors splits an author list such as "Robert Jordan; Brandon Sanderson"
+// or "Robert Jordan and Brandon Sanderson". A single "Last, First" name is
+// kept whole.
+func splitAuthors(value string) []string {
+	for _, sep := range []string{";", " & ", " and "} {
+		if strings.Contains(value, sep) {
+			return strings.Split(value, sep)
+		}
+	}
+	return []string{value}
+}
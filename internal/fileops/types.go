@@ -0,0 +1,207 @@
+package fileops
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Kinds group MIME types into the coarse categories of the `type` taxonomy
+const (
+	KindImage    = "image"
+	KindAudio    = "audio"
+	KindVideo    = "video"
+	KindDocument = "document"
+	KindArchive  = "archive"
+	KindCode     = "code"
+	KindOther    = "other"
+)
+
+// extensionType is the MIME type a file extension stands for, and what
+// content detection reports for it when that differs. A sniffed type of
+// "text/*" accepts any text.
+type extensionType struct {
+	mimeType string
+	sniffed  string
+}
+
+// extensionTypes maps lower case file extensions to their MIME types
+var extensionTypes = map[string]extensionType{
+	".jpg":  {"image/jpeg", ""},
+	".jpeg": {"image/jpeg", ""},
+	".png":  {"image/png", ""},
+	".gif":  {"image/gif", ""},
+	".webp": {"image/webp", ""},
+	".bmp":  {"image/bmp", ""},
+	".tif":  {"image/tiff", ""},
+	".tiff": {"image/tiff", ""},
+	".heic": {"image/heic", ""},
+	".avif": {"image/avif", ""},
+	".ico":  {"image/x-icon", ""},
+	".svg":  {"image/svg+xml", "text/*"},
+
+	".mp3":  {"audio/mpeg", ""},
+	".flac": {"audio/flac", ""},
+	".ogg":  {"audio/ogg", "application/ogg"},
+	".opus": {"audio/ogg", "application/ogg"},
+	".m4a":  {"audio/mp4", ""},
+	".m4b":  {"audio/mp4", ""},
+	".wav":  {"audio/wave", ""},
+	".aiff": {"audio/aiff", ""},
+	".mid":  {"audio/midi", ""},
+
+	".mp4":  {"video/mp4", ""},
+	".m4v":  {"video/mp4", ""},
+	".mkv":  {"video/x-matroska", "video/webm"},
+	".webm": {"video/webm", ""},
+	".avi":  {"video/avi", ""},
+	".mov":  {"video/quicktime", ""},
+	".ogv":  {"video/ogg", "application/ogg"},
+
+	".pdf":  {"application/pdf", ""},
+	".epub": {"application/epub+zip", "application/zip"},
+	".mobi": {"application/x-mobipocket-ebook", ""},
+	".ps":   {"application/postscript", ""},
+	".doc":  {"application/msword", ""},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "application/zip"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "application/zip"},
+	".rtf":  {"text/rtf", "text/*"},
+	".txt":  {"text/plain", "text/*"},
+	".md":   {"text/markdown", "text/*"},
+	".csv":  {"text/csv", "text/*"},
+
+	".zip": {"application/zip", ""},
+	".gz":  {"application/x-gzip", ""},
+	".tgz": {"application/x-gzip", ""},
+	".tar": {"application/x-tar", ""},
+	".zst": {"application/zstd", ""},
+	".bz2": {"application/x-bzip2", ""},
+	".xz":  {"application/x-xz", ""},
+	".7z":  {"application/x-7z-compressed", ""},
+	".rar": {"application/x-rar-compressed", ""},
+
+	".go":   {"text/x-go", "text/*"},
+	".py":   {"text/x-python", "text/*"},
+	".js":   {"text/javascript", "text/*"},
+	".ts":   {"text/x-typescript", "text/*"},
+	".json": {"application/json", "text/*"},
+	".html": {"text/html", "text/*"},
+	".htm":  {"text/html", "text/*"},
+	".css":  {"text/css", "text/*"},
+	".xml":  {"text/xml", "text/*"},
+	".sh":   {"text/x-shellscript", "text/*"},
+	".c":    {"text/x-c", "text/*"},
+	".h":    {"text/x-c", "text/*"},
+	".rs":   {"text/x-rust", "text/*"},
+	".java": {"text/x-java", "text/*"},
+	".rb":   {"text/x-ruby", "text/*"},
+	".sql":  {"application/sql", "text/*"},
+	".yaml": {"text/yaml", "text/*"},
+	".yml":  {"text/yaml", "text/*"},
+	".toml": {"text/x-toml", "text/*"},
+}
+
+// mimeKinds holds the kinds of MIME types that their top level type doesn't
+// give
+var mimeKinds = map[string]string{
+	"application/ogg": KindAudio,
+
+	"application/pdf":                KindDocument,
+	"application/epub+zip":           KindDocument,
+	"application/x-mobipocket-ebook": KindDocument,
+	"application/postscript":         KindDocument,
+	"application/msword":             KindDocument,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   KindDocument,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         KindDocument,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": KindDocument,
+	"application/vnd.oasis.opendocument.text":                                   KindDocument,
+
+	"application/zip":              KindArchive,
+	"application/x-gzip":           KindArchive,
+	"application/x-tar":            KindArchive,
+	"application/zstd":             KindArchive,
+	"application/x-bzip2":          KindArchive,
+	"application/x-xz":             KindArchive,
+	"application/x-7z-compressed":  KindArchive,
+	"application/x-rar-compressed": KindArchive,
+
+	"text/x-go":          KindCode,
+	"text/x-python":      KindCode,
+	"text/javascript":    KindCode,
+	"text/x-typescript":  KindCode,
+	"application/json":   KindCode,
+	"text/html":          KindCode,
+	"text/css":           KindCode,
+	"text/xml":           KindCode,
+	"text/x-shellscript": KindCode,
+	"text/x-c":           KindCode,
+	"text/x-rust":        KindCode,
+	"text/x-java":        KindCode,
+	"text/x-ruby":        KindCode,
+	"application/sql":    KindCode,
+	"text/yaml":          KindCode,
+	"text/x-toml":        KindCode,
+}
+
+// FileType is what a file is, according to its content and its extension
+type FileType struct {
+	MIMEType string
+	Kind     string
+	Expected string // the type the extension stands for, if the content disagrees
+}
+
+// KindOf returns the kind of a MIME type
+func KindOf(mimeType string) string {
+	if kind, ok := mimeKinds[mimeType]; ok {
+		return kind
+	}
+	switch top, _, _ := strings.Cut(mimeType, "/"); top {
+	case "image":
+		return KindImage
+	case "audio":
+		return KindAudio
+	case "video":
+		return KindVideo
+	case "text":
+		return KindDocument
+	}
+	return KindOther
+}
+
+// ExtensionMIMEType returns the MIME type a file's extension stands for, or
+// "" if the extension isn't known
+func ExtensionMIMEType(path string) string {
+	return extensionTypes[strings.ToLower(filepath.Ext(path))].mimeType
+}
+
+// DetectFileType works out the type of a file from its content. When the
+// content agrees with the extension, or isn't recognised, the more specific
+// type of the extension is used, so a Go source file is text/x-go rather
+// than text/plain.
+func DetectFileType(path string) (FileType, error) {
+	detected, err := DetectMIMEType(path)
+	if err != nil {
+		return FileType{}, err
+	}
+	return fileType(path, detected), nil
+}
+
+// fileType combines the MIME type detected from a file's content with the
+// one its extension stands for
+func fileType(path, detected string) FileType {
+	t := FileType{MIMEType: detected}
+
+	ext, ok := extensionTypes[strings.ToLower(filepath.Ext(path))]
+	switch {
+	case !ok:
+	case detected == ext.mimeType || detected == ext.sniffed || detected == unknownMIMEType,
+		ext.sniffed == "text/*" && strings.HasPrefix(detected, "text/"):
+		t.MIMEType = ext.mimeType
+	default:
+		t.Expected = ext.mimeType
+	}
+
+	t.Kind = KindOf(t.MIMEType)
+	return t
+}
@@ -0,0 +1,190 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor("audio/flac", FLACExtractor{})
+	RegisterExtractor("application/ogg", OggExtractor{})
+}
+
+// vorbisFields maps Vorbis comment names to audio fields
+var vorbisFields = map[string]string{
+	"TITLE":       "title",
+	"ARTIST":      "artist",
+	"ALBUMARTIST": "album_artist",
+	"ALBUM":       "album",
+	"TRACKNUMBER": "track",
+	"DATE":        "year",
+	"GENRE":       "genre",
+}
+
+// maxCommentSize limits the size of a Vorbis comment block read into memory
+const maxCommentSize = 16 << 20
+
+// FLACExtractor reads the Vorbis comments of FLAC files
+type FLACExtractor struct{}
+
+// Extract reads the VORBIS_COMMENT metadata block of a FLAC file
+func (FLACExtractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+
+	md := Metadata{}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return md, nil
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if blockType == 4 && length <= maxCommentSize {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("truncated FLAC metadata: %w", err)
+			}
+			readVorbisComment(block, md)
+			return md, nil
+		}
+
+		if _, err := r.Discard(length); err != nil || last {
+			return md, nil
+		}
+	}
+}
+
+// OggExtractor reads the comment header of Ogg Vorbis and Opus files
+type OggExtractor struct{}
+
+// Extract reads the second packet of the first logical stream in an Ogg
+// file, which holds the comments of Vorbis, Opus and FLAC streams
+func (OggExtractor) Extract(path string) (Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	packets, err := readOggPackets(bufio.NewReader(file), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	md := Metadata{}
+	if len(packets) < 2 {
+		return md, nil
+	}
+
+	comment := packets[1]
+	switch {
+	case bytes.HasPrefix(comment, []byte("\x03vorbis")):
+		readVorbisComment(comment[7:], md)
+	case bytes.HasPrefix(comment, []byte("OpusTags")):
+		readVorbisComment(comment[8:], md)
+	case len(comment) > 4 && comment[0]&0x7F == 4:
+		// FLAC in Ogg wraps its metadata blocks in packets
+		readVorbisComment(comment[4:], md)
+	}
+	return md, nil
+}
+
+// readOggPackets reassembles the first packets of the first logical stream
+func readOggPackets(r io.Reader, count int) ([][]byte, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	first := true
+
+	for len(packets) < count {
+		header := make([]byte, 27)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return packets, nil
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, fmt.Errorf("invalid Ogg page")
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, fmt.Errorf("truncated Ogg page: %w", err)
+		}
+		size := 0
+		for _, s := range segments {
+			size += int(s)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("truncated Ogg page: %w", err)
+		}
+
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+		if first {
+			serial, first = pageSerial, false
+		}
+		if pageSerial != serial {
+			continue
+		}
+
+		for _, s := range segments {
+			current = append(current, body[:s]...)
+			body = body[s:]
+			if len(current) > maxCommentSize {
+				return nil, fmt.Errorf("Ogg packet too large")
+			}
+			if s < 255 {
+				packets = append(packets, current)
+				current = nil
+			}
+		}
+	}
+	return packets, nil
+}
+
+// readVorbisComment reads the fields of a Vorbis comment block
+func readVorbisComment(block []byte, md Metadata) {
+	r := bytes.NewReader(block)
+
+	var vendorLen uint32
+	if binary.Read(r, binary.LittleEndian, &vendorLen) != nil || int64(vendorLen) > int64(r.Len()) {
+		return
+	}
+	r.Seek(int64(vendorLen), io.SeekCurrent)
+
+	var count uint32
+	if binary.Read(r, binary.LittleEndian, &count) != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var length uint32
+		if binary.Read(r, binary.LittleEndian, &length) != nil || int64(length) > int64(r.Len()) {
+			return
+		}
+		comment := make([]byte, length)
+		r.Read(comment)
+
+		name, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		if field, ok := vorbisFields[strings.ToUpper(name)]; ok {
+			addAudioField(md, field, value)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package fileops
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// XMP namespaces read for document metadata
+const (
+	nsRDF           = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC            = "http://purl.org/dc/elements/1.1/"
+	nsPRISM         = "http://prismstandard.org/namespaces/basic/2.0/"
+	nsCalibre       = "http://calibre-ebook.com/xmp-namespace"
+	nsCalibreSeries = "http://calibre-ebook.com/xmp-namespace-series-index"
+)
+
+// xmpFields maps XMP properties to document fields
+var xmpFields = map[xml.Name]string{
+	{Space: nsDC, Local: "title"}:                   "title",
+	{Space: nsDC, Local: "creator"}:                 "author",
+	{Space: nsDC, Local: "publisher"}:               "publisher",
+	{Space: nsDC, Local: "identifier"}:              "isbn",
+	{Space: nsDC, Local: "subject"}:                 "subject",
+	{Space: nsPRISM, Local: "isbn"}:                 "isbn",
+	{Space: nsCalibre, Local: "series"}:             "series",
+	{Space: nsCalibreSeries, Local: "series_index"}: "series_index",
+}
+
+// readXMP adds the document fields of an XMP packet. Values of a property are
+// read from its rdf:li and rdf:value children, or from an attribute of an
+// rdf:Description.
+func readXMP(packet []byte, md Metadata) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				for _, attr := range t.Attr {
+					if field, ok := xmpFields[attr.Name]; ok {
+						addDocumentField(md, field, attr.Value)
+					}
+				}
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			// The property is the innermost element outside the RDF namespace
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space == nsRDF {
+					continue
+				}
+				if field, ok := xmpFields[stack[i]]; ok {
+					addDocumentField(md, field, string(t))
+				}
+				break
+			}
+		}
+	}
+}
+
+// addDocumentField adds a value to a document field. Identifiers are kept only
+// if they are ISBNs, and series indexes are written without trailing zeros.
+func addDocumentField(md Metadata, field, value string) {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "isbn":
+		isbn, ok := normalizeISBN(value)
+		if !ok {
+			return
+		}
+		value = isbn
+	case "series_index":
+		if strings.Contains(value, ".") {
+			value = strings.TrimSuffix(strings.TrimRight(value, "0"), ".")
+		}
+	case "title":
+		// Only the first title is kept, later ones are translations or
+		// subtitles
+		if len(md["doc.title"]) > 0 {
+			return
+		}
+	}
+	md.Add("doc."+field, value)
+}
+
+// normalizeISBN extracts an ISBN-10 or ISBN-13 from identifiers such as
+// "urn:isbn:978-0-312-85009-7" or "ISBN 0312850093"
+func normalizeISBN(value string) (string, bool) {
+	value = strings.ToUpper(value)
+	value = strings.TrimPrefix(value, "URN:")
+	value = strings.TrimPrefix(value, "ISBN")
+	value = strings.TrimLeft(value, ": ")
+
+	var digits []byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c >= '0' && c <= '9', c == 'X':
+			digits = append(digits, c)
+		case c == '-' || c == ' ':
+		default:
+			return "", false
+		}
+	}
+
+	switch len(digits) {
+	case 10:
+		if bytes.IndexByte(digits[:9], 'X') >= 0 {
+			return "", false
+		}
+	case 13:
+		if bytes.IndexByte(digits, 'X') >= 0 || !(bytes.HasPrefix(digits, []byte("978")) || bytes.HasPrefix(digits, []byte("979"))) {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return string(digits), true
+}
@@ -0,0 +1,140 @@
+package importers
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CalibreDatabase is the name of a Calibre library's database
+const CalibreDatabase = "metadata.db"
+
+// CalibreBook is a book in a Calibre library
+type CalibreBook struct {
+	ID          int64
+	Title       string
+	Authors     []CalibreAuthor
+	Series      string
+	SeriesIndex float64
+	Tags        []string
+	Publisher   string
+	// Identifiers maps identifier types such as isbn or goodreads to values
+	Identifiers map[string]string
+	// Formats are the paths of the book's files relative to the library
+	Formats []string
+}
+
+// CalibreAuthor is an author with the name Calibre sorts by, such as
+// "Jordan, Robert"
+type CalibreAuthor struct {
+	Name string
+	Sort string
+}
+
+// ReadCalibre reads the books of the Calibre library in a directory
+func ReadCalibre(libraryDir string) ([]*CalibreBook, error) {
+	path := filepath.Join(libraryDir, CalibreDatabase)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open Calibre library: %w", err)
+	}
+	dsn, err := readOnlyDSN(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Calibre library: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Calibre library: %w", err)
+	}
+	defer db.Close()
+
+	var books []*CalibreBook
+	byID := make(map[int64]*CalibreBook)
+	dirs := make(map[int64]string)
+
+	rows, err := db.Query(`SELECT id, title, path, COALESCE(series_index, 1) FROM books ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Calibre books: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		book := &CalibreBook{Identifiers: make(map[string]string)}
+		var dir string
+		if err := rows.Scan(&book.ID, &book.Title, &dir, &book.SeriesIndex); err != nil {
+			return nil, fmt.Errorf("failed to read Calibre books: %w", err)
+		}
+		books = append(books, book)
+		byID[book.ID] = book
+		dirs[book.ID] = dir
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Calibre books: %w", err)
+	}
+
+	// Each query returns a book ID and values that are added to the book
+	readers := []struct {
+		query string
+		add   func(book *CalibreBook, values []string)
+	}{
+		{`SELECT l.book, a.name, COALESCE(a.sort, a.name) FROM books_authors_link l
+          JOIN authors a ON a.id = l.author ORDER BY l.id`,
+			func(book *CalibreBook, v []string) {
+				book.Authors = append(book.Authors, CalibreAuthor{Name: calibreName(v[0]), Sort: v[1]})
+			}},
+		{`SELECT l.book, s.name FROM books_series_link l JOIN series s ON s.id = l.series`,
+			func(book *CalibreBook, v []string) { book.Series = v[0] }},
+		{`SELECT l.book, t.name FROM books_tags_link l JOIN tags t ON t.id = l.tag ORDER BY t.name`,
+			func(book *CalibreBook, v []string) { book.Tags = append(book.Tags, v[0]) }},
+		{`SELECT l.book, p.name FROM books_publishers_link l JOIN publishers p ON p.id = l.publisher`,
+			func(book *CalibreBook, v []string) { book.Publisher = v[0] }},
+		{`SELECT book, type, val FROM identifiers`,
+			func(book *CalibreBook, v []string) { book.Identifiers[strings.ToLower(v[0])] = v[1] }},
+		{`SELECT book, name || '.' || lower(format) FROM data ORDER BY format`,
+			func(book *CalibreBook, v []string) {
+				book.Formats = append(book.Formats, filepath.Join(filepath.FromSlash(dirs[book.ID]), v[0]))
+			}},
+	}
+	for _, r := range readers {
+		if err := readCalibreValues(db, r.query, byID, r.add); err != nil {
+			return nil, err
+		}
+	}
+	return books, nil
+}
+
+// readCalibreValues runs a query whose first column is a book ID and adds
+// the other columns to the book
+func readCalibreValues(db *sql.DB, query string, books map[int64]*CalibreBook, add func(*CalibreBook, []string)) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to read Calibre library: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read Calibre library: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		values := make([]string, len(columns)-1)
+		dest := []any{&id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read Calibre library: %w", err)
+		}
+		if book, ok := books[id]; ok {
+			add(book, values)
+		}
+	}
+	return rows.Err()
+}
+
+// calibreName restores the commas of an author name, which Calibre stores
+// as pipes since it separates authors with commas
+func calibreName(name string) string {
+	return strings.ReplaceAll(name, "|", ",")
+}
@@ -0,0 +1,109 @@
+package importers
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeCalibre creates a Calibre library database in a directory with one
+// book in two formats
+func writeCalibre(t *testing.T, dir string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, CalibreDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT, path TEXT, series_index REAL)`,
+		`CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT, sort TEXT)`,
+		`CREATE TABLE books_authors_link (id INTEGER PRIMARY KEY, book INTEGER, author INTEGER)`,
+		`CREATE TABLE series (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_series_link (id INTEGER PRIMARY KEY, book INTEGER, series INTEGER)`,
+		`CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_tags_link (id INTEGER PRIMARY KEY, book INTEGER, tag INTEGER)`,
+		`CREATE TABLE publishers (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE books_publishers_link (id INTEGER PRIMARY KEY, book INTEGER, publisher INTEGER)`,
+		`CREATE TABLE identifiers (id INTEGER PRIMARY KEY, book INTEGER, type TEXT, val TEXT)`,
+		`CREATE TABLE data (id INTEGER PRIMARY KEY, book INTEGER, format TEXT, name TEXT)`,
+		`INSERT INTO books VALUES (1, 'The Eye of the World', 'Robert Jordan/The Eye of the World (1)', 1)`,
+		`INSERT INTO books VALUES (2, 'Notes', 'Anonymous/Notes (2)', NULL)`,
+		`INSERT INTO authors VALUES (1, 'Robert Jordan', 'Jordan, Robert'), (2, 'Smith| Jr.', 'Smith, Jr.')`,
+		`INSERT INTO books_authors_link VALUES (1, 1, 1), (2, 1, 2)`,
+		`INSERT INTO series VALUES (1, 'The Wheel of Time')`,
+		`INSERT INTO books_series_link VALUES (1, 1, 1)`,
+		`INSERT INTO tags VALUES (1, 'fantasy'), (2, 'epic')`,
+		`INSERT INTO books_tags_link VALUES (1, 1, 1), (2, 1, 2)`,
+		`INSERT INTO publishers VALUES (1, 'Tor')`,
+		`INSERT INTO books_publishers_link VALUES (1, 1, 1)`,
+		`INSERT INTO identifiers VALUES (1, 1, 'ISBN', '9780312850098')`,
+		`INSERT INTO data VALUES (1, 1, 'EPUB', 'The Eye of the World - Robert Jordan'), (2, 1, 'PDF', 'The Eye of the World - Robert Jordan')`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCalibre(t *testing.T) {
+	dir := t.TempDir()
+	writeCalibre(t, dir)
+
+	books, err := ReadCalibre(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("got %d books, want 2", len(books))
+	}
+
+	bookDir := filepath.Join("Robert Jordan", "The Eye of the World (1)")
+	want := &CalibreBook{
+		ID:          1,
+		Title:       "The Eye of the World",
+		Authors:     []CalibreAuthor{{Name: "Robert Jordan", Sort: "Jordan, Robert"}, {Name: "Smith, Jr.", Sort: "Smith, Jr."}},
+		Series:      "The Wheel of Time",
+		SeriesIndex: 1,
+		Tags:        []string{"epic", "fantasy"},
+		Publisher:   "Tor",
+		Identifiers: map[string]string{"isbn": "9780312850098"},
+		Formats: []string{
+			filepath.Join(bookDir, "The Eye of the World - Robert Jordan.epub"),
+			filepath.Join(bookDir, "The Eye of the World - Robert Jordan.pdf"),
+		},
+	}
+	if !reflect.DeepEqual(books[0], want) {
+		t.Errorf("book = %+v, want %+v", books[0], want)
+	}
+	if books[1].SeriesIndex != 1 || len(books[1].Formats) != 0 {
+		t.Errorf("book without series or formats = %+v", books[1])
+	}
+}
+
+func TestReadCalibreMissing(t *testing.T) {
+	if _, err := ReadCalibre(t.TempDir()); err == nil {
+		t.Error("ReadCalibre of a directory without a library succeeded")
+	}
+}
+
+func TestReadCalibreURIPath(t *testing.T) {
+	// Characters that mean something in a URI are part of the path
+	dir := filepath.Join(t.TempDir(), "Calibre #1 100%")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeCalibre(t, dir)
+
+	books, err := ReadCalibre(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 {
+		t.Errorf("read %d books, want 2", len(books))
+	}
+}
@@ -0,0 +1,185 @@
+// Package importers reads the tags of other tagging tools
+package importers
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TMSU is the content of a TMSU database
+type TMSU struct {
+	// Algorithm is the fingerprint algorithm of the files, such as
+	// SHA256 or dynamic:SHA256
+	Algorithm string
+	Files     []TMSUFile
+}
+
+// TMSUFile is a tagged file in a TMSU database
+type TMSUFile struct {
+	Path        string
+	Fingerprint string
+	Size        int64
+	Tags        []TMSUTag
+}
+
+// TMSUTag is a TMSU tag, which may have a value
+type TMSUTag struct {
+	Name  string
+	Value string
+}
+
+const (
+	// tmsuDefaultAlgorithm is the fingerprint algorithm of databases that
+	// don't set one
+	tmsuDefaultAlgorithm = "dynamic:SHA256"
+	// Dynamic fingerprints of files above tmsuSparseThreshold hash three
+	// samples of tmsuSparseSize bytes
+	tmsuSparseThreshold = 5 * 1024 * 1024
+	tmsuSparseSize      = 512 * 1024
+)
+
+// readOnlyDSN returns the data source name that opens the SQLite database at
+// a path read-only. The path is made absolute, since a relative one would be
+// taken as the authority of the URI, and escaped, so that characters such as
+// ? and # in it aren't read as part of the URI.
+func readOnlyDSN(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}
+	return u.String(), nil
+}
+
+// ReadTMSU reads the tagged files of a TMSU database. Tagged directories are
+// left out.
+func ReadTMSU(path string) (*TMSU, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open TMSU database: %w", err)
+	}
+	dsn, err := readOnlyDSN(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TMSU database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TMSU database: %w", err)
+	}
+	defer db.Close()
+
+	t := &TMSU{Algorithm: tmsuDefaultAlgorithm}
+	err = db.QueryRow(`SELECT value FROM setting WHERE name = 'fileFingerprintAlgorithm'`).Scan(&t.Algorithm)
+	if err != nil && err != sql.ErrNoRows && !strings.Contains(err.Error(), "no such table") {
+		return nil, fmt.Errorf("failed to read TMSU settings: %w", err)
+	}
+
+	rows, err := db.Query(`
+        SELECT f.id, f.directory, f.name, f.fingerprint, f.size,
+               t.name, COALESCE(v.name, '')
+        FROM file f
+        JOIN file_tag ft ON ft.file_id = f.id
+        JOIN tag t ON t.id = ft.tag_id
+        LEFT JOIN value v ON v.id = ft.value_id
+        WHERE NOT f.is_dir
+        ORDER BY f.id, t.name, v.name
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TMSU files: %w", err)
+	}
+	defer rows.Close()
+
+	lastID := int64(-1)
+	for rows.Next() {
+		var id int64
+		var dir, name string
+		var file TMSUFile
+		var tag TMSUTag
+		if err := rows.Scan(&id, &dir, &name, &file.Fingerprint, &file.Size, &tag.Name, &tag.Value); err != nil {
+			return nil, fmt.Errorf("failed to read TMSU files: %w", err)
+		}
+		if id != lastID {
+			file.Path = filepath.Join(dir, name)
+			t.Files = append(t.Files, file)
+			lastID = id
+		}
+		last := &t.Files[len(t.Files)-1]
+		last.Tags = append(last.Tags, tag)
+	}
+	return t, rows.Err()
+}
+
+// IsContentHash reports whether a file's fingerprint is the SHA-256 of its
+// whole content, as the hashes of files in the archive are
+func (t *TMSU) IsContentHash(f TMSUFile) bool {
+	switch t.Algorithm {
+	case "SHA256":
+		return true
+	case "dynamic:SHA256":
+		return f.Size <= tmsuSparseThreshold
+	}
+	return false
+}
+
+// CanFingerprint reports whether Fingerprint supports the algorithm of the
+// database
+func (t *TMSU) CanFingerprint() bool {
+	return t.newHash() != nil
+}
+
+// Fingerprint computes the fingerprint TMSU gives a file of the given size
+func (t *TMSU) Fingerprint(path string, size int64) (string, error) {
+	h := t.newHash()
+	if h == nil {
+		return "", fmt.Errorf("unsupported TMSU fingerprint algorithm %s", t.Algorithm)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if !strings.HasPrefix(t.Algorithm, "dynamic:") || size <= tmsuSparseThreshold {
+		if _, err := io.Copy(h, file); err != nil {
+			return "", fmt.Errorf("failed to calculate fingerprint: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	// The start, middle and end of the file
+	buf := make([]byte, tmsuSparseSize)
+	for _, offset := range []int64{0, (size - tmsuSparseSize) / 2, size - tmsuSparseSize} {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to calculate fingerprint: %w", err)
+		}
+		h.Write(buf[:n])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newHash returns the hash of the database's algorithm, or nil if it is not
+// supported
+func (t *TMSU) newHash() hash.Hash {
+	switch strings.TrimPrefix(t.Algorithm, "dynamic:") {
+	case "SHA256":
+		return sha256.New()
+	case "SHA1":
+		return sha1.New()
+	case "MD5":
+		return md5.New()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package importers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTMSU creates a TMSU database with a tagged file, a tagged directory
+// and the given fingerprint algorithm, or none if it is empty
+func writeTMSU(t *testing.T, path, algorithm string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE TABLE setting (name TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+		`CREATE TABLE file (id INTEGER PRIMARY KEY, directory TEXT NOT NULL, name TEXT NOT NULL,
+            fingerprint TEXT NOT NULL, mod_time DATETIME NOT NULL, size INTEGER NOT NULL, is_dir BOOLEAN NOT NULL)`,
+		`CREATE TABLE tag (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE value (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE file_tag (file_id INTEGER NOT NULL, tag_id INTEGER NOT NULL, value_id INTEGER NOT NULL)`,
+		`INSERT INTO file VALUES (1, '/music', 'song.mp3', 'abc', '2024-01-01', 3, 0)`,
+		`INSERT INTO file VALUES (2, '/music', 'albums', '', '2024-01-01', 0, 1)`,
+		`INSERT INTO tag VALUES (1, 'rock'), (2, 'year')`,
+		`INSERT INTO value VALUES (1, '1980')`,
+		`INSERT INTO file_tag VALUES (1, 1, 0), (1, 2, 1), (2, 1, 0)`,
+	}
+	if algorithm != "" {
+		queries = append(queries, `INSERT INTO setting VALUES ('fileFingerprintAlgorithm', '`+algorithm+`')`)
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadTMSU(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	writeTMSU(t, path, "")
+
+	got, err := ReadTMSU(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &TMSU{
+		Algorithm: "dynamic:SHA256",
+		Files: []TMSUFile{{
+			Path:        "/music/song.mp3",
+			Fingerprint: "abc",
+			Size:        3,
+			Tags:        []TMSUTag{{Name: "rock"}, {Name: "year", Value: "1980"}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadTMSU = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadTMSUMissing(t *testing.T) {
+	if _, err := ReadTMSU(filepath.Join(t.TempDir(), "db")); err == nil {
+		t.Error("ReadTMSU of a missing database succeeded")
+	}
+}
+
+func TestTMSUFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	content := "la la la"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sha := sha256.Sum256([]byte(content))
+	md := md5.Sum([]byte(content))
+
+	tests := []struct {
+		algorithm string
+		want      string
+		content   bool
+	}{
+		{"dynamic:SHA256", hex.EncodeToString(sha[:]), true},
+		{"SHA256", hex.EncodeToString(sha[:]), true},
+		{"MD5", hex.EncodeToString(md[:]), false},
+	}
+	for _, tt := range tests {
+		tmsu := &TMSU{Algorithm: tt.algorithm}
+		got, err := tmsu.Fingerprint(path, int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s fingerprint = %s, want %s", tt.algorithm, got, tt.want)
+		}
+		if is := tmsu.IsContentHash(TMSUFile{Size: int64(len(content))}); is != tt.content {
+			t.Errorf("%s IsContentHash = %v, want %v", tt.algorithm, is, tt.content)
+		}
+	}
+
+	if (&TMSU{Algorithm: "BLAKE2b"}).CanFingerprint() {
+		t.Error("CanFingerprint of BLAKE2b = true")
+	}
+	large := &TMSU{Algorithm: "dynamic:SHA256"}
+	if large.IsContentHash(TMSUFile{Size: tmsuSparseThreshold + 1}) {
+		t.Error("IsContentHash of a sparse fingerprint = true")
+	}
+	if _, err := (&TMSU{Algorithm: "BLAKE2b"}).Fingerprint(path, 1); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("BLAKE2b fingerprint error = %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// DefaultField is the taxonomy searched by terms that don't name one
+const DefaultField = "tags"
+
+// PropertyField introduces a term on a file property, e.g. `prop:isbn=123`
+const PropertyField = "prop"
+
+// Fields of terms on the detected type of a file, e.g. `kind:image` or
+// `mime:image/*`
+const (
+	MIMEField = "mime"
+	KindField = "kind"
+)
+
+// Op is the comparison made by a search term
+type Op string
+
+const (
+	OpEqual        Op = "="
+	OpLess         Op = "<"
+	OpLessEqual    Op = "<="
+	OpGreater      Op = ">"
+	OpGreaterEqual Op = ">="
+	OpRange        Op = ".."
+	OpContains     Op = "~"
+	OpExists       Op = "?"
+)
+
+// Term is a single condition of a search, such as `year:1990..1999`
+type Term struct {
+	Field  string // taxonomy name, PropertyField, MIMEField or KindField
+	Key    string // property name of a PropertyField term
+	Op     Op
+	Value  string // the value compared against, or the lower bound of a range
+	Value2 string // the upper bound of a range
+	Raw    string // the value as written, before a range was split out
+}
+
+// Query is a parsed search. Files must match every term.
+type Query struct {
+	Terms    []Term
+	Sort     string // taxonomy to order the results by
+	SortDesc bool
+}
+
+// termPattern splits a term into its field, operator and value
+var termPattern = regexp.MustCompile(`^([\p{L}\p{N}_.-]+?)(:|>=|<=|>|<|=)(.*)$`)
+
+// Parse parses the arguments of a search:
+//
+//	fantasy                   a tag in the default taxonomy
+//	--series "Wheel of Time"  a tag in the named taxonomy
+//	series:"Wheel of Time"    the same
+//	year:1990..1999           an inclusive range, either end may be left open
+//	rating>=4                 a comparison, also >, < and <=
+//	prop:isbn=9780312850098   a property with an exact value
+//	prop:notes~signed         a property containing a value, ignoring case
+//	prop:notes                a file that has the property
+//	kind:image                a file of a kind: image, audio, video, document, archive, code or other
+//	mime:image/*              a file whose MIME type matches a pattern
+//	--sort year               order by a taxonomy, prefix it with - to reverse
+func Parse(args []string) (*Query, error) {
+	q := &Query{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if strings.HasPrefix(arg, "--") {
+			name := strings.TrimPrefix(arg, "--")
+			if name == "" {
+				return nil, fmt.Errorf("taxonomy name cannot be empty")
+			}
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+
+			if name == "sort" {
+				q.Sort = strings.TrimPrefix(args[i], "-")
+				q.SortDesc = strings.HasPrefix(args[i], "-")
+				continue
+			}
+			q.Terms = append(q.Terms, Term{Field: name, Op: OpEqual, Value: args[i], Raw: args[i]})
+			continue
+		}
+
+		term, err := ParseTerm(arg)
+		if err != nil {
+			return nil, err
+		}
+		q.Terms = append(q.Terms, term)
+	}
+
+	if len(q.Terms) == 0 {
+		return nil, fmt.Errorf("search requires at least one term")
+	}
+	return q, nil
+}
+
+// ParseTerm parses a single `field:value` or `field>=value` style term. A
+// term without an operator matches a tag in the default taxonomy, as does one
+// whose field has no letters, such as the time `10:30`.
+func ParseTerm(s string) (Term, error) {
+	m := termPattern.FindStringSubmatch(s)
+	if m == nil || strings.IndexFunc(m[1], unicode.IsLetter) < 0 {
+		return Term{Field: DefaultField, Op: OpEqual, Value: s, Raw: s}, nil
+	}
+
+	field, op, value := strings.ToLower(m[1]), Op(m[2]), m[3]
+	if op == ":" {
+		op = OpEqual
+	}
+	if value == "" {
+		return Term{}, fmt.Errorf("missing value in search term %q", s)
+	}
+
+	switch field {
+	case PropertyField:
+		return parsePropertyTerm(s, op, value)
+	case MIMEField, KindField:
+		if op != OpEqual {
+			return Term{}, fmt.Errorf("search term %q must be written %s:<value>", s, field)
+		}
+		return Term{Field: field, Op: op, Value: strings.ToLower(value), Raw: value}, nil
+	}
+
+	term := Term{Field: field, Op: op, Value: value, Raw: value}
+	if op == OpEqual {
+		if low, high, ok := strings.Cut(value, string(OpRange)); ok && !strings.Contains(high, string(OpRange)) {
+			if low == "" && high == "" {
+				return Term{}, fmt.Errorf("range in search term %q needs at least one bound", s)
+			}
+			term.Op, term.Value, term.Value2 = OpRange, low, high
+		}
+	}
+	return term, nil
+}
+
+// parsePropertyTerm parses the `name=value`, `name~value` or `name` that
+// follows `prop:`
+func parsePropertyTerm(s string, op Op, value string) (Term, error) {
+	if op != OpEqual {
+		return Term{}, fmt.Errorf("property search term %q must be written prop:<name>=<value>", s)
+	}
+
+	term := Term{Field: PropertyField, Op: OpExists, Key: value}
+	if i := strings.IndexAny(value, "=~"); i >= 0 {
+		term.Key, term.Op, term.Value = value[:i], Op(value[i:i+1]), value[i+1:]
+		term.Raw = term.Value
+	}
+	if term.Key == "" {
+		return Term{}, fmt.Errorf("missing property name in search term %q", s)
+	}
+	return term, nil
+}
+
+// Split splits a search written as a single string, such as
+// `series:"Wheel of Time" year>=1990`, into the arguments Parse takes. Double
+// or single quotes group words and are removed, and a backslash escapes a
+// quote or a space. Other backslashes are kept, so `a\/b` stays one tag name.
+func Split(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"' \`, runes[i+1]):
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in search %q", s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Join writes the arguments of a search as a single string that Split turns
+// back into the same arguments, quoting those with spaces or quotes
+func Join(args []string) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		quoted := arg == "" || strings.ContainsAny(arg, "\"' \t\n")
+		var b strings.Builder
+		if quoted {
+			b.WriteByte('"')
+		}
+		runes := []rune(arg)
+		for j, r := range runes {
+			switch {
+			case r == '"' || r == '\'':
+				b.WriteByte('\\')
+			case r == '\\' && (j+1 == len(runes) || strings.ContainsRune(`"' \`, runes[j+1])):
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		if quoted {
+			b.WriteByte('"')
+		}
+		parts[i] = b.String()
+	}
+	return strings.Join(parts, " ")
+}
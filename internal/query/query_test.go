@@ -0,0 +1,154 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTerm(t *testing.T) {
+	tests := []struct {
+		term    string
+		want    Term
+		wantErr bool
+	}{
+		{term: "fantasy", want: Term{Field: DefaultField, Op: OpEqual, Value: "fantasy", Raw: "fantasy"}},
+		{term: "series:Wheel", want: Term{Field: "series", Op: OpEqual, Value: "Wheel", Raw: "Wheel"}},
+		{term: "Genre:Fantasy", want: Term{Field: "genre", Op: OpEqual, Value: "Fantasy", Raw: "Fantasy"}},
+		{term: "genre:fiction/fantasy", want: Term{Field: "genre", Op: OpEqual, Value: "fiction/fantasy", Raw: "fiction/fantasy"}},
+
+		// A field without letters is part of a bare tag
+		{term: "10:30", want: Term{Field: DefaultField, Op: OpEqual, Value: "10:30", Raw: "10:30"}},
+		{term: "1<2", want: Term{Field: DefaultField, Op: OpEqual, Value: "1<2", Raw: "1<2"}},
+		{term: "1990..1999", want: Term{Field: DefaultField, Op: OpEqual, Value: "1990..1999", Raw: "1990..1999"}},
+
+		// Ranges
+		{term: "year:1990..1999", want: Term{Field: "year", Op: OpRange, Value: "1990", Value2: "1999", Raw: "1990..1999"}},
+		{term: "year:..1999", want: Term{Field: "year", Op: OpRange, Value2: "1999", Raw: "..1999"}},
+		{term: "year:1990..", want: Term{Field: "year", Op: OpRange, Value: "1990", Raw: "1990.."}},
+		{term: "date:2024-01-01..2024-12-31", want: Term{Field: "date", Op: OpRange, Value: "2024-01-01", Value2: "2024-12-31", Raw: "2024-01-01..2024-12-31"}},
+		{term: "title:a..b..c", want: Term{Field: "title", Op: OpEqual, Value: "a..b..c", Raw: "a..b..c"}},
+		{term: "year:..", wantErr: true},
+
+		// Comparisons
+		{term: "rating>=4", want: Term{Field: "rating", Op: OpGreaterEqual, Value: "4", Raw: "4"}},
+		{term: "rating<=4", want: Term{Field: "rating", Op: OpLessEqual, Value: "4", Raw: "4"}},
+		{term: "rating>4", want: Term{Field: "rating", Op: OpGreater, Value: "4", Raw: "4"}},
+		{term: "rating<4", want: Term{Field: "rating", Op: OpLess, Value: "4", Raw: "4"}},
+		{term: "rating=4", want: Term{Field: "rating", Op: OpEqual, Value: "4", Raw: "4"}},
+		{term: "year:", wantErr: true},
+		{term: "rating>=", wantErr: true},
+
+		// Properties
+		{term: "prop:isbn=9780312850098", want: Term{Field: PropertyField, Key: "isbn", Op: OpEqual, Value: "9780312850098", Raw: "9780312850098"}},
+		{term: "prop:notes~signed", want: Term{Field: PropertyField, Key: "notes", Op: OpContains, Value: "signed", Raw: "signed"}},
+		{term: "prop:notes", want: Term{Field: PropertyField, Key: "notes", Op: OpExists}},
+		{term: "prop:=1", wantErr: true},
+		{term: "prop>3", wantErr: true},
+
+		// Types
+		{term: "kind:Image", want: Term{Field: KindField, Op: OpEqual, Value: "image", Raw: "Image"}},
+		{term: "mime:image/*", want: Term{Field: MIMEField, Op: OpEqual, Value: "image/*", Raw: "image/*"}},
+		{term: "kind>image", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTerm(tt.term)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTerm(%q) = %+v, want an error", tt.term, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTerm(%q) failed: %v", tt.term, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTerm(%q) = %+v, want %+v", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    *Query
+		wantErr bool
+	}{
+		{
+			args: []string{"fantasy", "year:1990..1999"},
+			want: &Query{Terms: []Term{
+				{Field: DefaultField, Op: OpEqual, Value: "fantasy", Raw: "fantasy"},
+				{Field: "year", Op: OpRange, Value: "1990", Value2: "1999", Raw: "1990..1999"},
+			}},
+		},
+		{
+			args: []string{"--series", "Wheel of Time", "--sort", "-year"},
+			want: &Query{
+				Terms:    []Term{{Field: "series", Op: OpEqual, Value: "Wheel of Time", Raw: "Wheel of Time"}},
+				Sort:     "year",
+				SortDesc: true,
+			},
+		},
+		{
+			// Values of --<taxonomy> are taken as they are
+			args: []string{"--time", "10:30..11:00"},
+			want: &Query{Terms: []Term{{Field: "time", Op: OpEqual, Value: "10:30..11:00", Raw: "10:30..11:00"}}},
+		},
+		{
+			args: []string{"rating>=4", "--sort", "rating"},
+			want: &Query{
+				Terms: []Term{{Field: "rating", Op: OpGreaterEqual, Value: "4", Raw: "4"}},
+				Sort:  "rating",
+			},
+		},
+		{args: nil, wantErr: true},
+		{args: []string{"--sort", "year"}, wantErr: true},
+		{args: []string{"--series"}, wantErr: true},
+		{args: []string{"--", "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", tt.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{`fantasy year>=1990`, []string{"fantasy", "year>=1990"}},
+		{`series:"Wheel of Time"`, []string{"series:Wheel of Time"}},
+		{`'it''s'`, []string{"its"}},
+		{`a\ b`, []string{"a b"}},
+		{`music/AC\/DC`, []string{`music/AC\/DC`}},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.search)
+		if err != nil {
+			t.Errorf("Split(%q) failed: %v", tt.search, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.search, got, tt.want)
+		}
+		if again, err := Split(Join(got)); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("Split(Join(%q)) = %q, %v", got, again, err)
+		}
+	}
+	if _, err := Split(`"open`); err == nil {
+		t.Error(`Split("\"open") succeeded, want an error`)
+	}
+}
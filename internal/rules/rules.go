@@ -0,0 +1,240 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// File is the name of the rules file, kept next to the database at the root
+// of the archive
+const File = ".fart-rules"
+
+// Action is a tag or property that a rule sets. Its value is a template in
+// which `{name}` is replaced by the text the pattern captured as name.
+type Action struct {
+	Taxonomy string
+	Property string // set instead of Taxonomy for property actions
+	Value    string
+}
+
+// Rule pairs a pattern over archive-relative paths with the actions applied
+// to the files it matches
+type Rule struct {
+	Line    int    // line of the rules file the rule is on
+	Pattern string // the pattern as written
+	Actions []Action
+	re      *regexp.Regexp
+}
+
+// capturePattern finds the `{name}` references of globs and templates
+var capturePattern = regexp.MustCompile(`\{([\p{L}\p{N}_]+)\}`)
+
+// Load reads the rules file at a path. A missing file has no rules.
+func Load(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rules file: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Parse reads rules, one per line:
+//
+//	books/{author}/{series}/*  ->  author={author} series={series}
+//	photos/{year}/**           ->  year={year}
+//	re:^music/(?P<artist>[^/]+)/  ->  artist={artist} prop:source=rip
+//
+// A glob's `*` matches within a directory, `**` matches any number of
+// directories and `{name}` captures part of a directory or file name. A
+// pattern starting with `re:` is a regular expression with named groups.
+// Values containing spaces are written in double quotes, and lines starting
+// with # are comments.
+func Parse(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rule, err := parseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rule.Line = line
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	return rules, nil
+}
+
+// parseRule parses a single `pattern -> action...` rule
+func parseRule(text string) (Rule, error) {
+	pattern, actions, ok := strings.Cut(text, "->")
+	if !ok {
+		return Rule{}, fmt.Errorf("rule must be written <pattern> -> <action>...")
+	}
+
+	rule := Rule{Pattern: strings.TrimSpace(pattern)}
+	var err error
+	if expr, ok := strings.CutPrefix(rule.Pattern, "re:"); ok {
+		rule.re, err = regexp.Compile(expr)
+	} else {
+		rule.re, err = globPattern(rule.Pattern)
+	}
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+	}
+
+	captures := make(map[string]bool)
+	for _, name := range rule.re.SubexpNames() {
+		captures[name] = name != ""
+	}
+
+	words, err := splitWords(actions)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(words) == 0 {
+		return Rule{}, fmt.Errorf("rule has no actions")
+	}
+	for _, word := range words {
+		action, err := parseAction(word)
+		if err != nil {
+			return Rule{}, err
+		}
+		for _, m := range capturePattern.FindAllStringSubmatch(action.Value, -1) {
+			if !captures[m[1]] {
+				return Rule{}, fmt.Errorf("action %q uses {%s}, which the pattern doesn't capture", word, m[1])
+			}
+		}
+		rule.Actions = append(rule.Actions, action)
+	}
+	return rule, nil
+}
+
+// parseAction parses a `taxonomy=value` or `prop:name=value` action
+func parseAction(word string) (Action, error) {
+	name, value, ok := strings.Cut(word, "=")
+	if !ok || name == "" || value == "" {
+		return Action{}, fmt.Errorf("action %q must be written <taxonomy>=<value> or prop:<name>=<value>", word)
+	}
+	if property, ok := strings.CutPrefix(name, "prop:"); ok {
+		if property == "" {
+			return Action{}, fmt.Errorf("property name cannot be empty in action %q", word)
+		}
+		return Action{Property: property, Value: value}, nil
+	}
+	return Action{Taxonomy: strings.ToLower(name), Value: value}, nil
+}
+
+// globPattern converts a glob with `{name}` captures into an anchored
+// regular expression
+func globPattern(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				expr.WriteString(".*")
+				i++
+			default:
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '{':
+			m := capturePattern.FindStringSubmatch(glob[i:])
+			if m == nil || !strings.HasPrefix(glob[i:], m[0]) {
+				return nil, fmt.Errorf("invalid capture at %q", glob[i:])
+			}
+			expr.WriteString("(?P<" + m[1] + ">[^/]+?)")
+			i += len(m[0]) - 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// splitWords splits text on spaces, keeping double quoted text together
+func splitWords(text string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", strings.TrimSpace(text))
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Match applies a rule to an archive-relative path, using / as the separator.
+// It returns the rule's actions with their captures filled in.
+func (r Rule) Match(path string) ([]Action, bool) {
+	m := r.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	captures := make(map[string]string)
+	for i, name := range r.re.SubexpNames() {
+		if name != "" {
+			captures[name] = m[i]
+		}
+	}
+
+	actions := make([]Action, 0, len(r.Actions))
+	for _, action := range r.Actions {
+		action.Value = capturePattern.ReplaceAllStringFunc(action.Value, func(ref string) string {
+			return captures[ref[1:len(ref)-1]]
+		})
+		if strings.TrimSpace(action.Value) == "" {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions, true
+}
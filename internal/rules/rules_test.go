@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(strings.NewReader(`
+# books are filed by author and series
+books/{author}/{series}/*  ->  author={author} series={series}
+
+re:^music/(?P<artist>[^/]+)/  ->  artist={artist} prop:source=rip
+photos/**  ->  kind="holiday photos"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want 3", len(rules))
+	}
+
+	if rules[0].Line != 3 || rules[1].Line != 5 {
+		t.Errorf("lines = %d, %d, want 3, 5", rules[0].Line, rules[1].Line)
+	}
+	want := []Action{{Taxonomy: "artist", Value: "{artist}"}, {Property: "source", Value: "rip"}}
+	if !reflect.DeepEqual(rules[1].Actions, want) {
+		t.Errorf("actions = %+v, want %+v", rules[1].Actions, want)
+	}
+	if got := rules[2].Actions[0].Value; got != "holiday photos" {
+		t.Errorf("quoted value = %q, want %q", got, "holiday photos")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"books/*",
+		"books/* ->",
+		"books/* -> author",
+		"books/* -> prop:=x",
+		"books/* -> author={author}",
+		`books/* -> author="open`,
+		"re:( -> author=x",
+		"books/{} -> author=x",
+	}
+	for _, text := range tests {
+		if _, err := Parse(strings.NewReader(text)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		rule string
+		path string
+		want []Action
+		ok   bool
+	}{
+		{
+			rule: "books/{author}/{series}/* -> author={author} series={series}",
+			path: "books/Robert Jordan/The Wheel of Time/The Eye of the World.epub",
+			want: []Action{{Taxonomy: "author", Value: "Robert Jordan"}, {Taxonomy: "series", Value: "The Wheel of Time"}},
+			ok:   true,
+		},
+		{
+			rule: "books/{author}/{series}/* -> author={author}",
+			path: "books/Robert Jordan/The Eye of the World.epub",
+		},
+		{
+			rule: "photos/{year}/** -> year={year}",
+			path: "photos/2024/summer/beach/1.jpg",
+			want: []Action{{Taxonomy: "year", Value: "2024"}},
+			ok:   true,
+		},
+		{
+			rule: "**/*.pdf -> kind=document",
+			path: "report.pdf",
+			want: []Action{{Taxonomy: "kind", Value: "document"}},
+			ok:   true,
+		},
+		{
+			rule: "docs/?.txt -> kind=note",
+			path: "docs/ab.txt",
+		},
+		{
+			rule: "docs/a.txt -> kind=note",
+			path: "docs/abtxt",
+		},
+		{
+			// An empty capture drops the action
+			rule: `re:^music/(?P<artist>[^/]*)/ -> artist={artist} prop:source=rip`,
+			path: "music//track.mp3",
+			want: []Action{{Property: "source", Value: "rip"}},
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		rules, err := Parse(strings.NewReader(tt.rule))
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.rule, err)
+		}
+		got, ok := rules[0].Match(tt.path)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q Match(%q) = %+v, %v, want %+v, %v", tt.rule, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+)
+
+// taxonomyJSON is a taxonomy in responses
+type taxonomyJSON struct {
+	Name         string `json:"name"`
+	SingleValued bool   `json:"single_valued"`
+	Closed       bool   `json:"closed"`
+	ValuePattern string `json:"value_pattern,omitempty"`
+	ValueType    string `json:"value_type"`
+}
+
+// tagJSON is a tag in responses, with its full hierarchical path
+type tagJSON struct {
+	Path    string   `json:"path"`
+	Name    string   `json:"name"`
+	Parent  string   `json:"parent,omitempty"`
+	Count   int      `json:"count"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// facetJSON is a tag with the number of files that have it
+type facetJSON struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// tagRequest tags or untags files
+type tagRequest struct {
+	Paths    []string `json:"paths"`
+	Taxonomy string   `json:"taxonomy"`
+	Value    string   `json:"value"`
+}
+
+// propertyRequest sets or unsets a property of files
+type propertyRequest struct {
+	Paths []string `json:"paths"`
+	Name  string   `json:"name"`
+	Value string   `json:"value"`
+}
+
+// updateResponse lists the files a change was made to, and why it could not
+// be made to others
+type updateResponse struct {
+	Updated []string          `json:"updated"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// checkResponse tells whether content is in the archive
+type checkResponse struct {
+	Hash  string `json:"hash"`
+	Known bool   `json:"known"`
+	Path  string `json:"path,omitempty"`
+}
+
+// handleFiles lists the paths of every file that isn't marked missing
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := s.db.GetPresentFiles()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = filepath.Clean(file)
+	}
+	sort.Strings(paths)
+	writeJSON(w, http.StatusOK, paths)
+}
+
+// handleFile returns a file with its tags and properties
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	record, err := s.db.GetFileRecord(filepath.Clean(r.PathValue("path")))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// handleSearch returns the files matching a search written as on the
+// command line, e.g. ?q=series:"Wheel of Time" --sort year, or every file
+// if there is no search
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	records, status, err := s.search(r.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// handleFacets counts the tags of the files matching a search, or of every
+// file, by taxonomy
+func (s *Server) handleFacets(w http.ResponseWriter, r *http.Request) {
+	records, status, err := s.search(r.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	counts := make(map[string]map[string]int)
+	for _, record := range records {
+		for taxonomy, tags := range record.Tags {
+			if counts[taxonomy] == nil {
+				counts[taxonomy] = make(map[string]int)
+			}
+			for _, tag := range tags {
+				counts[taxonomy][tag]++
+			}
+		}
+	}
+
+	facets := make(map[string][]facetJSON, len(counts))
+	for taxonomy, values := range counts {
+		for value, count := range values {
+			facets[taxonomy] = append(facets[taxonomy], facetJSON{Value: value, Count: count})
+		}
+		sort.Slice(facets[taxonomy], func(i, j int) bool {
+			a, b := facets[taxonomy][i], facets[taxonomy][j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Value < b.Value
+		})
+	}
+	writeJSON(w, http.StatusOK, facets)
+}
+
+// search returns the records of the files matching a search, or of every
+// file not marked missing if the search is empty, along with the status of
+// any error
+func (s *Server) search(search string) ([]*database.FileRecord, int, error) {
+	args, err := query.Split(search)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	var files []string
+	if len(args) == 0 {
+		if files, err = s.db.GetPresentFiles(); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	} else {
+		q, err := query.Parse(args)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if files, err = s.taxonomyManager.Search(q); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	for i, file := range files {
+		files[i] = filepath.Clean(file)
+	}
+	if len(args) == 0 {
+		sort.Strings(files)
+	}
+	records, err := s.db.GetFileRecords(files)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return records, http.StatusOK, nil
+}
+
+// handleTaxonomies lists the taxonomies
+func (s *Server) handleTaxonomies(w http.ResponseWriter, r *http.Request) {
+	taxonomies, err := s.taxonomyManager.Taxonomies()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	result := make([]taxonomyJSON, len(taxonomies))
+	for i, t := range taxonomies {
+		result[i] = newTaxonomyJSON(t)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleTaxonomy returns the settings of a taxonomy
+func (s *Server) handleTaxonomy(w http.ResponseWriter, r *http.Request) {
+	t, err := s.taxonomyManager.Taxonomy(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTaxonomyJSON(*t))
+}
+
+// handleTags lists the tags of a taxonomy with the number of files tagged
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	t, err := s.taxonomyManager.Taxonomy(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	nodes, err := s.taxonomyManager.TagTree(t.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tagsJSON(nodes))
+}
+
+// handleTag tags files
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+	if err := readTagRequest(w, r, &req); err != nil {
+		writeError(w, requestStatus(err), err)
+		return
+	}
+	s.update(w, req.Paths, func(path string) error {
+		return s.taxonomyManager.TagFile(path, req.Taxonomy, req.Value)
+	})
+}
+
+// handleUntag removes a tag from files
+func (s *Server) handleUntag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+	if err := readTagRequest(w, r, &req); err != nil {
+		writeError(w, requestStatus(err), err)
+		return
+	}
+	s.update(w, req.Paths, func(path string) error {
+		return s.taxonomyManager.UntagFile(path, req.Taxonomy, req.Value)
+	})
+}
+
+// handleSet sets a property of files
+func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
+	var req propertyRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, requestStatus(err), err)
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("name is required"))
+		return
+	}
+	s.update(w, req.Paths, func(path string) error {
+		return s.db.SetProperty(path, req.Name, req.Value)
+	})
+}
+
+// handleUnset removes a property from files
+func (s *Server) handleUnset(w http.ResponseWriter, r *http.Request) {
+	var req propertyRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, requestStatus(err), err)
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("name is required"))
+		return
+	}
+	s.update(w, req.Paths, func(path string) error {
+		return s.db.UnsetProperty(path, req.Name)
+	})
+}
+
+// handleCheckHash tells whether a file with a SHA-256 hash is in the archive
+func (s *Server) handleCheckHash(w http.ResponseWriter, r *http.Request) {
+	s.check(w, strings.ToLower(r.PathValue("hash")))
+}
+
+// handleCheckUpload tells whether uploaded content is in the archive. The
+// content is either the request body or the file field of a form.
+func (s *Server) handleCheckUpload(w http.ResponseWriter, r *http.Request) {
+	var content io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("the form has no file field"))
+				return
+			}
+			if part.FormName() == "file" {
+				content = part
+				break
+			}
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read upload: %w", err))
+		return
+	}
+	s.check(w, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// check writes whether a file with a hash is in the archive
+func (s *Server) check(w http.ResponseWriter, hash string) {
+	path, err := s.db.GetFilePathByHash(hash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, checkResponse{Hash: hash, Known: path != "", Path: path})
+}
+
+// update makes a change to each file, responding with the files changed.
+// The request fails if no file could be changed.
+func (s *Server) update(w http.ResponseWriter, paths []string, change func(path string) error) {
+	if len(paths) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("paths are required"))
+		return
+	}
+
+	resp := updateResponse{Updated: []string{}, Errors: make(map[string]string)}
+	notFound := 0
+	for _, path := range paths {
+		if err := change(filepath.Clean(path)); err != nil {
+			resp.Errors[path] = err.Error()
+			if errors.Is(err, database.ErrFileNotFound) {
+				notFound++
+			}
+			continue
+		}
+		resp.Updated = append(resp.Updated, path)
+	}
+
+	status := http.StatusOK
+	switch {
+	case len(resp.Updated) > 0:
+	case notFound == len(paths):
+		status = http.StatusNotFound
+	default:
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
+
+// readTagRequest decodes and validates a request to tag or untag files
+func readTagRequest(w http.ResponseWriter, r *http.Request, req *tagRequest) error {
+	if err := readJSON(w, r, req); err != nil {
+		return err
+	}
+	if req.Taxonomy == "" {
+		req.Taxonomy = query.DefaultField
+	}
+	if req.Value == "" {
+		return fmt.Errorf("value is required")
+	}
+	return nil
+}
+
+// newTaxonomyJSON converts a taxonomy for a response
+func newTaxonomyJSON(t database.Taxonomy) taxonomyJSON {
+	return taxonomyJSON{
+		Name:         t.Name,
+		SingleValued: t.SingleValued,
+		Closed:       t.Closed,
+		ValuePattern: t.ValuePattern,
+		ValueType:    t.ValueType,
+	}
+}
+
+// tagsJSON converts a tag tree for a response, giving each tag its path
+func tagsJSON(nodes []database.TagNode) []tagJSON {
+	paths := database.TagPaths(nodes)
+	tags := make([]tagJSON, len(nodes))
+	for i, node := range nodes {
+		tags[i] = tagJSON{Path: paths[node.ID], Name: node.Name, Count: node.Count, Aliases: node.Aliases}
+		if node.ParentID != 0 {
+			tags[i].Parent = paths[node.ParentID]
+		}
+	}
+	return tags
+}
@@ -0,0 +1,583 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+)
+
+// Media types of OPDS 1.2 feeds
+const (
+	opdsNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	openSearchType  = "application/opensearchdescription+xml"
+)
+
+// opdsFormats are the MIME types of the files published as books
+var opdsFormats = map[string]bool{
+	"application/epub+zip":           true,
+	"application/pdf":                true,
+	"application/x-mobipocket-ebook": true,
+}
+
+// opdsSections are the taxonomies the catalogue can be browsed by, with
+// their titles
+var opdsSections = []struct {
+	taxonomy string
+	title    string
+}{
+	{"author", "By author"},
+	{"series", "By series"},
+	{query.DefaultField, "By tag"},
+}
+
+// opdsPageSize is the number of books in a page of an acquisition feed
+const opdsPageSize = 50
+
+// seriesIndexProperty orders the books of a series
+const seriesIndexProperty = "series_index"
+
+// atomFeed is an OPDS catalogue feed
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	XmlnsDC   string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS string      `xml:"xmlns:opds,attr"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+// atomEntry is a section of a navigation feed or a book of an acquisition
+// feed
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author,omitempty"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Categories []atomCategory `xml:"category,omitempty"`
+	Content    *atomContent   `xml:"content,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Term   string `xml:"term,attr"`
+	Label  string `xml:"label,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// book is one or more files of the same book in different formats, which
+// share a directory and a name
+type book struct {
+	title   string
+	records []*database.FileRecord
+	types   []string // MIME type of each record
+}
+
+// opds serves the archive's books as an OPDS catalogue
+type opds struct {
+	taxonomyManager TaxonomyManager
+	db              DatabaseManager
+	mux             *http.ServeMux
+}
+
+// NewOPDS creates a server publishing the EPUB, PDF and MOBI files of the
+// archive as an OPDS 1.2 catalogue for e-reader apps. If token is not empty,
+// clients must give it as in NewWebDAV.
+func NewOPDS(tm TaxonomyManager, db DatabaseManager, token string) http.Handler {
+	o := &opds{taxonomyManager: tm, db: db, mux: http.NewServeMux()}
+	o.mux.HandleFunc("GET /{$}", o.handleRoot)
+	o.mux.HandleFunc("GET /opensearch.xml", o.handleOpenSearch)
+	o.mux.HandleFunc("GET /books", o.handleBooks)
+	o.mux.HandleFunc("GET /search", o.handleSearch)
+	o.mux.HandleFunc("GET /taxonomies/{name}", o.handleTaxonomy)
+	o.mux.HandleFunc("GET /taxonomies/{name}/books", o.handleTagBooks)
+	o.mux.HandleFunc("GET /files/{path...}", o.handleFile)
+	return tokenAuth(token, o.mux)
+}
+
+// handleRoot serves the start of the catalogue
+func (o *opds) handleRoot(w http.ResponseWriter, r *http.Request) {
+	feed := newFeed("urn:fart:root", "FART", "/", opdsNavigation)
+	all := navigationEntry("urn:fart:books", "All books", "/books", "")
+	all.Links[0].Type = opdsAcquisition
+	feed.Entries = append(feed.Entries, all)
+	taxonomies, err := o.taxonomies()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, section := range opdsSections {
+		if taxonomies[section.taxonomy] {
+			href := "/taxonomies/" + url.PathEscape(section.taxonomy)
+			feed.Entries = append(feed.Entries, navigationEntry("urn:fart:taxonomy:"+section.taxonomy, section.title, href, ""))
+		}
+	}
+	writeFeed(w, feed, opdsNavigation)
+}
+
+// handleOpenSearch describes how to search the catalogue
+func (o *opds) handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", openSearchType)
+	fmt.Fprintf(w, `%s<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>FART</ShortName>
+  <Description>Search the books in the archive</Description>
+  <InputEncoding>UTF-8</InputEncoding>
+  <OutputEncoding>UTF-8</OutputEncoding>
+  <Url type="%s" template="/search?q={searchTerms}"/>
+</OpenSearchDescription>
+`, xml.Header, opdsAcquisition)
+}
+
+// handleBooks lists every book
+func (o *opds) handleBooks(w http.ResponseWriter, r *http.Request) {
+	books, err := o.books(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o.writeBooks(w, r, "urn:fart:books", "All books", books)
+}
+
+// handleSearch lists the books whose title, file name or tags contain every
+// word searched for
+func (o *opds) handleSearch(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+	words := strings.Fields(strings.ToLower(search))
+	all, err := o.books(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var books []*book
+	for _, b := range all {
+		text := strings.ToLower(bookText(b))
+		matches := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			books = append(books, b)
+		}
+	}
+	o.writeBooks(w, r, "urn:fart:search:"+search, "Search: "+search, books)
+}
+
+// handleTaxonomy lists the tags of a taxonomy that books have, with the
+// number of books with each
+func (o *opds) handleTaxonomy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	taxonomies, err := o.taxonomies()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !taxonomies[name] {
+		http.NotFound(w, r)
+		return
+	}
+	books, err := o.books(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, b := range books {
+		for _, tag := range bookTags(b, name) {
+			counts[tag]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+
+	self := "/taxonomies/" + url.PathEscape(name)
+	feed := newFeed("urn:fart:taxonomy:"+name, name, self, opdsNavigation)
+	feed.Links = append(feed.Links, atomLink{Rel: "up", Href: "/", Type: opdsNavigation})
+	for _, tag := range tags {
+		href := self + "/books?tag=" + url.QueryEscape(tag)
+		content := fmt.Sprintf("%d books", counts[tag])
+		if counts[tag] == 1 {
+			content = "1 book"
+		}
+		entry := navigationEntry("urn:fart:tag:"+name+":"+tag, tagTitle(tag), href, content)
+		entry.Links[0].Type = opdsAcquisition
+		feed.Entries = append(feed.Entries, entry)
+	}
+	writeFeed(w, feed, opdsNavigation)
+}
+
+// handleTagBooks lists the books with a tag, or any tag beneath it. The books
+// of a series are in the order of their series_index property.
+func (o *opds) handleTagBooks(w http.ResponseWriter, r *http.Request) {
+	name, tag := r.PathValue("name"), r.URL.Query().Get("tag")
+	if tag == "" {
+		http.Error(w, "the tag parameter is required", http.StatusBadRequest)
+		return
+	}
+	taxonomies, err := o.taxonomies()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !taxonomies[name] {
+		http.NotFound(w, r)
+		return
+	}
+	q, err := query.Parse([]string{"--" + name, tag})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, err := o.taxonomyManager.Search(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	books, err := o.books(files)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if name == "series" {
+		sort.SliceStable(books, func(i, j int) bool { return seriesIndex(books[i]) < seriesIndex(books[j]) })
+	}
+	o.writeBooks(w, r, "urn:fart:tag:"+name+":"+tag, tagTitle(tag), books)
+}
+
+// handleFile downloads a book
+func (o *opds) handleFile(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Clean(filepath.FromSlash(r.PathValue("path")))
+	types, err := o.fileTypes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !filepath.IsLocal(filePath) || database.IsContainerMember(filePath) || !opdsFormats[types[filePath]] {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(filePath)}))
+	serveFile(w, r, filePath)
+}
+
+// books returns the books among the given files, or among all files if
+// files is nil, ordered by title
+func (o *opds) books(files []string) ([]*book, error) {
+	types, err := o.fileTypes()
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		for file := range types {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	var formats []string
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if opdsFormats[types[file]] && !database.IsContainerMember(file) {
+			formats = append(formats, file)
+		}
+	}
+	records, err := o.db.GetFileRecords(formats)
+	if err != nil {
+		return nil, err
+	}
+
+	var books []*book
+	byKey := make(map[string]*book)
+	for i, record := range records {
+		file := formats[i]
+		if record.MissingAt != "" {
+			continue
+		}
+		mimeType := types[file]
+		record.Path = file
+
+		key := strings.TrimSuffix(file, filepath.Ext(file))
+		b := byKey[key]
+		if b == nil {
+			b = &book{}
+			byKey[key] = b
+			books = append(books, b)
+		}
+		b.records = append(b.records, record)
+		b.types = append(b.types, mimeType)
+	}
+	for key, b := range byKey {
+		if b.title = b.property("title"); b.title == "" {
+			b.title = filepath.Base(key)
+		}
+	}
+	sort.SliceStable(books, func(i, j int) bool { return strings.ToLower(books[i].title) < strings.ToLower(books[j].title) })
+	return books, nil
+}
+
+// taxonomies returns the names of the taxonomies
+func (o *opds) taxonomies() (map[string]bool, error) {
+	all, err := o.taxonomyManager.Taxonomies()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(all))
+	for _, t := range all {
+		names[t.Name] = true
+	}
+	return names, nil
+}
+
+// fileTypes returns the MIME type of each file by its path
+func (o *opds) fileTypes() (map[string]string, error) {
+	all, err := o.db.GetFileTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(all))
+	for _, t := range all {
+		types[filepath.Clean(t.Path)] = t.MIMEType
+	}
+	return types, nil
+}
+
+// writeBooks writes a page of an acquisition feed, chosen by the page
+// parameter
+func (o *opds) writeBooks(w http.ResponseWriter, r *http.Request, id, title string, books []*book) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageURL := func(page int) string {
+		params := r.URL.Query()
+		params.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + params.Encode()
+	}
+
+	feed := newFeed(id, title, pageURL(page), opdsAcquisition)
+	feed.Links = append(feed.Links, atomLink{Rel: "up", Href: "/", Type: opdsNavigation})
+	if page > 1 {
+		feed.Links = append(feed.Links, atomLink{Rel: "previous", Href: pageURL(page - 1), Type: opdsAcquisition})
+	}
+	if page*opdsPageSize < len(books) {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Href: pageURL(page + 1), Type: opdsAcquisition})
+	}
+
+	start := min((page-1)*opdsPageSize, len(books))
+	end := min(start+opdsPageSize, len(books))
+	for _, b := range books[start:end] {
+		feed.Entries = append(feed.Entries, bookEntry(b))
+	}
+	writeFeed(w, feed, opdsAcquisition)
+}
+
+// bookEntry describes a book, with a link to download each of its formats
+func bookEntry(b *book) atomEntry {
+	first := b.records[0]
+	entry := atomEntry{
+		Title:   b.title,
+		ID:      "urn:sha256:" + first.Hash,
+		Updated: first.ModifiedAt,
+	}
+	for _, author := range bookTags(b, "author") {
+		entry.Authors = append(entry.Authors, atomAuthor{Name: tagTitle(author)})
+	}
+	if isbn := b.property("isbn"); isbn != "" {
+		entry.Identifier = "urn:isbn:" + isbn
+	}
+	for _, record := range b.records {
+		for taxonomy, tags := range record.Tags {
+			if taxonomy == "author" || taxonomy == database.TypeTaxonomy {
+				continue
+			}
+			for _, tag := range tags {
+				entry.Categories = append(entry.Categories, atomCategory{Scheme: taxonomy, Term: tag, Label: tagTitle(tag)})
+			}
+		}
+		if record.ModifiedAt > entry.Updated {
+			entry.Updated = record.ModifiedAt
+		}
+	}
+	entry.Categories = uniqueCategories(entry.Categories)
+
+	var summary []string
+	if series := bookTags(b, "series"); len(series) > 0 {
+		line := "Series: " + tagTitle(series[0])
+		if index := b.property(seriesIndexProperty); index != "" {
+			line += ", book " + index
+		}
+		summary = append(summary, line)
+	}
+	if description := b.property("description"); description != "" {
+		summary = append(summary, description)
+	}
+	if len(summary) > 0 {
+		entry.Content = &atomContent{Type: "text", Text: strings.Join(summary, "\n\n")}
+	}
+
+	for i, record := range b.records {
+		entry.Links = append(entry.Links, atomLink{
+			Rel:   "http://opds-spec.org/acquisition",
+			Href:  fileURL(record.Path),
+			Type:  b.types[i],
+			Title: path.Base(filepath.ToSlash(record.Path)),
+		})
+	}
+	return entry
+}
+
+// property returns a property of a book, from the first of its formats that
+// has it
+func (b *book) property(name string) string {
+	for _, record := range b.records {
+		if value := record.Properties[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// bookTags returns the tags of a book in a taxonomy, from all its formats
+func bookTags(b *book, taxonomy string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, record := range b.records {
+		for _, tag := range record.Tags[taxonomy] {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// bookText is the text searches look in: the title, file names and tags
+func bookText(b *book) string {
+	parts := []string{b.title}
+	for _, record := range b.records {
+		parts = append(parts, filepath.Base(record.Path))
+		for _, tags := range record.Tags {
+			for _, tag := range tags {
+				parts = append(parts, tagTitle(tag))
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// seriesIndex is the position of a book in its series, with books without
+// one last
+func seriesIndex(b *book) float64 {
+	index, err := strconv.ParseFloat(b.property(seriesIndexProperty), 64)
+	if err != nil {
+		return 1e9
+	}
+	return index
+}
+
+// uniqueCategories removes repeated categories
+func uniqueCategories(categories []atomCategory) []atomCategory {
+	var unique []atomCategory
+	seen := make(map[atomCategory]bool)
+	for _, c := range categories {
+		if !seen[c] {
+			seen[c] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+// tagTitle shows a hierarchical tag with its levels unescaped
+func tagTitle(tag string) string {
+	return strings.Join(database.SplitTagPath(tag), " / ")
+}
+
+// fileURL is the download link of a file
+func fileURL(filePath string) string {
+	parts := strings.Split(filepath.ToSlash(filePath), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/files/" + strings.Join(parts, "/")
+}
+
+// newFeed starts a feed with the links every feed has
+func newFeed(id, title, self, feedType string) *atomFeed {
+	return &atomFeed{
+		Xmlns:     "http://www.w3.org/2005/Atom",
+		XmlnsDC:   "http://purl.org/dc/terms/",
+		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
+		ID:        id,
+		Title:     title,
+		Updated:   time.Now().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: self, Type: feedType},
+			{Rel: "start", Href: "/", Type: opdsNavigation},
+			{Rel: "search", Href: "/opensearch.xml", Type: openSearchType},
+		},
+	}
+}
+
+// navigationEntry is an entry of a navigation feed leading to another feed
+func navigationEntry(id, title, href, content string) atomEntry {
+	entry := atomEntry{
+		Title:   title,
+		ID:      id,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Rel: "subsection", Href: href, Type: opdsNavigation}},
+	}
+	if content != "" {
+		entry.Content = &atomContent{Type: "text", Text: content}
+	}
+	return entry
+}
+
+// writeFeed writes a feed as the response
+func writeFeed(w http.ResponseWriter, feed *atomFeed, feedType string) {
+	w.Header().Set("Content-Type", feedType+";charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"go-fart/internal/database"
+	"go-fart/internal/taxonomy"
+)
+
+// newTestLibrary returns an OPDS server of an archive with two books of a
+// series, one of them in two formats, and a file that isn't a book
+func newTestLibrary(t *testing.T) (http.Handler, *database.DB) {
+	t.Helper()
+	db := newTestArchive(t, map[string]string{
+		"books/eye.epub":  "The Eye of the World",
+		"books/eye.pdf":   "The Eye of the World",
+		"books/hunt.epub": "The Great Hunt",
+		"notes.txt":       "notes",
+	})
+	for path, mimeType := range map[string]string{
+		"books/eye.epub":  "application/epub+zip",
+		"books/eye.pdf":   "application/pdf",
+		"books/hunt.epub": "application/epub+zip",
+		"notes.txt":       "text/plain",
+	} {
+		if err := db.SetFileType(path, mimeType, "document"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := taxonomy.New(db)
+	for _, tag := range []struct{ file, taxonomy, value string }{
+		{"books/eye.epub", "series", "The Wheel of Time"},
+		{"books/hunt.epub", "series", "The Wheel of Time"},
+		{"books/eye.epub", "author", "Jordan, Robert"},
+	} {
+		if err := m.TagFile(tag.file, tag.taxonomy, tag.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, index := range map[string]string{"books/eye.epub": "1", "books/hunt.epub": "2"} {
+		if err := db.SetProperty(path, "series_index", index); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetProperty("books/hunt.epub", "title", "A Great Hunt"); err != nil {
+		t.Fatal(err)
+	}
+	return NewOPDS(m, db, ""), db
+}
+
+// readFeed requests a feed and decodes it
+func readFeed(t *testing.T, h http.Handler, target string) *atomFeed {
+	t.Helper()
+	w := request(h, "GET", target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", target, w.Code, w.Body)
+	}
+	var feed atomFeed
+	if err := xml.NewDecoder(w.Body).Decode(&feed); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return &feed
+}
+
+// entryTitles returns the titles of the entries of a feed
+func entryTitles(feed *atomFeed) []string {
+	var titles []string
+	for _, entry := range feed.Entries {
+		titles = append(titles, entry.Title)
+	}
+	return titles
+}
+
+func TestOPDSBooks(t *testing.T) {
+	h, _ := newTestLibrary(t)
+
+	feed := readFeed(t, h, "/books")
+	if got := entryTitles(feed); len(got) != 2 || got[0] != "A Great Hunt" || got[1] != "eye" {
+		t.Fatalf("books = %q, want A Great Hunt and eye", got)
+	}
+	acquisitions := 0
+	for _, link := range feed.Entries[1].Links {
+		if link.Rel == "http://opds-spec.org/acquisition" {
+			acquisitions++
+		}
+	}
+	if acquisitions != 2 {
+		t.Errorf("eye has %d acquisition links, want one per format", acquisitions)
+	}
+
+	if got := entryTitles(readFeed(t, h, "/search?q=hunt")); len(got) != 1 || got[0] != "A Great Hunt" {
+		t.Errorf("search for hunt = %q", got)
+	}
+	if got := entryTitles(readFeed(t, h, "/search?q=jordan")); len(got) != 1 || got[0] != "eye" {
+		t.Errorf("search for jordan = %q", got)
+	}
+}
+
+func TestOPDSSeries(t *testing.T) {
+	h, _ := newTestLibrary(t)
+
+	if got := entryTitles(readFeed(t, h, "/taxonomies/series")); len(got) != 1 || got[0] != "The Wheel of Time" {
+		t.Errorf("series = %q", got)
+	}
+	// Books of a series are in series order rather than by title
+	if got := entryTitles(readFeed(t, h, "/taxonomies/series/books?tag=The+Wheel+of+Time")); len(got) != 2 || got[0] != "eye" {
+		t.Errorf("books of the series = %q, want eye first", got)
+	}
+	if w := request(h, "GET", "/taxonomies/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /taxonomies/missing = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestOPDSFile(t *testing.T) {
+	h, _ := newTestLibrary(t)
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/files/books/eye.pdf", http.StatusOK},
+		{"/files/notes.txt", http.StatusNotFound},
+		{"/files/books/missing.epub", http.StatusNotFound},
+		{"/files/..%2Foutside.epub", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := request(h, "GET", tt.target, "")
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.target, w.Code, tt.want)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != "The Eye of the World" {
+			t.Errorf("GET %s = %q", tt.target, w.Body)
+		}
+	}
+}
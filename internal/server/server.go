@@ -0,0 +1,242 @@
+// Package server serves the archive over HTTP as a JSON API and a browser
+// interface
+package server
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+)
+
+// TaxonomyManager is the taxonomy manager the server tags and searches with
+type TaxonomyManager interface {
+	TagFile(filePath, taxonomyName, tagValue string) error
+	UntagFile(filePath, taxonomyName, tagValue string) error
+	Search(q *query.Query) ([]string, error)
+	Taxonomy(name string) (*database.Taxonomy, error)
+	Taxonomies() ([]database.Taxonomy, error)
+	TagTree(taxonomyName string) ([]database.TagNode, error)
+}
+
+// DatabaseManager is the database the server reads files from
+type DatabaseManager interface {
+	GetAllFiles() ([]string, error)
+	GetPresentFiles() ([]string, error)
+	GetFileRecord(filePath string) (*database.FileRecord, error)
+	GetFileRecords(filePaths []string) ([]*database.FileRecord, error)
+	GetFilePathByHash(hash string) (string, error)
+	SetProperty(filePath, name, value string) error
+	UnsetProperty(filePath, name string) error
+	GetStageDirectory() (string, error)
+	GetSavedSearch(name string) (string, error)
+	GetSavedSearches() ([]database.SavedSearch, error)
+	GetFileTypes() ([]database.FileType, error)
+}
+
+// openAPI describes the API
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// maxBodyLen limits the size of JSON request bodies
+const maxBodyLen = 1 << 20
+
+// errNotJSON is returned for request bodies that aren't JSON. Requiring the
+// JSON type means a page on another site can't send them without the
+// browser asking the server first.
+var errNotJSON = errors.New("the request body must be application/json")
+
+// Server handles the requests of the API
+type Server struct {
+	taxonomyManager TaxonomyManager
+	db              DatabaseManager
+	token           string
+	mux             *http.ServeMux
+	stage           stageCache
+}
+
+// New creates a server. If token is not empty, API requests must carry it as
+// a bearer token. The pages of the browser interface hold no data and are
+// served to anyone.
+func New(tm TaxonomyManager, db DatabaseManager, token string) *Server {
+	s := &Server{
+		taxonomyManager: tm,
+		db:              db,
+		token:           token,
+		mux:             http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	s.mux.Handle("GET /", uiHandler())
+	s.handle("GET /api/files", s.handleFiles)
+	s.handle("GET /api/files/{path...}", s.handleFile)
+	s.handle("GET /api/search", s.handleSearch)
+	s.handle("GET /api/facets", s.handleFacets)
+	s.handle("GET /api/taxonomies", s.handleTaxonomies)
+	s.handle("GET /api/taxonomies/{name}", s.handleTaxonomy)
+	s.handle("GET /api/taxonomies/{name}/tags", s.handleTags)
+	s.handle("POST /api/tag", s.handleTag)
+	s.handle("POST /api/untag", s.handleUntag)
+	s.handle("POST /api/set", s.handleSet)
+	s.handle("POST /api/unset", s.handleUnset)
+	s.handle("GET /api/check/{hash}", s.handleCheckHash)
+	s.handle("POST /api/check", s.handleCheckUpload)
+	s.handle("GET /api/stage", s.handleStage)
+	s.handle("GET /raw/{path...}", s.handleRaw)
+	s.handle("GET /stage/raw/{path...}", s.handleStageRaw)
+	return s
+}
+
+// ServeHTTP handles a request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle adds an API handler that requires the token
+func (s *Server) handle(pattern string, handler http.HandlerFunc) {
+	s.mux.Handle(pattern, s.authorize(handler))
+}
+
+// authorize rejects requests without the server's token
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fart"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenAuth rejects requests without the token, given either as a bearer
+// token or as the password of basic authentication with any user name, for
+// clients such as file managers and e-readers that only do the latter
+func tokenAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, given, _ = r.BasicAuth()
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fart"`)
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SameSite rejects requests that pages on other sites could make through
+// the user's browser. Requests naming another site in their Origin header
+// are refused, and when the server listens on a loopback address, so are
+// requests for any host but the loopback names, which is what DNS rebinding
+// would send.
+func SameSite(addr string, next http.Handler) http.Handler {
+	hosts := loopbackHosts(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hosts != nil && !hosts[strings.ToLower(r.Host)] {
+			http.Error(w, "unknown host "+r.Host, http.StatusMisdirectedRequest)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !strings.EqualFold(origin, "http://"+r.Host) {
+			http.Error(w, "requests from other sites are not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsLoopback reports whether an address only accepts local connections
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loopbackHosts returns the Host headers that reach a server listening on a
+// loopback address, or nil if it listens on other addresses too
+func loopbackHosts(addr string) map[string]bool {
+	if !IsLoopback(addr) {
+		return nil
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	hosts := make(map[string]bool)
+	for _, name := range []string{"localhost", "127.0.0.1", "[::1]"} {
+		hosts[name+":"+port] = true
+		if port == "80" {
+			hosts[name] = true
+		}
+	}
+	return hosts
+}
+
+// handleOpenAPI serves the description of the API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+// writeJSON writes a value as the JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as the JSON response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// errorStatus is the status of a response to a failed lookup
+func errorStatus(err error) int {
+	if errors.Is(err, database.ErrFileNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// requestStatus is the status of a response to a request that couldn't be
+// read
+func requestStatus(err error) int {
+	if errors.Is(err, errNotJSON) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// readJSON decodes a JSON request body
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return errNotJSON
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyLen))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-fart/internal/database"
+	"go-fart/internal/taxonomy"
+)
+
+// newTestServer returns a server for a new database holding the given
+// files, each with its path as its content hash
+func newTestServer(t *testing.T, token string, files ...string) (*Server, *database.DB) {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "fart.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if err := db.AddFile(filepath.Base(file), filepath.Dir(file), file, 1, "2024-01-01 00:00:00"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(taxonomy.New(db), db, token), db
+}
+
+// request makes a request to a handler, with a JSON body if body isn't
+// empty, and returns the response
+func request(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorize(t *testing.T) {
+	s, _ := newTestServer(t, "secret", "books/eye.txt")
+
+	tests := []struct {
+		target string
+		header []string
+		want   int
+	}{
+		{"/api/files", nil, http.StatusUnauthorized},
+		{"/api/files", []string{"Authorization", "Bearer wrong"}, http.StatusUnauthorized},
+		{"/api/files", []string{"Authorization", "secret"}, http.StatusUnauthorized},
+		{"/api/files", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+		{"/api/openapi.json", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := request(s, "GET", tt.target, "", tt.header...); w.Code != tt.want {
+			t.Errorf("GET %s with %q = %d, want %d", tt.target, tt.header, w.Code, tt.want)
+		}
+	}
+}
+
+func TestTagAndSearch(t *testing.T) {
+	s, db := newTestServer(t, "", "books/eye.txt", "books/hunt.txt")
+
+	w := request(s, "POST", "/api/tag", `{"paths": ["books/eye.txt", "books/missing.txt"], "taxonomy": "genre", "value": "fantasy"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/tag = %d: %s", w.Code, w.Body)
+	}
+	var update updateResponse
+	if err := json.NewDecoder(w.Body).Decode(&update); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(update.Updated, []string{"books/eye.txt"}) || len(update.Errors) != 1 {
+		t.Errorf("update = %+v, want books/eye.txt updated and books/missing.txt failed", update)
+	}
+
+	w = request(s, "GET", "/api/search?q="+strings.ReplaceAll("genre:fantasy", ":", "%3A"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/search = %d: %s", w.Code, w.Body)
+	}
+	var records []*database.FileRecord
+	if err := json.NewDecoder(w.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Path != "books/eye.txt" {
+		t.Errorf("search = %+v, want books/eye.txt", records)
+	}
+
+	record, err := db.GetFileRecord("books/eye.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(record.Tags["genre"], []string{"fantasy"}) {
+		t.Errorf("genre = %v, want fantasy", record.Tags["genre"])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, _ := newTestServer(t, "", "books/eye.txt")
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{"GET", "/api/files/books/missing.txt", "", http.StatusNotFound},
+		{"GET", "/api/search?q=%22open", "", http.StatusBadRequest},
+		{"POST", "/api/tag", `{"paths": ["books/missing.txt"], "value": "x"}`, http.StatusNotFound},
+		{"POST", "/api/tag", `{"paths": [], "value": "x"}`, http.StatusBadRequest},
+		{"POST", "/api/tag", `{"paths": ["books/eye.txt"], "unknown": 1}`, http.StatusBadRequest},
+		{"GET", "/api/taxonomies/missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := request(s, tt.method, tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s %s = %d, want %d: %s", tt.method, tt.target, tt.body, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestCheckHash(t *testing.T) {
+	s, _ := newTestServer(t, "", "books/eye.txt")
+
+	for hash, want := range map[string]checkResponse{
+		"books/eye.txt": {Hash: "books/eye.txt", Known: true, Path: "books/eye.txt"},
+		"unknown":       {Hash: "unknown"},
+	} {
+		w := request(s, "GET", "/api/check/"+strings.ReplaceAll(hash, "/", "%2F"), "")
+		var got checkResponse
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("check %s = %+v, want %+v", hash, got, want)
+		}
+	}
+}
+
+func TestNotJSON(t *testing.T) {
+	s, _ := newTestServer(t, "", "books/eye.txt")
+	body := `{"paths": ["books/eye.txt"], "value": "x"}`
+
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		w := request(s, "POST", "/api/tag", body, "Content-Type", contentType)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("POST /api/tag as %q = %d, want %d", contentType, w.Code, http.StatusUnsupportedMediaType)
+		}
+	}
+	if w := request(s, "POST", "/api/tag", body, "Content-Type", "application/json; charset=utf-8"); w.Code != http.StatusOK {
+		t.Errorf("POST /api/tag with a charset = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		addr   string
+		host   string
+		origin string
+		want   int
+	}{
+		{"localhost:8080", "localhost:8080", "", http.StatusOK},
+		{"localhost:8080", "127.0.0.1:8080", "http://127.0.0.1:8080", http.StatusOK},
+		{"127.0.0.1:8080", "[::1]:8080", "", http.StatusOK},
+		{"127.0.0.1:80", "localhost", "", http.StatusOK},
+		{"127.0.0.1:8080", "evil.example:8080", "", http.StatusMisdirectedRequest},
+		{"127.0.0.1:8080", "localhost:8080", "http://evil.example", http.StatusForbidden},
+		{":8080", "archive.example:8080", "", http.StatusOK},
+		{":8080", "archive.example:8080", "http://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/files", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		SameSite(tt.addr, ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: Host %s, Origin %q = %d, want %d", tt.addr, tt.host, tt.origin, w.Code, tt.want)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:8080":   true,
+		"127.0.0.1:8080":   true,
+		"[::1]:8080":       true,
+		":8080":            false,
+		"0.0.0.0:8080":     false,
+		"192.168.1.2:8080": false,
+		"localhost":        false,
+	}
+	for addr, want := range tests {
+		if got := IsLoopback(addr); got != want {
+			t.Errorf("IsLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+)
+
+// uiFiles are the pages, scripts and styles of the browser interface, which
+// need nothing from other sites
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// stageFileJSON is a file waiting in the stage directory
+type stageFileJSON struct {
+	Path  string `json:"path"` // relative to the stage directory
+	Size  int64  `json:"size"`
+	Hash  string `json:"hash"`
+	Known bool   `json:"known"`
+	// Existing is where the archive already has the file's content
+	Existing string `json:"existing,omitempty"`
+	MIMEType string `json:"mime_type"`
+	Kind     string `json:"kind"`
+}
+
+// stageJSON is the stage directory with its files
+type stageJSON struct {
+	Directory string          `json:"directory"`
+	Files     []stageFileJSON `json:"files"`
+}
+
+// stageCache keeps the hashes and types of staged files, which are only
+// worked out again when a file changes
+type stageCache struct {
+	mu    sync.Mutex
+	files map[string]stageEntry
+}
+
+// stageEntry is a staged file as it was when it was hashed
+type stageEntry struct {
+	size     int64
+	modified time.Time
+	hash     string
+	fileType fileops.FileType
+}
+
+// uiHandler serves the browser interface
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(files)
+}
+
+// handleRaw serves the content of a file in the archive. Only files in the
+// database are served, and members of containers are not.
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Clean(r.PathValue("path"))
+	if !filepath.IsLocal(path) || database.IsContainerMember(path) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", database.ErrFileNotFound, path))
+		return
+	}
+	if _, err := s.db.GetFileRecord(path); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	serveFile(w, r, path)
+}
+
+// handleStage lists the files in the stage directory, and whether the
+// archive already has each of them
+func (s *Server) handleStage(w http.ResponseWriter, r *http.Request) {
+	stage, err := s.db.GetStageDirectory()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if stage == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no stage directory is set"))
+		return
+	}
+
+	result := stageJSON{Directory: stage, Files: []stageFileJSON{}}
+	err = filepath.WalkDir(stage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != stage && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		entry, err := s.stage.entry(path)
+		if err != nil {
+			return nil
+		}
+		existing, err := s.db.GetFilePathByHash(entry.hash)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(stage, path)
+		result.Files = append(result.Files, stageFileJSON{
+			Path:     filepath.ToSlash(rel),
+			Size:     entry.size,
+			Hash:     entry.hash,
+			Known:    existing != "",
+			Existing: existing,
+			MIMEType: entry.fileType.MIMEType,
+			Kind:     entry.fileType.Kind,
+		})
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].Path < result.Files[j].Path })
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleStageRaw serves the content of a file in the stage directory. Only
+// regular files inside it are served, not what a symlink there points to.
+func (s *Server) handleStageRaw(w http.ResponseWriter, r *http.Request) {
+	stage, err := s.db.GetStageDirectory()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	path := filepath.FromSlash(r.PathValue("path"))
+	if stage == "" || !filepath.IsLocal(path) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", database.ErrFileNotFound, path))
+		return
+	}
+	file, info, err := openStageFile(stage, path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", database.ErrFileNotFound, path))
+		return
+	}
+	defer file.Close()
+	serveContent(w, r, file.Name(), file, info)
+}
+
+// openStageFile opens a regular file inside the stage directory. Each level
+// of the path is looked at with Lstat, so that no symlink is followed, and
+// the file that is opened must be the one that was looked at, in case the
+// path changed in between.
+func openStageFile(stage, path string) (*os.File, os.FileInfo, error) {
+	full := stage
+	var info os.FileInfo
+	levels := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	for i, level := range levels {
+		full = filepath.Join(full, level)
+		var err error
+		if info, err = os.Lstat(full); err != nil {
+			return nil, nil, err
+		}
+		if last := i == len(levels)-1; last && !info.Mode().IsRegular() || !last && !info.IsDir() {
+			return nil, nil, fmt.Errorf("%s is not a regular file in the stage directory", path)
+		}
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		return nil, nil, err
+	}
+	opened, err := file.Stat()
+	if err != nil || !os.SameFile(info, opened) {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s changed while it was opened", path)
+	}
+	return file, opened, nil
+}
+
+// serveFile serves a regular file, typed by its content
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", database.ErrFileNotFound, path))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", database.ErrFileNotFound, path))
+		return
+	}
+	serveContent(w, r, path, file, info)
+}
+
+// serveContent serves an open regular file, typed by its content
+func serveContent(w http.ResponseWriter, r *http.Request, path string, file *os.File, info os.FileInfo) {
+	t, err := fileops.DetectFileType(path)
+	if err == nil {
+		w.Header().Set("Content-Type", t.MIMEType)
+	}
+	// Content that could run scripts in the page's origin, such as HTML or
+	// SVG, is sandboxed. Browsers don't show sandboxed PDFs.
+	if t.MIMEType != "application/pdf" {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// entry returns the hash and type of a staged file, working them out if the
+// file is new or has changed
+func (c *stageCache) entry(path string) (stageEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stageEntry{}, err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.files[path]
+	c.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modified.Equal(info.ModTime()) {
+		return entry, nil
+	}
+
+	hash, err := fileops.CalculateFileHash(path)
+	if err != nil {
+		return stageEntry{}, err
+	}
+	t, err := fileops.DetectFileType(path)
+	if err != nil {
+		return stageEntry{}, err
+	}
+	entry = stageEntry{size: info.Size(), modified: info.ModTime(), hash: hash, fileType: t}
+
+	c.mu.Lock()
+	if c.files == nil {
+		c.files = make(map[string]stageEntry)
+	}
+	c.files[path] = entry
+	c.mu.Unlock()
+	return entry, nil
+}
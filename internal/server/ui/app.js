@@ -0,0 +1,430 @@
+"use strict";
+
+// The browser interface of fart serve. It only talks to the server it was
+// loaded from, so it works offline.
+
+const DEFAULT_TAXONOMY = "tags";
+const FACET_LIMIT = 15;
+const TEXT_PREVIEW_LEN = 4096;
+
+const state = {
+  records: [],
+  selected: new Set(),
+  current: null,
+  previewURL: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+// el creates an element with text content and children
+function el(tag, props = {}, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, props);
+  for (const child of children) {
+    node.append(child);
+  }
+  return node;
+}
+
+// showMessage shows a notice, or an error if isError is set
+function showMessage(text, isError = false) {
+  const message = $("message");
+  message.textContent = text;
+  message.className = isError ? "error" : "";
+  message.hidden = !text;
+}
+
+// api fetches from the server, asking for a token if the server wants one
+async function api(path, options = {}) {
+  const token = localStorage.getItem("fart-token");
+  const headers = Object.assign({}, options.headers);
+  if (token) {
+    headers.Authorization = "Bearer " + token;
+  }
+  const response = await fetch(path, Object.assign({}, options, { headers }));
+  if (response.status === 401 && askToken()) {
+    return api(path, options);
+  }
+  return response;
+}
+
+// apiJSON fetches JSON from the server, throwing its error message
+async function apiJSON(path, options = {}) {
+  const response = await api(path, options);
+  const body = await response.json();
+  if (!response.ok && body.error) {
+    throw new Error(body.error);
+  }
+  return body;
+}
+
+// askToken asks for the server's token, reporting whether one was given
+function askToken() {
+  const token = prompt("The server needs a token:", localStorage.getItem("fart-token") || "");
+  if (token === null) {
+    return false;
+  }
+  localStorage.setItem("fart-token", token);
+  return true;
+}
+
+// encodePath encodes each segment of a file path for a URL
+function encodePath(path) {
+  return path.split("/").map(encodeURIComponent).join("/");
+}
+
+// quote writes a value as a single search argument
+function quote(value) {
+  return '"' + value.replace(/(["\\])(?!\/)/g, "\\$1") + '"';
+}
+
+// formatSize formats a number of bytes for people
+function formatSize(size) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (size >= 1024 && i < units.length - 1) {
+    size /= 1024;
+    i++;
+  }
+  return (i === 0 ? size : size.toFixed(1)) + " " + units[i];
+}
+
+// Archive
+
+// search loads the files and facets of the current search
+async function search() {
+  const q = $("query").value.trim();
+  const params = "?q=" + encodeURIComponent(q);
+  try {
+    const [records, facets] = await Promise.all([
+      apiJSON("/api/search" + params),
+      apiJSON("/api/facets" + params),
+    ]);
+    state.records = records;
+    state.selected.clear();
+    renderFiles();
+    renderFacets(facets);
+    showMessage("");
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+}
+
+// renderFacets lists the tags of the files found, by taxonomy
+function renderFacets(facets) {
+  const container = $("facets");
+  container.replaceChildren();
+
+  const taxonomies = Object.keys(facets).sort((a, b) => {
+    if (a === DEFAULT_TAXONOMY || b === DEFAULT_TAXONOMY) {
+      return a === DEFAULT_TAXONOMY ? -1 : 1;
+    }
+    return a.localeCompare(b);
+  });
+
+  for (const taxonomy of taxonomies) {
+    const list = el("ul");
+    const values = facets[taxonomy];
+    values.forEach((facet, i) => {
+      const link = el("a", { textContent: facet.value, title: "Narrow the search to " + facet.value });
+      link.addEventListener("click", () => narrow(taxonomy, facet.value));
+      const item = el("li", {}, link, el("span", { className: "count", textContent: facet.count }));
+      item.hidden = i >= FACET_LIMIT;
+      list.append(item);
+    });
+
+    const facet = el("div", { className: "facet" }, el("h3", { textContent: taxonomy }), list);
+    if (values.length > FACET_LIMIT) {
+      const more = el("span", { className: "more", textContent: "Show all " + values.length });
+      more.addEventListener("click", () => {
+        list.querySelectorAll("li").forEach((item) => (item.hidden = false));
+        more.remove();
+      });
+      facet.append(more);
+    }
+    container.append(facet);
+  }
+}
+
+// narrow adds a tag to the search
+function narrow(taxonomy, value) {
+  const term = (taxonomy === DEFAULT_TAXONOMY ? "" : taxonomy + ":") + quote(value);
+  const q = $("query").value.trim();
+  $("query").value = q ? q + " " + term : term;
+  search();
+}
+
+// renderFiles lists the files found
+function renderFiles() {
+  const body = $("files");
+  body.replaceChildren();
+
+  for (const record of state.records) {
+    const checkbox = el("input", { type: "checkbox", checked: state.selected.has(record.path) });
+    checkbox.addEventListener("click", (event) => event.stopPropagation());
+    checkbox.addEventListener("change", () => {
+      if (checkbox.checked) {
+        state.selected.add(record.path);
+      } else {
+        state.selected.delete(record.path);
+      }
+      renderBulk();
+    });
+
+    const row = el(
+      "tr",
+      { className: record.path === state.current ? "current" : "" },
+      el("td", {}, checkbox),
+      el("td", { textContent: record.path }),
+      el("td", { className: "size", textContent: formatSize(record.size) }),
+      el("td", {}, ...tagChips(record, false))
+    );
+    row.addEventListener("click", () => showFile(record.path));
+    body.append(row);
+  }
+
+  $("select-all").checked = state.records.length > 0 && state.selected.size === state.records.length;
+  renderBulk();
+}
+
+// tagChips shows the tags of a file, with buttons to remove them if
+// removable is set
+function tagChips(record, removable) {
+  const chips = [];
+  for (const taxonomy of Object.keys(record.tags || {}).sort()) {
+    for (const tag of record.tags[taxonomy]) {
+      const chip = el("span", { className: "chip" });
+      if (taxonomy !== DEFAULT_TAXONOMY) {
+        chip.append(el("span", { className: "taxonomy", textContent: taxonomy + ": " }));
+      }
+      chip.append(tag);
+      if (removable) {
+        const remove = el("button", { textContent: "×", title: "Remove this tag" });
+        remove.addEventListener("click", () => changeTags("/api/untag", [record.path], taxonomy, tag));
+        chip.append(remove);
+      }
+      chips.push(chip);
+    }
+  }
+  return chips;
+}
+
+// renderBulk shows the bulk tagging bar while files are selected
+function renderBulk() {
+  $("bulk").hidden = state.selected.size === 0;
+  $("selected-count").textContent = state.selected.size + " selected";
+}
+
+// loadTaxonomies fills the taxonomy choice of the bulk tagging bar
+async function loadTaxonomies() {
+  try {
+    const taxonomies = await apiJSON("/api/taxonomies");
+    const select = $("bulk-taxonomy");
+    select.replaceChildren();
+    for (const t of taxonomies) {
+      select.append(el("option", { value: t.name, textContent: t.name, selected: t.name === DEFAULT_TAXONOMY }));
+    }
+    await loadTagValues();
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+}
+
+// loadTagValues offers the existing tags and aliases of the chosen taxonomy
+// as completions
+async function loadTagValues() {
+  const taxonomy = $("bulk-taxonomy").value;
+  const values = $("bulk-values");
+  values.replaceChildren();
+  if (!taxonomy) {
+    return;
+  }
+  const tags = await apiJSON("/api/taxonomies/" + encodeURIComponent(taxonomy) + "/tags");
+  for (const tag of tags) {
+    values.append(el("option", { value: tag.path }));
+    for (const alias of tag.aliases || []) {
+      values.append(el("option", { value: alias, label: alias + " → " + tag.path }));
+    }
+  }
+}
+
+// changeTags tags or untags files, then shows the changed files again
+async function changeTags(endpoint, paths, taxonomy, value) {
+  try {
+    const result = await apiJSON(endpoint, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ paths, taxonomy, value }),
+    });
+    const errors = Object.entries(result.errors || {});
+    if (errors.length > 0) {
+      showMessage(errors.map(([path, error]) => path + ": " + error).join("; "), true);
+    } else {
+      showMessage(`${endpoint === "/api/tag" ? "Tagged" : "Untagged"} ${result.updated.length} file(s)`);
+    }
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+
+  const selected = new Set(state.selected);
+  const current = state.current;
+  const message = $("message").textContent;
+  const isError = $("message").className === "error";
+  await search();
+  await loadTagValues();
+  state.selected = new Set(state.records.map((r) => r.path).filter((p) => selected.has(p)));
+  renderFiles();
+  if (current) {
+    await showFile(current);
+  }
+  showMessage(message, isError);
+}
+
+// bulkChange tags or untags the selected files
+function bulkChange(endpoint) {
+  const value = $("bulk-value").value.trim();
+  if (!value) {
+    showMessage("Enter a tag first", true);
+    return;
+  }
+  changeTags(endpoint, [...state.selected], $("bulk-taxonomy").value, value);
+}
+
+// showFile shows a file's tags, properties and a preview of it
+async function showFile(path) {
+  state.current = path;
+  document.querySelectorAll("#files tr").forEach((row, i) => {
+    row.className = state.records[i] && state.records[i].path === path ? "current" : "";
+  });
+
+  const pane = $("preview");
+  try {
+    const record = await apiJSON("/api/files/" + encodePath(path));
+    const details = el("dl");
+    details.append(el("dt", { textContent: "Size" }), el("dd", { textContent: formatSize(record.size) }));
+    details.append(el("dt", { textContent: "Modified" }), el("dd", { textContent: record.modified_at }));
+    for (const name of Object.keys(record.properties || {}).sort()) {
+      details.append(el("dt", { textContent: name }), el("dd", { textContent: record.properties[name] }));
+    }
+    details.append(el("dt", { textContent: "Hash" }), el("dd", { textContent: record.hash }));
+
+    pane.replaceChildren(el("h2", { textContent: path }), el("div", {}, ...tagChips(record, true)), details);
+    if (!path.includes("!/")) {
+      pane.append(await preview("/raw/" + encodePath(path)));
+    }
+  } catch (err) {
+    pane.replaceChildren(el("p", { textContent: err.message }));
+  }
+}
+
+// preview shows images, PDFs and the start of text files. The content is
+// fetched so that the token can be sent, and shown from a blob.
+async function preview(url) {
+  const response = await api(url);
+  if (!response.ok) {
+    return el("p", { textContent: "No preview" });
+  }
+  const type = (response.headers.get("Content-Type") || "").split(";")[0];
+  if (state.previewURL) {
+    URL.revokeObjectURL(state.previewURL);
+    state.previewURL = null;
+  }
+
+  if (type.startsWith("image/") && type !== "image/svg+xml") {
+    state.previewURL = URL.createObjectURL(await response.blob());
+    return el("img", { src: state.previewURL, alt: "" });
+  }
+  if (type === "application/pdf") {
+    state.previewURL = URL.createObjectURL(await response.blob());
+    return el("iframe", { src: state.previewURL, title: "PDF preview" });
+  }
+  if (type.startsWith("text/") || type === "application/json") {
+    const text = await response.text();
+    return el("pre", { textContent: text.slice(0, TEXT_PREVIEW_LEN) });
+  }
+  return el("p", { textContent: "No preview for " + (type || "this file") });
+}
+
+// Inbox
+
+// loadStage lists the files waiting in the stage directory
+async function loadStage() {
+  const body = $("stage-files");
+  body.replaceChildren();
+  try {
+    const stage = await apiJSON("/api/stage");
+    $("stage-directory").textContent = "Stage directory: " + stage.directory;
+
+    const onlyNew = $("only-new").checked;
+    for (const file of stage.files) {
+      if (onlyNew && file.known) {
+        continue;
+      }
+      const status = file.known
+        ? el("span", { className: "duplicate", textContent: "Already at " + file.existing })
+        : el("span", { className: "new", textContent: "New" });
+      const row = el(
+        "tr",
+        {},
+        el("td", { textContent: file.path }),
+        el("td", { className: "size", textContent: formatSize(file.size) }),
+        el("td", { textContent: file.kind }),
+        el("td", {}, status)
+      );
+      row.addEventListener("click", () => showStageFile(file));
+      body.append(row);
+    }
+    if (body.children.length === 0) {
+      body.append(el("tr", {}, el("td", { colSpan: 4, textContent: "Nothing to add" })));
+    }
+  } catch (err) {
+    $("stage-directory").textContent = err.message + ". Set one with fart stage <directory>.";
+  }
+}
+
+// showStageFile previews a staged file
+async function showStageFile(file) {
+  const pane = $("stage-preview");
+  pane.replaceChildren(
+    el("h2", { textContent: file.path }),
+    el("p", { textContent: file.mime_type + ", " + formatSize(file.size) })
+  );
+  pane.append(await preview("/stage/raw/" + encodePath(file.path)));
+}
+
+// Views
+
+function showView(name) {
+  $("archive").hidden = name !== "archive";
+  $("inbox").hidden = name !== "inbox";
+  $("search").hidden = name !== "archive";
+  $("tab-archive").classList.toggle("active", name === "archive");
+  $("tab-inbox").classList.toggle("active", name === "inbox");
+  if (name === "inbox") {
+    loadStage();
+  }
+}
+
+$("search").addEventListener("submit", (event) => {
+  event.preventDefault();
+  search();
+});
+$("select-all").addEventListener("change", (event) => {
+  state.selected = event.target.checked ? new Set(state.records.map((r) => r.path)) : new Set();
+  renderFiles();
+});
+$("bulk-taxonomy").addEventListener("change", loadTagValues);
+$("bulk-tag").addEventListener("click", () => bulkChange("/api/tag"));
+$("bulk-untag").addEventListener("click", () => bulkChange("/api/untag"));
+$("only-new").addEventListener("change", loadStage);
+$("tab-archive").addEventListener("click", () => showView("archive"));
+$("tab-inbox").addEventListener("click", () => showView("inbox"));
+$("token").addEventListener("click", () => {
+  if (askToken()) {
+    loadTaxonomies();
+    search();
+  }
+});
+
+loadTaxonomies();
+search();
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageRaw(t *testing.T) {
+	s, db := newTestServer(t, "")
+	dir := t.TempDir()
+	stage := filepath.Join(dir, "stage")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(stage, "new"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(stage, "new", "notes.txt"): "staged",
+		filepath.Join(outside, "secret.txt"):     "secret",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(stage, "secret.txt"): filepath.Join(outside, "secret.txt"),
+		filepath.Join(stage, "linked"):     outside,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip("symlinks are not supported:", err)
+		}
+	}
+	if err := db.SetStageDirectory(stage); err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(s, "GET", "/stage/raw/new/notes.txt", "")
+	if w.Code != http.StatusOK || w.Body.String() != "staged" {
+		t.Errorf("staged file = %d %q", w.Code, w.Body.String())
+	}
+	for _, target := range []string{
+		"/stage/raw/secret.txt",
+		"/stage/raw/linked/secret.txt",
+		"/stage/raw/new",
+		"/stage/raw/missing.txt",
+	} {
+		if w := request(s, "GET", target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d %q, want 404", target, w.Code, w.Body.String())
+		}
+	}
+}
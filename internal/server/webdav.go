@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"go-fart/internal/database"
+	"go-fart/internal/fileops"
+	"go-fart/internal/query"
+)
+
+// Top-level folders of the WebDAV filesystem
+const (
+	davAll   = "all"   // the archive as it is on disk
+	davTags  = "tags"  // a folder per taxonomy, with a folder per tag
+	davQuery = "query" // a folder per saved search
+)
+
+// davKind is the kind of an entry in the WebDAV filesystem
+type davKind int
+
+const (
+	kindRoot davKind = iota
+	kindAllDir
+	kindTagsRoot
+	kindTaxonomy
+	kindTag
+	kindQueryRoot
+	kindSearch
+	kindFile
+)
+
+// davNode is a folder or file of the WebDAV filesystem, worked out from the
+// database whenever it is looked up
+type davNode struct {
+	kind     davKind
+	name     string
+	taxonomy string // of taxonomy and tag folders
+	tagID    int64  // of tag folders
+	tagPath  string // of tag folders, escaped as in searches
+	search   string // name of a saved search folder
+	path     string // archive path of a file, or of a folder in davAll
+}
+
+// davFS is a read-only WebDAV filesystem presenting the archive by its tags
+// and saved searches
+type davFS struct {
+	taxonomyManager TaxonomyManager
+	db              DatabaseManager
+	started         time.Time
+}
+
+// NewWebDAV creates a read-only WebDAV server of the archive. /all/ mirrors
+// the archive, /tags/<taxonomy>/<tag>/ lists the files with a tag and
+// /query/<name>/ the results of a saved search. If token is not empty,
+// clients must give it as the password of basic authentication, with any
+// user name, or as a bearer token.
+func NewWebDAV(tm TaxonomyManager, db DatabaseManager, token string) http.Handler {
+	handler := readOnly(&webdav.Handler{
+		FileSystem: &davFS{taxonomyManager: tm, db: db, started: time.Now()},
+		LockSystem: webdav.NewMemLS(),
+	})
+	return tokenAuth(token, handler)
+}
+
+// davReadMethods are the WebDAV methods that change nothing. Locks are
+// allowed, as some clients lock files before opening them.
+var davReadMethods = []string{"OPTIONS", "GET", "HEAD", "PROPFIND", "LOCK", "UNLOCK"}
+
+// readOnly refuses requests that would change files
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(davReadMethods, r.Method) {
+			w.Header().Set("Allow", strings.Join(davReadMethods, ", "))
+			http.Error(w, "the archive is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Mkdir is refused, as the filesystem is read-only
+func (f *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+// RemoveAll is refused, as the filesystem is read-only
+func (f *davFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+// Rename is refused, as the filesystem is read-only
+func (f *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// Stat describes a folder or file
+func (f *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.stat(node)
+}
+
+// OpenFile opens a folder or file for reading
+func (f *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	node, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.stat(node)
+	if err != nil {
+		return nil, err
+	}
+	if node.kind != kindFile {
+		return &davDir{fs: f, node: node, info: info}, nil
+	}
+	file, err := os.Open(filepath.FromSlash(node.path))
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{File: file, info: info}, nil
+}
+
+// lookup finds the node at a path by listing the folders above it
+func (f *davFS) lookup(name string) (davNode, error) {
+	node := davNode{kind: kindRoot}
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if node.kind == kindFile {
+			return davNode{}, os.ErrNotExist
+		}
+		children, err := f.children(node)
+		if err != nil {
+			return davNode{}, err
+		}
+		i := sort.Search(len(children), func(i int) bool { return children[i].name >= part })
+		if i == len(children) || children[i].name != part {
+			return davNode{}, os.ErrNotExist
+		}
+		node = children[i]
+	}
+	return node, nil
+}
+
+// children lists the contents of a folder, ordered by name
+func (f *davFS) children(node davNode) ([]davNode, error) {
+	var children []davNode
+	var err error
+	switch node.kind {
+	case kindRoot:
+		children = []davNode{
+			{kind: kindAllDir, name: davAll},
+			{kind: kindTagsRoot, name: davTags},
+			{kind: kindQueryRoot, name: davQuery},
+		}
+	case kindAllDir:
+		children, err = f.archiveChildren(node.path)
+	case kindTagsRoot:
+		children, err = f.taxonomyChildren()
+	case kindTaxonomy, kindTag:
+		children, err = f.tagChildren(node)
+	case kindQueryRoot:
+		var searches []database.SavedSearch
+		searches, err = f.db.GetSavedSearches()
+		for _, s := range searches {
+			children = append(children, davNode{kind: kindSearch, name: fileops.SafeName(s.Name), search: s.Name})
+		}
+	case kindSearch:
+		var search string
+		if search, err = f.db.GetSavedSearch(node.search); err == nil {
+			var terms []string
+			if terms, err = query.Split(search); err == nil {
+				children, err = f.searchChildren(terms, nil)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children, nil
+}
+
+// archiveChildren lists a folder of the archive from the files in the
+// database, leaving out members of containers and files marked missing
+func (f *davFS) archiveChildren(dir string) ([]davNode, error) {
+	files, err := f.db.GetPresentFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []davNode
+	seen := make(map[string]bool)
+	for _, file := range files {
+		file = filepath.ToSlash(filepath.Clean(file))
+		if database.IsContainerMember(file) {
+			continue
+		}
+		rel := file
+		if dir != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(file, dir+"/"); !ok {
+				continue
+			}
+		}
+		name, rest, isDir := strings.Cut(rel, "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		child := davNode{kind: kindFile, name: name, path: path.Join(dir, name)}
+		if isDir && rest != "" {
+			child.kind = kindAllDir
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// taxonomyChildren lists a folder for each taxonomy
+func (f *davFS) taxonomyChildren() ([]davNode, error) {
+	taxonomies, err := f.taxonomyManager.Taxonomies()
+	if err != nil {
+		return nil, err
+	}
+	children := make([]davNode, len(taxonomies))
+	for i, t := range taxonomies {
+		children[i] = davNode{kind: kindTaxonomy, name: fileops.SafeName(t.Name), taxonomy: t.Name}
+	}
+	return children, nil
+}
+
+// tagChildren lists a folder for each tag directly under a taxonomy or tag,
+// and for a tag the files tagged with it or any of its descendants
+func (f *davFS) tagChildren(node davNode) ([]davNode, error) {
+	nodes, err := f.taxonomyManager.TagTree(node.taxonomy)
+	if err != nil {
+		return nil, err
+	}
+	paths := database.TagPaths(nodes)
+
+	var children []davNode
+	used := make(map[string]bool)
+	for _, tag := range nodes {
+		if tag.ParentID != node.tagID || tag.Count == 0 {
+			continue
+		}
+		child := davNode{
+			kind:     kindTag,
+			name:     fileops.UniqueName(fileops.SafeName(tag.Name), used),
+			taxonomy: node.taxonomy,
+			tagID:    tag.ID,
+			tagPath:  paths[tag.ID],
+		}
+		children = append(children, child)
+	}
+	if node.kind == kindTaxonomy {
+		return children, nil
+	}
+
+	files, err := f.searchChildren([]string{"--" + node.taxonomy, node.tagPath}, used)
+	if err != nil {
+		return nil, err
+	}
+	return append(children, files...), nil
+}
+
+// searchChildren lists the files matching a search. Names already used in
+// the folder are skipped, and files with the same name are numbered.
+func (f *davFS) searchChildren(terms []string, used map[string]bool) ([]davNode, error) {
+	q, err := query.Parse(terms)
+	if err != nil {
+		return nil, err
+	}
+	files, err := f.taxonomyManager.Search(q)
+	if err != nil {
+		return nil, err
+	}
+	if used == nil {
+		used = make(map[string]bool)
+	}
+
+	var children []davNode
+	sort.Strings(files)
+	for _, file := range files {
+		file = filepath.ToSlash(filepath.Clean(file))
+		if database.IsContainerMember(file) {
+			continue
+		}
+		name := fileops.UniqueName(path.Base(file), used)
+		children = append(children, davNode{kind: kindFile, name: name, path: file})
+	}
+	return children, nil
+}
+
+// stat describes a node. Folders are dated when the server started, and
+// files as they are on disk.
+func (f *davFS) stat(node davNode) (os.FileInfo, error) {
+	if node.kind != kindFile {
+		return davInfo{name: node.name, modTime: f.started}, nil
+	}
+	info, err := os.Stat(filepath.FromSlash(node.path))
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, os.ErrNotExist
+	}
+	return davInfo{name: node.name, size: info.Size(), modTime: info.ModTime(), file: true}, nil
+}
+
+// davInfo describes a node under its name in the WebDAV filesystem, which
+// may differ from the name of the file on disk
+type davInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	file    bool
+}
+
+func (i davInfo) Name() string       { return i.name }
+func (i davInfo) Size() int64        { return i.size }
+func (i davInfo) ModTime() time.Time { return i.modTime }
+func (i davInfo) IsDir() bool        { return !i.file }
+func (i davInfo) Sys() any           { return nil }
+
+func (i davInfo) Mode() fs.FileMode {
+	if i.file {
+		return 0444
+	}
+	return fs.ModeDir | 0555
+}
+
+// davFile is a file of the archive opened for reading
+type davFile struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davDir is an open folder, listed when it is first read
+type davDir struct {
+	fs      *davFS
+	node    davNode
+	info    os.FileInfo
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (d *davDir) Close() error                { return nil }
+func (d *davDir) Stat() (os.FileInfo, error)  { return d.info, nil }
+func (d *davDir) Read(p []byte) (int, error)  { return 0, os.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error) { return 0, os.ErrPermission }
+
+func (d *davDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.listed, d.entries = false, nil
+		return 0, nil
+	}
+	return 0, os.ErrInvalid
+}
+
+// Readdir returns the next count entries of the folder, or all of the rest
+// if count is not positive
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		children, err := d.fs.children(d.node)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			// Files that have gone from the disk are left out
+			if info, err := d.fs.stat(child); err == nil {
+				d.entries = append(d.entries, info)
+			}
+		}
+		d.listed = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-fart/internal/database"
+	"go-fart/internal/taxonomy"
+)
+
+// newTestArchive writes files into a new archive directory, which is the
+// working directory until the test ends, and returns a database of them
+func newTestArchive(t *testing.T, files map[string]string) *database.DB {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var paths []string
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	_, db := newTestServer(t, "", paths...)
+	return db
+}
+
+func TestWebDAV(t *testing.T) {
+	db := newTestArchive(t, map[string]string{
+		"books/eye.txt":  "The Eye of the World",
+		"books/hunt.txt": "The Great Hunt",
+	})
+	if err := db.AddTaxonomy("genre"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TagFile("books/eye.txt", "genre", "fiction/fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSearch("fantasy", "genre:fantasy"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewWebDAV(taxonomy.New(db), db, "")
+
+	for _, path := range []string{
+		"/all/books/eye.txt",
+		"/tags/genre/fiction/fantasy/eye.txt",
+		"/tags/genre/fiction/eye.txt",
+		"/query/fantasy/eye.txt",
+	} {
+		w := request(h, "GET", path, "")
+		if w.Code != http.StatusOK || w.Body.String() != "The Eye of the World" {
+			t.Errorf("GET %s = %d %q", path, w.Code, w.Body)
+		}
+	}
+	for _, path := range []string{"/all/books/missing.txt", "/tags/genre/fiction/hunt.txt", "/query/missing/"} {
+		if w := request(h, "GET", path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+
+	w := request(h, "PROPFIND", "/", "", "Depth", "1")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND / = %d", w.Code)
+	}
+	for _, folder := range []string{"/all/", "/tags/", "/query/"} {
+		if !strings.Contains(w.Body.String(), "<D:href>"+folder+"</D:href>") {
+			t.Errorf("PROPFIND / doesn't list %s: %s", folder, w.Body)
+		}
+	}
+}
+
+func TestWebDAVReadOnly(t *testing.T) {
+	db := newTestArchive(t, map[string]string{"books/eye.txt": "The Eye of the World"})
+	h := NewWebDAV(taxonomy.New(db), db, "")
+
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "MOVE", "COPY", "PROPPATCH"} {
+		if w := request(h, method, "/all/books/eye.txt", ""); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s = %d, want %d", method, w.Code, http.StatusMethodNotAllowed)
+		}
+	}
+	if content, err := os.ReadFile("books/eye.txt"); err != nil || string(content) != "The Eye of the World" {
+		t.Errorf("file changed: %q, %v", content, err)
+	}
+}
+
+func TestWebDAVToken(t *testing.T) {
+	db := newTestArchive(t, map[string]string{"books/eye.txt": "The Eye of the World"})
+	h := NewWebDAV(taxonomy.New(db), db, "secret")
+
+	tests := []struct {
+		header []string
+		want   int
+	}{
+		{nil, http.StatusUnauthorized},
+		{[]string{"Authorization", "Basic dXNlcjp3cm9uZw=="}, http.StatusUnauthorized}, // user:wrong
+		{[]string{"Authorization", "Basic dXNlcjpzZWNyZXQ="}, http.StatusOK},           // user:secret
+		{[]string{"Authorization", "Bearer secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := request(h, "GET", "/all/books/eye.txt", "", tt.header...); w.Code != tt.want {
+			t.Errorf("GET with %q = %d, want %d", tt.header, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// JSONSuffix is appended to a file's name to give its JSON sidecar
+const JSONSuffix = ".fart.json"
+
+// XMPSuffix is the extension of XMP sidecars
+const XMPSuffix = ".xmp"
+
+// JSONPath returns the path of a file's JSON sidecar
+func JSONPath(path string) string {
+	return path + JSONSuffix
+}
+
+// XMPPath returns the path of the XMP sidecar FART writes for a file, which
+// is named like darktable's, `photo.jpg.xmp`
+func XMPPath(path string) string {
+	return path + XMPSuffix
+}
+
+// XMPPaths returns the paths an XMP sidecar of a file may have: darktable's
+// `photo.jpg.xmp` and Lightroom's `photo.xmp`
+func XMPPaths(path string) []string {
+	return []string{
+		XMPPath(path),
+		strings.TrimSuffix(path, filepath.Ext(path)) + XMPSuffix,
+	}
+}
+
+// IsSidecar reports whether a path is a sidecar rather than a file to archive
+func IsSidecar(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, JSONSuffix) || strings.HasSuffix(lower, XMPSuffix)
+}
+
+// ReadJSON reads a JSON sidecar
+func ReadJSON(path string) (*database.FileRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	var record database.FileRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to read sidecar %s: %w", path, err)
+	}
+	return &record, nil
+}
+
+// WriteJSON writes a file's record as a JSON sidecar
+func WriteJSON(path string, record *database.FileRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
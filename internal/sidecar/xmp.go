@@ -0,0 +1,180 @@
+package sidecar
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// XMP namespaces read and written in sidecars
+const (
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsLR  = "http://ns.adobe.com/lightroom/1.0/"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+// toolkit marks the XMP sidecars written by FART. Other sidecars are only
+// read, since they hold settings that FART doesn't know how to preserve.
+const toolkit = "fart"
+
+// HierarchySeparator separates the levels of a Lightroom hierarchical keyword
+const HierarchySeparator = "|"
+
+// XMP is the metadata of an XMP sidecar that FART reads and writes
+type XMP struct {
+	Title        string
+	Creators     []string   // dc:creator
+	Subjects     []string   // dc:subject keywords
+	Hierarchical [][]string // lr:hierarchicalSubject keywords, split into levels
+	Rating       string     // xmp:Rating, "" if the file is unrated
+}
+
+// ReadXMP reads an XMP sidecar, such as one written by Lightroom or darktable
+func ReadXMP(path string) (*XMP, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	x := &XMP{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				for _, attr := range t.Attr {
+					if attr.Name.Space == nsXMP && attr.Name.Local == "Rating" {
+						x.setRating(attr.Value)
+					}
+				}
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" {
+				continue
+			}
+
+			// The property is the innermost element outside the RDF namespace
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space == nsRDF {
+					continue
+				}
+				x.add(stack[i], value)
+				break
+			}
+		}
+	}
+	return x, nil
+}
+
+// add records the value of an XMP property
+func (x *XMP) add(property xml.Name, value string) {
+	switch property {
+	case xml.Name{Space: nsDC, Local: "title"}:
+		if x.Title == "" {
+			x.Title = value
+		}
+	case xml.Name{Space: nsDC, Local: "creator"}:
+		x.Creators = append(x.Creators, value)
+	case xml.Name{Space: nsDC, Local: "subject"}:
+		x.Subjects = append(x.Subjects, value)
+	case xml.Name{Space: nsLR, Local: "hierarchicalSubject"}:
+		x.Hierarchical = append(x.Hierarchical, strings.Split(value, HierarchySeparator))
+	case xml.Name{Space: nsXMP, Local: "Rating"}:
+		x.setRating(value)
+	}
+}
+
+// setRating records a rating, ignoring unrated (0) and rejected (-1) values
+func (x *XMP) setRating(value string) {
+	if value = strings.TrimSpace(value); value != "0" && !strings.HasPrefix(value, "-") {
+		x.Rating = value
+	}
+}
+
+// WrittenByFART reports whether an XMP sidecar was written by FART, and so
+// can be replaced
+func WrittenByFART(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	return bytes.Contains(data, []byte(`x:xmptk="`+toolkit+`"`)), nil
+}
+
+// WriteXMP writes an XMP sidecar
+func WriteXMP(path string, x *XMP) error {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="` + toolkit + `">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="` + nsRDF + `">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""` + "\n")
+	b.WriteString(`    xmlns:dc="` + nsDC + `"` + "\n")
+	b.WriteString(`    xmlns:lr="` + nsLR + `"` + "\n")
+	b.WriteString(`    xmlns:xmp="` + nsXMP + `"`)
+	if x.Rating != "" {
+		b.WriteString("\n    xmp:Rating=\"" + escape(x.Rating) + `"`)
+	}
+	b.WriteString(">\n")
+
+	if x.Title != "" {
+		writeList(&b, "dc:title", "rdf:Alt", []string{x.Title})
+	}
+	writeList(&b, "dc:creator", "rdf:Seq", x.Creators)
+	writeList(&b, "dc:subject", "rdf:Bag", x.Subjects)
+
+	hierarchical := make([]string, len(x.Hierarchical))
+	for i, levels := range x.Hierarchical {
+		hierarchical[i] = strings.Join(levels, HierarchySeparator)
+	}
+	writeList(&b, "lr:hierarchicalSubject", "rdf:Bag", hierarchical)
+
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>\n")
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// writeList writes a property holding an RDF container of values
+func writeList(b *strings.Builder, property, container string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	b.WriteString("   <" + property + ">\n    <" + container + ">\n")
+	for _, value := range values {
+		if container == "rdf:Alt" {
+			b.WriteString(`     <rdf:li xml:lang="x-default">` + escape(value) + "</rdf:li>\n")
+		} else {
+			b.WriteString("     <rdf:li>" + escape(value) + "</rdf:li>\n")
+		}
+	}
+	b.WriteString("    </" + container + ">\n   </" + property + ">\n")
+}
+
+// escape escapes text for use in XML
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package taxonomy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// Taxonomy returns the settings of a taxonomy
+func (m *Manager) Taxonomy(name string) (*database.Taxonomy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	t, err := m.db.GetTaxonomy(name)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("taxonomy not found: %s", name)
+	}
+	return t, nil
+}
+
+// Taxonomies returns the settings of every taxonomy
+func (m *Manager) Taxonomies() ([]database.Taxonomy, error) {
+	return m.db.GetTaxonomies()
+}
+
+// ConfigureTaxonomy validates and saves the settings of a taxonomy. Changing
+// the value type converts the existing tags to the new type.
+func (m *Manager) ConfigureTaxonomy(t database.Taxonomy) error {
+	if t.ValuePattern != "" {
+		if _, err := compilePattern(t.ValuePattern); err != nil {
+			return err
+		}
+	}
+	if err := checkValueType(t.ValueType); err != nil {
+		return err
+	}
+
+	current, err := m.Taxonomy(t.Name)
+	if err != nil {
+		return err
+	}
+	if current.ValueType != t.ValueType {
+		return m.retype(t)
+	}
+	return m.db.UpdateTaxonomy(t)
+}
+
+// RegisterTag adds a tag to a taxonomy's vocabulary without tagging a file
+func (m *Manager) RegisterTag(taxonomyName, tagValue string) error {
+	if taxonomyName == "" || tagValue == "" {
+		return fmt.Errorf("taxonomy name and tag value are required")
+	}
+
+	t, err := m.Taxonomy(taxonomyName)
+	if err != nil {
+		return err
+	}
+	tagValue, err = CanonicalValue(t.ValueType, tagValue)
+	if err != nil {
+		return fmt.Errorf("invalid %s value: %w", t.Name, err)
+	}
+	if t.ValuePattern != "" {
+		if err := matchPattern(t, tagValue); err != nil {
+			return err
+		}
+	}
+	return m.db.RegisterTag(t.Name, tagValue)
+}
+
+// UntagFile removes a tag from a file
+func (m *Manager) UntagFile(filePath, taxonomyName, tagValue string) error {
+	if filePath == "" || taxonomyName == "" || tagValue == "" {
+		return fmt.Errorf("file path, taxonomy name, and tag value are required")
+	}
+
+	taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+
+	t, err := m.db.GetTaxonomy(taxonomyName)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		if value, err := CanonicalValue(t.ValueType, tagValue); err == nil {
+			tagValue = value
+		}
+	}
+	return m.db.UntagFile(filePath, taxonomyName, tagValue)
+}
+
+// checkConstraints enforces a taxonomy's value type, value pattern and closed
+// vocabulary, returning the value in its canonical form
+func (m *Manager) checkConstraints(t *database.Taxonomy, tagValue string) (string, error) {
+	tagValue, err := CanonicalValue(t.ValueType, tagValue)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s value: %w", t.Name, err)
+	}
+
+	if t.ValuePattern != "" {
+		if err := matchPattern(t, tagValue); err != nil {
+			return "", err
+		}
+	}
+
+	if t.Closed {
+		exists, err := m.db.TagExists(t.Name, tagValue)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", fmt.Errorf("%q is not an allowed %s value, see `fart tags tree --%s` or register it with `fart tags add --%s %q`",
+				tagValue, t.Name, t.Name, t.Name, tagValue)
+		}
+	}
+	return tagValue, nil
+}
+
+// matchPattern checks a tag value against a taxonomy's value pattern
+func matchPattern(t *database.Taxonomy, tagValue string) error {
+	re, err := compilePattern(t.ValuePattern)
+	if err != nil {
+		return err
+	}
+	if !re.MatchString(tagValue) {
+		return fmt.Errorf("%q is not a valid %s value: must match %s", tagValue, t.Name, t.ValuePattern)
+	}
+	return nil
+}
+
+// compilePattern compiles a value pattern so that it must match the whole value
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid value pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
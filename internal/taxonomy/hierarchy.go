@@ -0,0 +1,50 @@
+package taxonomy
+
+import (
+	"fmt"
+	"strings"
+
+	"go-fart/internal/database"
+)
+
+// TagTree returns the tags of a taxonomy with their parent relationships
+func (m *Manager) TagTree(taxonomyName string) ([]database.TagNode, error) {
+	if taxonomyName == "" {
+		return nil, fmt.Errorf("taxonomy name is required")
+	}
+
+	taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+	return m.db.GetTagTree(taxonomyName)
+}
+
+// MoveTag moves a tag under a new parent, or to the top level if the parent
+// path is empty
+func (m *Manager) MoveTag(taxonomyName, tagPath, parentPath string) error {
+	if taxonomyName == "" || tagPath == "" {
+		return fmt.Errorf("taxonomy name and tag are required")
+	}
+
+	taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+	return m.db.MoveTag(taxonomyName, tagPath, parentPath)
+}
+
+// AddAlias makes an alternative spelling resolve to a canonical tag, both when
+// tagging files and when searching
+func (m *Manager) AddAlias(taxonomyName, alias, canonicalPath string) error {
+	if taxonomyName == "" || alias == "" || canonicalPath == "" {
+		return fmt.Errorf("taxonomy name, alias and canonical tag are required")
+	}
+
+	taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+	return m.db.AddTagAlias(taxonomyName, alias, canonicalPath)
+}
+
+// RemoveAlias removes an alternative spelling of a tag
+func (m *Manager) RemoveAlias(taxonomyName, alias string) error {
+	if taxonomyName == "" || alias == "" {
+		return fmt.Errorf("taxonomy name and alias are required")
+	}
+
+	taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+	return m.db.RemoveTagAlias(taxonomyName, alias)
+}
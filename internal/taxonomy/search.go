@@ -0,0 +1,85 @@
+package taxonomy
+
+import (
+	"fmt"
+	"strings"
+
+	"go-fart/internal/database"
+	"go-fart/internal/query"
+)
+
+// Search returns the files matching a parsed query. Values are converted to
+// the value type of their taxonomy so that typed comparisons and ranges work.
+func (m *Manager) Search(q *query.Query) ([]string, error) {
+	opts := database.SearchOptions{SortDesc: q.SortDesc}
+
+	for _, term := range q.Terms {
+		filter, err := m.filter(term)
+		if err != nil {
+			return nil, err
+		}
+		opts.Filters = append(opts.Filters, filter)
+	}
+
+	if q.Sort != "" {
+		opts.SortTaxonomy = strings.ToLower(q.Sort)
+		t, err := m.Taxonomy(opts.SortTaxonomy)
+		if err != nil {
+			return nil, err
+		}
+		opts.SortType = t.ValueType
+	}
+
+	return m.db.Search(opts)
+}
+
+// filter converts a query term into a database filter
+func (m *Manager) filter(term query.Term) (database.Filter, error) {
+	switch term.Field {
+	case query.PropertyField:
+		return database.Filter{Property: term.Key, Op: string(term.Op), Value: term.Value}, nil
+	case query.MIMEField:
+		return database.Filter{Attribute: database.AttrMIMEType, Op: string(term.Op), Value: term.Value}, nil
+	case query.KindField:
+		return database.Filter{Attribute: database.AttrKind, Op: string(term.Op), Value: term.Value}, nil
+	}
+
+	filter := database.Filter{
+		Taxonomy:  strings.ToLower(strings.TrimSpace(term.Field)),
+		ValueType: database.TypeText,
+		Op:        string(term.Op),
+		Value:     term.Value,
+		Value2:    term.Value2,
+	}
+
+	t, err := m.db.GetTaxonomy(filter.Taxonomy)
+	if err != nil {
+		return filter, err
+	}
+	if t == nil {
+		// Unknown taxonomies match nothing
+		return filter, nil
+	}
+	filter.ValueType = t.ValueType
+
+	// Text values can legitimately contain "..", so only typed taxonomies
+	// have ranges
+	if t.ValueType == database.TypeText {
+		if term.Op == query.OpRange {
+			filter.Op, filter.Value, filter.Value2 = string(query.OpEqual), term.Raw, ""
+		}
+		return filter, nil
+	}
+
+	if filter.Value != "" {
+		if filter.Value, err = CanonicalValue(t.ValueType, filter.Value); err != nil {
+			return filter, fmt.Errorf("invalid %s value in search: %w", t.Name, err)
+		}
+	}
+	if filter.Value2 != "" {
+		if filter.Value2, err = CanonicalValue(t.ValueType, filter.Value2); err != nil {
+			return filter, fmt.Errorf("invalid %s value in search: %w", t.Name, err)
+		}
+	}
+	return filter, nil
+}
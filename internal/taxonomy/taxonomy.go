@@ -3,6 +3,8 @@ package taxonomy
 import (
     "fmt"
     "strings"
+
+    "go-fart/internal/database"
 )
 
 // Manager handles taxonomy-related operations
@@ -15,6 +17,19 @@ type TaxonomyDB interface {
     AddTaxonomy(name string) error
     TagFile(filePath, taxonomyName, tagName string) error
     SearchByTag(taxonomyName, tagName string) ([]string, error)
+    GetTagTree(taxonomyName string) ([]database.TagNode, error)
+    MoveTag(taxonomyName, tagPath, parentPath string) error
+    AddTagAlias(taxonomyName, alias, canonicalPath string) error
+    RemoveTagAlias(taxonomyName, alias string) error
+    GetTaxonomy(name string) (*database.Taxonomy, error)
+    GetTaxonomies() ([]database.Taxonomy, error)
+    UpdateTaxonomy(t database.Taxonomy) error
+    TagExists(taxonomyName, tagPath string) (bool, error)
+    RegisterTag(taxonomyName, tagPath string) error
+    SetFileTag(filePath, taxonomyName, tagName string) error
+    UntagFile(filePath, taxonomyName, tagPath string) error
+    RetypeTaxonomy(t database.Taxonomy, merges []database.TagMerge, renames map[int64]string) error
+    Search(opts database.SearchOptions) ([]string, error)
 }
 
 // New creates a new taxonomy manager
@@ -38,6 +53,22 @@ func (m *Manager) TagFile(filePath, taxonomyName, tagValue string) error {
     }
     
     taxonomyName = strings.ToLower(strings.TrimSpace(taxonomyName))
+
+    t, err := m.db.GetTaxonomy(taxonomyName)
+    if err != nil {
+        return err
+    }
+    if t == nil {
+        return m.db.TagFile(filePath, taxonomyName, tagValue)
+    }
+
+    tagValue, err = m.checkConstraints(t, tagValue)
+    if err != nil {
+        return err
+    }
+    if t.SingleValued {
+        return m.db.SetFileTag(filePath, taxonomyName, tagValue)
+    }
     return m.db.TagFile(filePath, taxonomyName, tagValue)
 }
 
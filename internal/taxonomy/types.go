@@ -0,0 +1,147 @@
+package taxonomy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-fart/internal/database"
+)
+
+// ValueTypes lists the value types a taxonomy can be declared with
+var ValueTypes = []string{
+	database.TypeText,
+	database.TypeInt,
+	database.TypeFloat,
+	database.TypeDate,
+	database.TypeBool,
+}
+
+// dateLayout is the canonical form of date values
+const dateLayout = "2006-01-02"
+
+// CanonicalValue validates a value against a value type and returns the form
+// it is stored in, which is what makes typed values compare correctly
+func CanonicalValue(valueType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch valueType {
+	case database.TypeText, "":
+		return value, nil
+
+	case database.TypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an integer", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+
+	case database.TypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case database.TypeDate:
+		d, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a date, expected YYYY-MM-DD", value)
+		}
+		return d.Format(dateLayout), nil
+
+	case database.TypeBool:
+		switch strings.ToLower(value) {
+		case "true", "yes", "y", "1":
+			return "true", nil
+		case "false", "no", "n", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%q is not a boolean, expected true or false", value)
+
+	default:
+		return "", checkValueType(valueType)
+	}
+}
+
+// checkValueType returns an error if a value type is not one of ValueTypes
+func checkValueType(valueType string) error {
+	for _, t := range ValueTypes {
+		if valueType == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown value type %q, expected one of %s", valueType, strings.Join(ValueTypes, ", "))
+}
+
+// retype saves the settings of a taxonomy along with its existing tags
+// converted to the new value type. Tags under the same parent that become the
+// same value, such as 1995 and 01995 as integers, are merged, and so are their
+// children in turn. Nothing changes if any tag is not a valid value.
+func (m *Manager) retype(t database.Taxonomy) error {
+	nodes, err := m.db.GetTagTree(t.Name)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[int64]string, len(nodes))
+	children := make(map[int64][]database.TagNode)
+	for _, node := range nodes {
+		value, err := CanonicalValue(t.ValueType, node.Name)
+		if err != nil {
+			return fmt.Errorf("cannot change %s to %s: %w", t.Name, t.ValueType, err)
+		}
+		values[node.ID] = value
+		children[node.ParentID] = append(children[node.ParentID], node)
+	}
+
+	var merges []database.TagMerge
+	renames := make(map[int64]string)
+	// group merges the tags that become the same value among the children of
+	// some parents, which are the tags a parent was merged with. Children are
+	// merged before their parents, so that merging the parents moves no
+	// children that collide.
+	var group func(parentIDs []int64)
+	group = func(parentIDs []int64) {
+		var order []string
+		byValue := make(map[string][]database.TagNode)
+		for _, parentID := range parentIDs {
+			for _, node := range children[parentID] {
+				value := values[node.ID]
+				if _, ok := byValue[value]; !ok {
+					order = append(order, value)
+				}
+				byValue[value] = append(byValue[value], node)
+			}
+		}
+
+		for _, value := range order {
+			same := byValue[value]
+
+			// Keep the tag that already has the value, or else the first
+			keep := same[0]
+			for _, node := range same {
+				if node.Name == value {
+					keep = node
+					break
+				}
+			}
+			ids := []int64{keep.ID}
+			for _, node := range same {
+				if node.ID != keep.ID {
+					ids = append(ids, node.ID)
+				}
+			}
+			group(ids)
+			for _, id := range ids[1:] {
+				merges = append(merges, database.TagMerge{FromID: id, ToID: keep.ID})
+			}
+			if keep.Name != value {
+				renames[keep.ID] = value
+			}
+		}
+	}
+	group([]int64{0})
+	return m.db.RetypeTaxonomy(t, merges, renames)
+}
@@ -0,0 +1,195 @@
+package taxonomy
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-fart/internal/database"
+)
+
+func TestCanonicalValue(t *testing.T) {
+	tests := []struct {
+		valueType string
+		value     string
+		want      string
+		wantErr   bool
+	}{
+		{valueType: database.TypeText, value: " Fantasy ", want: "Fantasy"},
+		{valueType: "", value: "007", want: "007"},
+
+		{valueType: database.TypeInt, value: "1995", want: "1995"},
+		{valueType: database.TypeInt, value: "007", want: "7"},
+		{valueType: database.TypeInt, value: "01995", want: "1995"},
+		{valueType: database.TypeInt, value: "+5", want: "5"},
+		{valueType: database.TypeInt, value: "-0", want: "0"},
+		{valueType: database.TypeInt, value: " 42 ", want: "42"},
+		{valueType: database.TypeInt, value: "1.5", wantErr: true},
+		{valueType: database.TypeInt, value: "", wantErr: true},
+
+		{valueType: database.TypeFloat, value: "1.50", want: "1.5"},
+		{valueType: database.TypeFloat, value: "1e3", want: "1000"},
+		{valueType: database.TypeFloat, value: "-0.25", want: "-0.25"},
+		{valueType: database.TypeFloat, value: "3", want: "3"},
+		{valueType: database.TypeFloat, value: "abc", wantErr: true},
+
+		{valueType: database.TypeDate, value: "2024-02-29", want: "2024-02-29"},
+		{valueType: database.TypeDate, value: "2023-02-29", wantErr: true},
+		{valueType: database.TypeDate, value: "2024-1-5", wantErr: true},
+		{valueType: database.TypeDate, value: "29/02/2024", wantErr: true},
+
+		{valueType: database.TypeBool, value: "Yes", want: "true"},
+		{valueType: database.TypeBool, value: "1", want: "true"},
+		{valueType: database.TypeBool, value: "TRUE", want: "true"},
+		{valueType: database.TypeBool, value: "n", want: "false"},
+		{valueType: database.TypeBool, value: "0", want: "false"},
+		{valueType: database.TypeBool, value: "maybe", wantErr: true},
+
+		{valueType: "colour", value: "red", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := CanonicalValue(tt.valueType, tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("CanonicalValue(%q, %q) = %q, want an error", tt.valueType, tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CanonicalValue(%q, %q) failed: %v", tt.valueType, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CanonicalValue(%q, %q) = %q, want %q", tt.valueType, tt.value, got, tt.want)
+		}
+	}
+}
+
+// newTestManager returns a manager for a new database with a taxonomy
+// holding the given tags, each on a file of its own named after it
+func newTestManager(t *testing.T, taxonomyName string, tags ...string) (*Manager, *database.DB) {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "fart.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(db)
+	if err := m.InitTaxonomy(taxonomyName); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		if err := db.AddFile(tag+".txt", ".", tag, 1, "2024-01-01 00:00:00"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.TagFile(tag+".txt", taxonomyName, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m, db
+}
+
+// tagNames returns the names of the tags of a taxonomy
+func tagNames(t *testing.T, m *Manager, taxonomyName string) []string {
+	t.Helper()
+	nodes, err := m.TagTree(taxonomyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func TestRetypeMergesCollisions(t *testing.T) {
+	m, db := newTestManager(t, "year", "1995", "01995", "007")
+
+	err := m.ConfigureTaxonomy(database.Taxonomy{Name: "year", ValueType: database.TypeInt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := tagNames(t, m, "year"), []string{"1995", "7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+	files, err := m.SearchByTag("year", "1995")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("files tagged 1995 = %v, want both 1995.txt and 01995.txt", files)
+	}
+	current, err := db.GetTaxonomy("year")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ValueType != database.TypeInt {
+		t.Errorf("value type = %q, want %q", current.ValueType, database.TypeInt)
+	}
+}
+
+func TestRetypeInvalidValueChangesNothing(t *testing.T) {
+	m, db := newTestManager(t, "year", "007", "1995", "unknown")
+
+	err := m.ConfigureTaxonomy(database.Taxonomy{Name: "year", ValueType: database.TypeInt})
+	if err == nil {
+		t.Fatal("expected an error for a tag that isn't an integer")
+	}
+
+	if got, want := tagNames(t, m, "year"), []string{"007", "1995", "unknown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+	current, err := db.GetTaxonomy("year")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ValueType != database.TypeText {
+		t.Errorf("value type = %q, want %q", current.ValueType, database.TypeText)
+	}
+}
+
+func TestRetypeKeepsNestedTags(t *testing.T) {
+	m, db := newTestManager(t, "year", "1995")
+	if err := m.RegisterTag("year", "1995/01995"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.ConfigureTaxonomy(database.Taxonomy{Name: "year", ValueType: database.TypeInt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tagNames(t, m, "year"), []string{"1995", "1995"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+	if exists, err := db.TagExists("year", "1995/1995"); err != nil || !exists {
+		t.Errorf("1995/1995 exists = %v, %v", exists, err)
+	}
+}
+
+func TestRetypeMergesChildren(t *testing.T) {
+	m, db := newTestManager(t, "year")
+	for _, tag := range []string{"1990/1995", "01990/01995", "01990/1996"} {
+		if err := m.RegisterTag("year", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := m.ConfigureTaxonomy(database.Taxonomy{Name: "year", ValueType: database.TypeInt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tagNames(t, m, "year"), []string{"1990", "1995", "1996"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+	for _, tag := range []string{"1990/1995", "1990/1996"} {
+		if exists, err := db.TagExists("year", tag); err != nil || !exists {
+			t.Errorf("%s exists = %v, %v", tag, exists, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package terminal drives full-screen terminal interfaces: raw input, key
+// decoding, drawing whole screens and a line editor with completion.
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Key is a key press, either a printable character or one of the named keys
+type Key string
+
+// Named keys
+const (
+	KeyEnter     Key = "enter"
+	KeyTab       Key = "tab"
+	KeyBackspace Key = "backspace"
+	KeyEscape    Key = "escape"
+	KeyInterrupt Key = "ctrl-c"
+	KeyUp        Key = "up"
+	KeyDown      Key = "down"
+	KeyLeft      Key = "left"
+	KeyRight     Key = "right"
+)
+
+// ErrNotTerminal is returned when standard input or output is not a terminal
+var ErrNotTerminal = errors.New("not running in a terminal")
+
+// Terminal is the controlling terminal in raw mode, showing the alternate
+// screen
+type Terminal struct {
+	in    *os.File
+	out   *os.File
+	state *term.State
+	keys  *bufio.Reader
+}
+
+// Open puts the terminal into raw mode and switches to the alternate screen.
+// Close must be called to restore it.
+func Open() (*Terminal, error) {
+	in, out := os.Stdin, os.Stdout
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, ErrNotTerminal
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	t := &Terminal{in: in, out: out, state: state, keys: bufio.NewReader(in)}
+	t.write("\x1b[?1049h\x1b[?25l")
+	return t, nil
+}
+
+// Close leaves the alternate screen and restores the terminal
+func (t *Terminal) Close() error {
+	t.write("\x1b[?25h\x1b[?1049l")
+	return term.Restore(int(t.in.Fd()), t.state)
+}
+
+// Size returns the width and height of the terminal
+func (t *Terminal) Size() (width, height int) {
+	width, height, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Draw replaces the screen with lines, cut to the size of the terminal
+func (t *Terminal) Draw(lines []string) {
+	width, height := t.Size()
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(Truncate(line, width))
+	}
+	t.write(b.String())
+}
+
+// ReadKey waits for a key press
+func (t *Terminal) ReadKey() (Key, error) {
+	r, _, err := t.keys.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return KeyEnter, nil
+	case '\t':
+		return KeyTab, nil
+	case 0x7f, 0x08:
+		return KeyBackspace, nil
+	case 0x03:
+		return KeyInterrupt, nil
+	case 0x1b:
+		return t.readEscape()
+	}
+	return Key(string(r)), nil
+}
+
+// readEscape decodes the arrow keys. Escape sequences arrive in a single
+// read, so an escape with nothing buffered after it is the escape key.
+func (t *Terminal) readEscape() (Key, error) {
+	if t.keys.Buffered() < 2 {
+		return KeyEscape, nil
+	}
+	next, _ := t.keys.Peek(2)
+	if next[0] != '[' && next[0] != 'O' {
+		return KeyEscape, nil
+	}
+	t.keys.Discard(2)
+	switch next[1] {
+	case 'A':
+		return KeyUp, nil
+	case 'B':
+		return KeyDown, nil
+	case 'C':
+		return KeyRight, nil
+	case 'D':
+		return KeyLeft, nil
+	}
+	// Skip the rest of sequences such as Page Up (ESC [ 5 ~)
+	for b := next[1]; b >= '0' && b <= '9' || b == ';'; {
+		var err error
+		if b, err = t.keys.ReadByte(); err != nil {
+			return "", err
+		}
+	}
+	return KeyEscape, nil
+}
+
+// Prompt reads a line of text on the last line of the screen. Tab completes
+// the text with the candidates returned by complete, which may be nil. The
+// result is false if the prompt was cancelled with escape or Ctrl-C.
+func (t *Terminal) Prompt(label string, complete func(text string) []string) (string, bool, error) {
+	t.write("\x1b[?25h")
+	defer t.write("\x1b[?25l")
+
+	var text, hint string
+	for {
+		width, height := t.Size()
+		t.write(fmt.Sprintf("\x1b[%d;1H\x1b[2K%s\x1b[%d;1H\x1b[2K%s",
+			height-1, Truncate(hint, width), height, tail(label+text, width-1)))
+
+		key, err := t.ReadKey()
+		if err != nil {
+			return "", false, err
+		}
+		hint = ""
+		switch key {
+		case KeyEnter:
+			return text, true, nil
+		case KeyEscape, KeyInterrupt:
+			return "", false, nil
+		case KeyBackspace:
+			if _, size := utf8.DecodeLastRuneInString(text); size > 0 {
+				text = text[:len(text)-size]
+			}
+		case KeyTab:
+			if complete == nil {
+				continue
+			}
+			candidates := complete(text)
+			if prefix := CommonPrefix(candidates); len(prefix) > len(text) {
+				text = prefix
+			}
+			if len(candidates) > 1 {
+				hint = strings.Join(candidates, "  ")
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(string(key)); len(key) == utf8.RuneLen(r) && unicode.IsPrint(r) {
+				text += string(key)
+			}
+		}
+	}
+}
+
+// Confirm asks a yes or no question on the last line of the screen, taking
+// any key but y as no
+func (t *Terminal) Confirm(question string) (bool, error) {
+	width, height := t.Size()
+	t.write(fmt.Sprintf("\x1b[%d;1H\x1b[2K%s", height, Truncate(question+" [y/N] ", width)))
+	key, err := t.ReadKey()
+	if err != nil {
+		return false, err
+	}
+	return key == "y" || key == "Y", nil
+}
+
+func (t *Terminal) write(s string) {
+	t.out.WriteString(s)
+}
+
+// Complete returns the candidates that start with text, ignoring case, in
+// order
+func Complete(text string, candidates []string) []string {
+	var matches []string
+	lower := strings.ToLower(text)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), lower) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// CommonPrefix returns the longest prefix shared by all of the strings
+func CommonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// Truncate cuts s to at most width characters
+func Truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width <= 1 {
+		return string(runes[:max(width, 0)])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// tail keeps the end of s, so that the text being typed stays visible
+func tail(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[len(runes)-width:])
+}
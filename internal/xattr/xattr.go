@@ -0,0 +1,8 @@
+// Package xattr reads and writes extended attributes of files
+package xattr
+
+import "errors"
+
+// ErrNotSupported is returned when a file's filesystem has no extended
+// attributes, or the platform has none FART can use
+var ErrNotSupported = errors.New("extended attributes are not supported")
@@ -0,0 +1,87 @@
+//go:build linux
+
+package xattr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Get reads an attribute of a file, reporting whether it is set
+func Get(path, name string) (string, bool, error) {
+	for {
+		size, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			return "", false, attrError(err, name)
+		}
+		buf := make([]byte, size)
+		n, err := unix.Getxattr(path, name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// The attribute grew between the calls
+			continue
+		}
+		if err != nil {
+			return "", false, attrError(err, name)
+		}
+		return string(buf[:n]), true, nil
+	}
+}
+
+// Set writes an attribute of a file
+func Set(path, name, value string) error {
+	if err := unix.Setxattr(path, name, []byte(value), 0); err != nil {
+		return attrError(err, name)
+	}
+	return nil
+}
+
+// Remove removes an attribute of a file, if it is set
+func Remove(path, name string) error {
+	if err := unix.Removexattr(path, name); err != nil {
+		return attrError(err, name)
+	}
+	return nil
+}
+
+// List returns the names of a file's attributes
+func List(path string) ([]string, error) {
+	for {
+		size, err := unix.Listxattr(path, nil)
+		if err != nil {
+			return nil, attrError(err, "")
+		}
+		buf := make([]byte, size)
+		n, err := unix.Listxattr(path, buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, attrError(err, "")
+		}
+
+		var names []string
+		for _, name := range strings.Split(string(buf[:n]), "\x00") {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+}
+
+// attrError converts the errors of attribute calls. An unset attribute is
+// not an error.
+func attrError(err error, name string) error {
+	switch {
+	case errors.Is(err, unix.ENODATA):
+		return nil
+	case errors.Is(err, unix.ENOTSUP):
+		return ErrNotSupported
+	case name != "":
+		return fmt.Errorf("failed to access attribute %s: %w", name, err)
+	}
+	return fmt.Errorf("failed to list attributes: %w", err)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package xattr
+
+// Get reads an attribute of a file, reporting whether it is set
+func Get(path, name string) (string, bool, error) {
+	return "", false, ErrNotSupported
+}
+
+// Set writes an attribute of a file
+func Set(path, name, value string) error {
+	return ErrNotSupported
+}
+
+// Remove removes an attribute of a file, if it is set
+func Remove(path, name string) error {
+	return ErrNotSupported
+}
+
+// List returns the names of a file's attributes
+func List(path string) ([]string, error) {
+	return nil, ErrNotSupported
+}